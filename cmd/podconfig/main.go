@@ -9,6 +9,7 @@ import (
 	"syscall"
 	"time"
 
+	"github.com/Takenobou/podconfig/internal/atomicfile"
 	"github.com/Takenobou/podconfig/internal/config"
 	"github.com/Takenobou/podconfig/internal/server"
 	"github.com/Takenobou/podconfig/web"
@@ -17,12 +18,50 @@ import (
 func main() {
 	cfg := config.LoadConfig()
 
-	feedService := &server.FeedService{}
+	backups := &server.BackupService{
+		Dir:    cfg.BackupDir,
+		Keep:   cfg.BackupKeep,
+		MaxAge: cfg.BackupMaxAge,
+	}
+	feedService := &server.FeedService{
+		Backups:     backups,
+		LockPath:    cfg.LockPath,
+		LockTimeout: cfg.LockTimeout,
+		DraftDir:    cfg.DraftDir,
+	}
 
 	handler := &server.Handler{
 		PodsyncConfigPath:   cfg.PodsyncConfigPath,
 		DockerContainerName: cfg.DockerContainerName,
 		FeedService:         feedService,
+		Backups:             backups,
+		Events:              server.NewEvents(),
+		Snapshots:           &server.SnapshotService{Path: cfg.SnapshotPath},
+		Undo:                &server.UndoStack{},
+		Uploads:             &server.UploadService{FeedURL: cfg.UploadFeedURL, SiteURL: cfg.ChannelSiteURL},
+	}
+
+	journal, err := server.OpenJournal(cfg.JournalPath)
+	if err != nil {
+		log.Fatalf("Failed to open change journal: %v", err)
+	}
+	handler.Journal = journal
+
+	if cfg.GitHistory {
+		if cfg.HistoryDir == "" && atomicfile.IsMountPoint(cfg.PodsyncConfigPath) {
+			log.Printf("WARNING: %s is mounted on its own, so config history kept next to it is lost when the container is re-created; set HISTORY_DIR to a mounted directory", cfg.PodsyncConfigPath)
+		}
+		history, err := server.OpenHistory(cfg.PodsyncConfigPath, cfg.HistoryDir)
+		if err != nil {
+			log.Fatalf("Failed to open config history: %v", err)
+		}
+		handler.History = history
+	}
+
+	watchCtx, stopWatching := context.WithCancel(context.Background())
+	defer stopWatching()
+	if err := handler.WatchConfig(watchCtx); err != nil {
+		log.Printf("WARNING: Not watching %s for external edits: %v", cfg.PodsyncConfigPath, err)
 	}
 
 	port := cfg.ServerPort
@@ -38,12 +77,43 @@ func main() {
 	http.HandleFunc("/feeds", handler.FeedListHandler)
 	http.HandleFunc("/modify", handler.ModifyFeedHandler)
 	http.HandleFunc("/remove", handler.RemoveFeedHandler)
+	http.HandleFunc("/filters/preview", handler.FilterPreviewHandler)
+	http.HandleFunc("/categories", handler.CategoriesHandler)
+	http.HandleFunc("/schedule/preview", handler.SchedulePreviewHandler)
 	http.HandleFunc("/changelog", handler.ChangelogHandler)
+	http.HandleFunc("/draft/diff", handler.DraftDiffHandler)
+	http.HandleFunc("/draft/apply", handler.ApplyDraftHandler)
+	http.HandleFunc("/draft/discard", handler.DiscardDraftHandler)
+	http.HandleFunc("/undo", handler.UndoHandler)
+	http.HandleFunc("/redo", handler.RedoHandler)
+	http.HandleFunc("/config", handler.ConfigPageHandler)
+	http.HandleFunc("/config/raw", handler.RawConfigHandler)
+	http.HandleFunc("/settings", handler.SettingsPageHandler)
+	http.HandleFunc("/settings/server", handler.ServerSettingsHandler)
+	http.HandleFunc("/settings/storage", handler.StorageSettingsHandler)
+	http.HandleFunc("/settings/storage/test", handler.StorageTestHandler)
+	http.HandleFunc("/settings/downloader", handler.DownloaderSettingsHandler)
+	http.HandleFunc("/settings/log", handler.LogSettingsHandler)
+	http.HandleFunc("/settings/tokens", handler.TokensHandler)
+	http.HandleFunc("/settings/tokens/add", handler.AddTokenHandler)
+	http.HandleFunc("/settings/tokens/remove", handler.RemoveTokenHandler)
+	http.HandleFunc("/validate", handler.ValidateHandler)
+	http.HandleFunc("/drift", handler.DriftHandler)
+	http.HandleFunc("/backups", handler.BackupListHandler)
+	http.HandleFunc("/backups/view", handler.BackupViewHandler)
+	http.HandleFunc("/backups/diff", handler.BackupDiffHandler)
+	http.HandleFunc("/backups/restore", handler.RestoreBackupHandler)
+	http.HandleFunc("/history", handler.HistoryListHandler)
+	http.HandleFunc("/history/diff", handler.HistoryDiffHandler)
+	http.HandleFunc("/history/blame", handler.HistoryBlameHandler)
+	http.HandleFunc("/history/revert", handler.HistoryRevertHandler)
+	http.HandleFunc("/events", handler.EventsHandler)
 	http.HandleFunc("/health", handler.HealthHandler)
 
 	server := &http.Server{
 		Addr: ":" + port,
 	}
+	server.RegisterOnShutdown(handler.Events.Close)
 
 	go func() {
 		log.Printf("Starting server on :%s", port)
@@ -0,0 +1,130 @@
+// Package atomicfile replaces files without ever leaving a truncated or
+// half-written copy behind.
+package atomicfile
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"syscall"
+)
+
+// WriteFile writes data to path. The data goes to a temporary file in the same
+// directory, which is synced and then renamed over path, so a crash or a full
+// disk leaves the old content in place. The existing mode and ownership are
+// kept; perm is used only when path does not exist yet.
+//
+// When path is a mount point, such as a single-file Docker bind mount, a
+// rename would detach the file from the mount. In that case the content is
+// rewritten in place instead, restoring the previous content on failure.
+func WriteFile(path string, data []byte, perm os.FileMode) error {
+	target := path
+	if resolved, err := filepath.EvalSymlinks(path); err == nil {
+		target = resolved
+	}
+	info, err := os.Stat(target)
+	switch {
+	case err == nil:
+		perm = info.Mode().Perm()
+		if IsMountPoint(target) {
+			return writeInPlace(target, data)
+		}
+	case !os.IsNotExist(err):
+		return err
+	}
+
+	err = replace(target, data, perm, info)
+	if info != nil && canFallBack(err) {
+		return writeInPlace(target, data)
+	}
+	return err
+}
+
+// canFallBack reports whether a failed replace can be retried in place: the
+// directory may not be writable, or the file may be a mount we did not detect.
+func canFallBack(err error) bool {
+	return errors.Is(err, syscall.EBUSY) || errors.Is(err, syscall.EXDEV) ||
+		errors.Is(err, os.ErrPermission) || errors.Is(err, syscall.EROFS)
+}
+
+// replace writes data to a temporary file and renames it over target.
+func replace(target string, data []byte, perm os.FileMode, info os.FileInfo) (err error) {
+	dir := filepath.Dir(target)
+	tmp, err := os.CreateTemp(dir, "."+filepath.Base(target)+".tmp-*")
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			tmp.Close()
+			os.Remove(tmp.Name())
+		}
+	}()
+
+	if _, err = tmp.Write(data); err != nil {
+		return err
+	}
+	if err = tmp.Chmod(perm); err != nil {
+		return err
+	}
+	if info != nil {
+		if err = chown(tmp, info); err != nil {
+			return err
+		}
+	}
+	if err = tmp.Sync(); err != nil {
+		return err
+	}
+	if err = tmp.Close(); err != nil {
+		return err
+	}
+	if err = os.Rename(tmp.Name(), target); err != nil {
+		return err
+	}
+	return syncDir(dir)
+}
+
+// writeInPlace overwrites target without replacing its inode. If writing
+// fails part way, the previous content is written back.
+func writeInPlace(target string, data []byte) error {
+	old, err := os.ReadFile(target)
+	if err != nil {
+		return err
+	}
+	f, err := os.OpenFile(target, os.O_WRONLY, 0)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	if err := overwrite(f, data); err != nil {
+		if restoreErr := overwrite(f, old); restoreErr != nil {
+			return errors.Join(err, restoreErr)
+		}
+		return err
+	}
+	return nil
+}
+
+func overwrite(f *os.File, data []byte) error {
+	if _, err := f.WriteAt(data, 0); err != nil {
+		return err
+	}
+	if err := f.Truncate(int64(len(data))); err != nil {
+		return err
+	}
+	return f.Sync()
+}
+
+// syncDir flushes a directory so a completed rename survives a crash.
+func syncDir(dir string) error {
+	d, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	defer d.Close()
+	if err := d.Sync(); err != nil && !errors.Is(err, syscall.EINVAL) {
+		return err
+	}
+	return nil
+}
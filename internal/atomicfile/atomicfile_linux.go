@@ -0,0 +1,82 @@
+package atomicfile
+
+import (
+	"bufio"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+)
+
+// chown gives f the owner and group recorded in info.
+func chown(f *os.File, info os.FileInfo) error {
+	st, ok := info.Sys().(*syscall.Stat_t)
+	if !ok {
+		return nil
+	}
+	if err := f.Chown(int(st.Uid), int(st.Gid)); err != nil && os.Geteuid() == 0 {
+		return err
+	}
+	// Unprivileged processes cannot give files away; the temporary file
+	// keeps our ownership, which matches the original in the common case.
+	return nil
+}
+
+// IsMountPoint reports whether path is itself a mount point, as is the case
+// for files bind-mounted into a container on their own.
+func IsMountPoint(path string) bool {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return false
+	}
+
+	// A different device than the parent directory is a sure sign.
+	var st, parent syscall.Stat_t
+	if syscall.Stat(abs, &st) == nil && syscall.Stat(filepath.Dir(abs), &parent) == nil && st.Dev != parent.Dev {
+		return true
+	}
+
+	// Bind mounts from the same filesystem share the device, so consult the
+	// mount table as well.
+	f, err := os.Open("/proc/self/mountinfo")
+	if err != nil {
+		return false
+	}
+	defer f.Close()
+	return inMountInfo(f, abs)
+}
+
+// inMountInfo reports whether abs is the mount point of an entry in r, which
+// is in the format of /proc/self/mountinfo.
+func inMountInfo(r io.Reader, abs string) bool {
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) > 4 && unescapeMountPath(fields[4]) == abs {
+			return true
+		}
+	}
+	return false
+}
+
+// unescapeMountPath decodes the octal escapes (such as \040 for a space) used
+// in /proc/self/mountinfo.
+func unescapeMountPath(s string) string {
+	if !strings.Contains(s, `\`) {
+		return s
+	}
+	var sb strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] == '\\' && i+3 < len(s) {
+			if n, err := strconv.ParseUint(s[i+1:i+4], 8, 8); err == nil {
+				sb.WriteByte(byte(n))
+				i += 3
+				continue
+			}
+		}
+		sb.WriteByte(s[i])
+	}
+	return sb.String()
+}
@@ -0,0 +1,119 @@
+package atomicfile
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"testing"
+)
+
+// mountInfo is a /proc/self/mountinfo excerpt from a podconfig container
+// with the podsync config bind-mounted on its own.
+const mountInfo = `1052 931 0:95 / / rw,relatime master:409 - overlay overlay rw,lowerdir=/var/lib/docker/overlay2/l/A:/var/lib/docker/overlay2/l/B,upperdir=/var/lib/docker/overlay2/C/diff,workdir=/var/lib/docker/overlay2/C/work
+1053 1052 0:98 / /proc rw,nosuid,nodev,noexec,relatime - proc proc rw
+1060 1052 8:1 /srv/podsync/config.toml /config/config.toml rw,relatime - ext4 /dev/sda1 rw
+1061 1052 8:1 /srv/podconfig/backups /backups rw,relatime - ext4 /dev/sda1 rw
+1062 1052 8:1 /srv/My\040Podcasts/config.toml /media/My\040Podcasts/config.toml rw,relatime - ext4 /dev/sda1 rw
+1063 1052 8:1 /srv/tab /media/tab\011name rw,relatime - ext4 /dev/sda1 rw
+1064 1052 8:1 /srv/back /media/back\134slash rw,relatime - ext4 /dev/sda1 rw
+`
+
+func TestInMountInfo(t *testing.T) {
+	tests := []struct {
+		path string
+		want bool
+	}{
+		{"/config/config.toml", true},
+		{"/backups", true},
+		{"/", true},
+		{"/media/My Podcasts/config.toml", true},
+		{"/media/tab\tname", true},
+		{`/media/back\slash`, true},
+		// The source path (field 4) is not where the mount is.
+		{"/srv/podsync/config.toml", false},
+		{"/config", false},
+		{"/config/config.toml.draft", false},
+		{`/media/My\040Podcasts/config.toml`, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			if got := inMountInfo(strings.NewReader(mountInfo), tt.path); got != tt.want {
+				t.Errorf("inMountInfo(%q) = %v, want %v", tt.path, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestInMountInfoShortLines(t *testing.T) {
+	if inMountInfo(strings.NewReader("\n1 2 3\n1 2 3 /\n"), "/") {
+		t.Error("matched a line without a mount point field")
+	}
+}
+
+func TestUnescapeMountPath(t *testing.T) {
+	tests := []struct {
+		in, want string
+	}{
+		{"/config/config.toml", "/config/config.toml"},
+		{`/media/My\040Podcasts`, "/media/My Podcasts"},
+		{`/a\011b\012c`, "/a\tb\nc"},
+		{`/back\134slash`, `/back\slash`},
+		{`\040leading`, " leading"},
+		{`/trailing\040`, "/trailing "},
+		// Not an escape: too short, not octal, or out of range.
+		{`/short\04`, `/short\04`},
+		{`/digits\089`, `/digits\089`},
+		{`/range\777`, `/range\777`},
+		{`/end\`, `/end\`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.in, func(t *testing.T) {
+			if got := unescapeMountPath(tt.in); got != tt.want {
+				t.Errorf("unescapeMountPath(%q) = %q, want %q", tt.in, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestIsMountPoint(t *testing.T) {
+	if !IsMountPoint("/") {
+		t.Error("IsMountPoint(/) = false")
+	}
+	path := filepath.Join(t.TempDir(), "config.toml")
+	if err := os.WriteFile(path, nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if IsMountPoint(path) {
+		t.Errorf("IsMountPoint(%s) = true for a plain file", path)
+	}
+}
+
+func TestWriteFileKeepsOwner(t *testing.T) {
+	if os.Geteuid() != 0 {
+		t.Skip("only root can give files to another owner")
+	}
+	dir := t.TempDir()
+	path := filepath.Join(dir, "config.toml")
+	if err := os.WriteFile(path, []byte("old\n"), 0640); err != nil {
+		t.Fatal(err)
+	}
+	const uid, gid = 1234, 5678
+	if err := os.Chown(path, uid, gid); err != nil {
+		t.Fatal(err)
+	}
+	if err := WriteFile(path, []byte("new\n"), 0644); err != nil {
+		t.Fatalf("WriteFile: %v", err)
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	st := info.Sys().(*syscall.Stat_t)
+	if st.Uid != uid || st.Gid != gid {
+		t.Errorf("owner = %d:%d, want %d:%d", st.Uid, st.Gid, uid, gid)
+	}
+	if info.Mode().Perm() != 0640 {
+		t.Errorf("mode = %v, want 0640", info.Mode().Perm())
+	}
+}
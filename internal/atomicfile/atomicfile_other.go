@@ -0,0 +1,16 @@
+//go:build !linux
+
+package atomicfile
+
+import "os"
+
+// chown is a no-op outside Linux, where podsync is deployed.
+func chown(f *os.File, info os.FileInfo) error {
+	return nil
+}
+
+// IsMountPoint always reports false outside Linux; a failed rename still
+// falls back to writing in place.
+func IsMountPoint(path string) bool {
+	return false
+}
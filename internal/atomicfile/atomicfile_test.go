@@ -0,0 +1,243 @@
+package atomicfile
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"testing"
+)
+
+// tempFiles lists the temporary files WriteFile may have left in dir.
+func tempFiles(t *testing.T, dir string) []string {
+	t.Helper()
+	matches, err := filepath.Glob(filepath.Join(dir, ".*.tmp-*"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return matches
+}
+
+func readFile(t *testing.T, path string) string {
+	t.Helper()
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(data)
+}
+
+func TestWriteFileCreates(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "config.toml")
+	if err := WriteFile(path, []byte("a = 1\n"), 0640); err != nil {
+		t.Fatalf("WriteFile: %v", err)
+	}
+	if got := readFile(t, path); got != "a = 1\n" {
+		t.Errorf("content = %q", got)
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The umask may clear bits of perm, but never add any.
+	if mode := info.Mode().Perm(); mode&^0640 != 0 {
+		t.Errorf("mode = %v, want at most 0640", mode)
+	}
+	if left := tempFiles(t, dir); len(left) > 0 {
+		t.Errorf("temporary files left behind: %v", left)
+	}
+}
+
+func TestWriteFileReplaces(t *testing.T) {
+	tests := []struct {
+		name string
+		mode os.FileMode
+	}{
+		{"private", 0600},
+		{"shared", 0664},
+		{"read-only", 0444},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			path := filepath.Join(dir, "config.toml")
+			if err := os.WriteFile(path, []byte("old content that is longer\n"), 0644); err != nil {
+				t.Fatal(err)
+			}
+			if err := os.Chmod(path, tt.mode); err != nil {
+				t.Fatal(err)
+			}
+			before, err := os.Stat(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			// perm only applies to new files.
+			if err := WriteFile(path, []byte("new\n"), 0777); err != nil {
+				t.Fatalf("WriteFile: %v", err)
+			}
+			if got := readFile(t, path); got != "new\n" {
+				t.Errorf("content = %q", got)
+			}
+			after, err := os.Stat(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if after.Mode().Perm() != tt.mode {
+				t.Errorf("mode = %v, want %v", after.Mode().Perm(), tt.mode)
+			}
+			if os.SameFile(before, after) {
+				t.Error("file was rewritten in place, want a rename over it")
+			}
+			if left := tempFiles(t, dir); len(left) > 0 {
+				t.Errorf("temporary files left behind: %v", left)
+			}
+		})
+	}
+}
+
+func TestWriteFileThroughSymlink(t *testing.T) {
+	dir := t.TempDir()
+	target := filepath.Join(dir, "real.toml")
+	link := filepath.Join(dir, "config.toml")
+	if err := os.WriteFile(target, []byte("old\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink(target, link); err != nil {
+		t.Fatal(err)
+	}
+	if err := WriteFile(link, []byte("new\n"), 0644); err != nil {
+		t.Fatalf("WriteFile: %v", err)
+	}
+	if info, err := os.Lstat(link); err != nil || info.Mode()&os.ModeSymlink == 0 {
+		t.Fatalf("symlink replaced: %v", err)
+	}
+	if got := readFile(t, target); got != "new\n" {
+		t.Errorf("target content = %q", got)
+	}
+}
+
+func TestReplaceCleansUpOnFailure(t *testing.T) {
+	dir := t.TempDir()
+	// Renaming a file over a non-empty directory fails after the temporary
+	// file has been written and synced.
+	target := filepath.Join(dir, "config.toml")
+	if err := os.MkdirAll(filepath.Join(target, "child"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := replace(target, []byte("new\n"), 0644, nil); err == nil {
+		t.Fatal("replace succeeded over a directory")
+	}
+	if left := tempFiles(t, dir); len(left) > 0 {
+		t.Errorf("temporary files left behind: %v", left)
+	}
+}
+
+func TestWriteInPlace(t *testing.T) {
+	tests := []struct {
+		name, old, new string
+	}{
+		{"shorter", "a much longer old content\n", "short\n"},
+		{"longer", "short\n", "a much longer new content\n"},
+		{"empty", "content\n", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			path := filepath.Join(dir, "config.toml")
+			if err := os.WriteFile(path, []byte(tt.old), 0600); err != nil {
+				t.Fatal(err)
+			}
+			before, err := os.Stat(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := writeInPlace(path, []byte(tt.new)); err != nil {
+				t.Fatalf("writeInPlace: %v", err)
+			}
+			if got := readFile(t, path); got != tt.new {
+				t.Errorf("content = %q, want %q", got, tt.new)
+			}
+			after, err := os.Stat(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !os.SameFile(before, after) {
+				t.Error("file was replaced, want it rewritten in place")
+			}
+			if after.Mode().Perm() != 0600 {
+				t.Errorf("mode = %v, want 0600", after.Mode().Perm())
+			}
+		})
+	}
+}
+
+func TestWriteFileFallsBackInPlace(t *testing.T) {
+	if os.Geteuid() == 0 {
+		t.Skip("root can write to read-only directories")
+	}
+	dir := t.TempDir()
+	path := filepath.Join(dir, "config.toml")
+	if err := os.WriteFile(path, []byte("old\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	before, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The temporary file cannot be created next to the config, as when only
+	// the file itself is writable.
+	if err := os.Chmod(dir, 0555); err != nil {
+		t.Fatal(err)
+	}
+	defer os.Chmod(dir, 0755)
+
+	if err := WriteFile(path, []byte("new\n"), 0644); err != nil {
+		t.Fatalf("WriteFile: %v", err)
+	}
+	if got := readFile(t, path); got != "new\n" {
+		t.Errorf("content = %q", got)
+	}
+	after, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !os.SameFile(before, after) {
+		t.Error("file was replaced, want it rewritten in place")
+	}
+}
+
+func TestWriteFileMissingDirectory(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "missing", "config.toml")
+	if err := WriteFile(path, []byte("a = 1\n"), 0644); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("WriteFile error = %v, want a missing directory", err)
+	}
+}
+
+func TestCanFallBack(t *testing.T) {
+	tests := []struct {
+		err  error
+		want bool
+	}{
+		{&os.LinkError{Op: "rename", Err: syscall.EBUSY}, true},
+		{&os.LinkError{Op: "rename", Err: syscall.EXDEV}, true},
+		{&os.PathError{Op: "open", Err: syscall.EACCES}, true},
+		{&os.PathError{Op: "open", Err: syscall.EROFS}, true},
+		{&os.PathError{Op: "write", Err: syscall.ENOSPC}, false},
+		{&os.PathError{Op: "open", Err: syscall.ENOENT}, false},
+		{nil, false},
+	}
+	for _, tt := range tests {
+		name := "nil"
+		if tt.err != nil {
+			name = strings.ReplaceAll(tt.err.Error(), " ", "_")
+		}
+		t.Run(name, func(t *testing.T) {
+			if got := canFallBack(tt.err); got != tt.want {
+				t.Errorf("canFallBack(%v) = %v, want %v", tt.err, got, tt.want)
+			}
+		})
+	}
+}
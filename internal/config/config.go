@@ -3,7 +3,9 @@ package config
 import (
 	"log"
 	"os"
+	"path/filepath"
 	"strconv"
+	"time"
 )
 
 // AppConfig holds environment-based configuration for the app.
@@ -11,6 +13,38 @@ type AppConfig struct {
 	PodsyncConfigPath   string
 	DockerContainerName string
 	ServerPort          string
+
+	// BackupDir holds timestamped copies of the podsync config.
+	BackupDir string
+	// BackupKeep is the maximum number of backups kept (0 for no limit).
+	BackupKeep int
+	// BackupMaxAge is how long backups are kept (0 for no limit).
+	BackupMaxAge time.Duration
+
+	// GitHistory commits every config change to a git repository.
+	GitHistory bool
+	// HistoryDir holds the history repository; the config's own directory
+	// if empty.
+	HistoryDir string
+
+	// JournalPath stores the changes podsync has not been reloaded with yet.
+	JournalPath string
+	// SnapshotPath stores the config podsync was last reloaded with.
+	SnapshotPath string
+	// DraftDir holds the staged draft of the config.
+	DraftDir string
+
+	// LockPath is the lock file writers of the config take turns on.
+	LockPath string
+	// LockTimeout is how long a write waits for the config's lock file.
+	LockTimeout time.Duration
+
+	// UploadFeedURL is the RSS endpoint filter previews fetch a channel's
+	// recent uploads from; the server's default (YouTube) if empty.
+	UploadFeedURL string
+	// ChannelSiteURL is the site filter previews look channel pages up on;
+	// the server's default (YouTube) if empty.
+	ChannelSiteURL string
 }
 
 // LoadConfig loads configuration from environment variables, falling back to defaults.
@@ -20,6 +54,17 @@ func LoadConfig() *AppConfig {
 		PodsyncConfigPath:   os.Getenv("PODSYNC_CONFIG_PATH"),
 		DockerContainerName: os.Getenv("DOCKER_CONTAINER_NAME"),
 		ServerPort:          os.Getenv("SERVER_PORT"),
+		BackupDir:           os.Getenv("BACKUP_DIR"),
+		HistoryDir:          os.Getenv("HISTORY_DIR"),
+		JournalPath:         os.Getenv("JOURNAL_PATH"),
+		SnapshotPath:        os.Getenv("SNAPSHOT_PATH"),
+		DraftDir:            os.Getenv("DRAFT_DIR"),
+		LockPath:            os.Getenv("LOCK_PATH"),
+		UploadFeedURL:       os.Getenv("YOUTUBE_FEED_URL"),
+		ChannelSiteURL:      os.Getenv("YOUTUBE_SITE_URL"),
+		BackupKeep:          50,
+		BackupMaxAge:        30 * 24 * time.Hour,
+		LockTimeout:         10 * time.Second,
 	}
 
 	if cfg.PodsyncConfigPath == "" {
@@ -31,12 +76,57 @@ func LoadConfig() *AppConfig {
 	if cfg.ServerPort == "" {
 		cfg.ServerPort = "8080"
 	}
+	if cfg.BackupDir == "" {
+		cfg.BackupDir = filepath.Join(filepath.Dir(cfg.PodsyncConfigPath), "backups")
+	}
+	if cfg.JournalPath == "" {
+		cfg.JournalPath = filepath.Join(filepath.Dir(cfg.PodsyncConfigPath), "podconfig-journal.json")
+	}
+	if cfg.SnapshotPath == "" {
+		cfg.SnapshotPath = filepath.Join(filepath.Dir(cfg.PodsyncConfigPath), "podconfig-applied.toml")
+	}
+	if cfg.DraftDir == "" {
+		cfg.DraftDir = filepath.Dir(cfg.PodsyncConfigPath)
+	}
+	if cfg.LockPath == "" {
+		cfg.LockPath = cfg.PodsyncConfigPath + ".lock"
+	}
 
 	portNum, err := strconv.Atoi(cfg.ServerPort)
 	if err != nil || portNum < 1 || portNum > 65535 {
 		log.Fatalf("Invalid SERVER_PORT: %s", cfg.ServerPort)
 	}
 
+	if val := os.Getenv("BACKUP_KEEP"); val != "" {
+		keep, err := strconv.Atoi(val)
+		if err != nil || keep < 0 {
+			log.Fatalf("Invalid BACKUP_KEEP: %s", val)
+		}
+		cfg.BackupKeep = keep
+	}
+	if val := os.Getenv("BACKUP_MAX_AGE"); val != "" {
+		maxAge, err := time.ParseDuration(val)
+		if err != nil || maxAge < 0 {
+			log.Fatalf("Invalid BACKUP_MAX_AGE: %s", val)
+		}
+		cfg.BackupMaxAge = maxAge
+	}
+
+	if val := os.Getenv("GIT_HISTORY"); val != "" {
+		enabled, err := strconv.ParseBool(val)
+		if err != nil {
+			log.Fatalf("Invalid GIT_HISTORY: %s", val)
+		}
+		cfg.GitHistory = enabled
+	}
+	if val := os.Getenv("LOCK_TIMEOUT"); val != "" {
+		timeout, err := time.ParseDuration(val)
+		if err != nil || timeout < 0 {
+			log.Fatalf("Invalid LOCK_TIMEOUT: %s", val)
+		}
+		cfg.LockTimeout = timeout
+	}
+
 	if _, err := os.Stat(cfg.PodsyncConfigPath); err != nil {
 		log.Printf("WARNING: No podsync config file found at %s (error: %v)",
 			cfg.PodsyncConfigPath, err)
@@ -0,0 +1,57 @@
+// Package filelock provides advisory locks shared between processes, so that
+// several podconfig instances or scripts editing the same file take turns.
+package filelock
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"time"
+)
+
+// ErrTimeout is returned when a lock is still held by another process after
+// the timeout has passed.
+var ErrTimeout = errors.New("timed out waiting for lock")
+
+// pollInterval is how often a held lock is retried.
+const pollInterval = 50 * time.Millisecond
+
+// Lock is an exclusive advisory lock on a lock file.
+type Lock struct {
+	f *os.File
+}
+
+// Acquire takes an exclusive lock on path, creating the file if needed. It
+// waits up to timeout for another holder to release it; a timeout of 0 tries
+// once. The lock file itself is left in place when released.
+func Acquire(path string, timeout time.Duration) (*Lock, error) {
+	f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		return nil, fmt.Errorf("opening lock file: %w", err)
+	}
+	deadline := time.Now().Add(timeout)
+	for {
+		locked, err := tryLock(f)
+		if err != nil {
+			f.Close()
+			return nil, fmt.Errorf("locking %s: %w", path, err)
+		}
+		if locked {
+			return &Lock{f: f}, nil
+		}
+		if !time.Now().Before(deadline) {
+			f.Close()
+			return nil, fmt.Errorf("%w %s after %s; another process is editing the config", ErrTimeout, path, timeout)
+		}
+		time.Sleep(pollInterval)
+	}
+}
+
+// Release unlocks and closes the lock file.
+func (l *Lock) Release() error {
+	err := unlock(l.f)
+	if cerr := l.f.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
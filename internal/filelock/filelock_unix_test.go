@@ -0,0 +1,74 @@
+//go:build unix
+
+package filelock
+
+import (
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestAcquireTimesOutWhileHeld(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.toml.lock")
+	first, err := Acquire(path, 0)
+	if err != nil {
+		t.Fatalf("first Acquire: %v", err)
+	}
+	defer first.Release()
+
+	const timeout = 150 * time.Millisecond
+	start := time.Now()
+	second, err := Acquire(path, timeout)
+	if err == nil {
+		second.Release()
+		t.Fatal("second Acquire succeeded while the lock was held")
+	}
+	if !errors.Is(err, ErrTimeout) {
+		t.Fatalf("second Acquire error = %v, want ErrTimeout", err)
+	}
+	if waited := time.Since(start); waited < timeout {
+		t.Errorf("second Acquire gave up after %s, want at least %s", waited, timeout)
+	}
+}
+
+func TestAcquireWaitsForRelease(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.toml.lock")
+	first, err := Acquire(path, 0)
+	if err != nil {
+		t.Fatalf("first Acquire: %v", err)
+	}
+	released := make(chan error, 1)
+	go func() {
+		time.Sleep(100 * time.Millisecond)
+		released <- first.Release()
+	}()
+
+	second, err := Acquire(path, 5*time.Second)
+	if err != nil {
+		t.Fatalf("second Acquire: %v", err)
+	}
+	if err := <-released; err != nil {
+		t.Fatalf("Release: %v", err)
+	}
+	if err := second.Release(); err != nil {
+		t.Fatalf("Release: %v", err)
+	}
+}
+
+func TestAcquireZeroTimeoutTriesOnce(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.toml.lock")
+	first, err := Acquire(path, 0)
+	if err != nil {
+		t.Fatalf("first Acquire: %v", err)
+	}
+	defer first.Release()
+
+	start := time.Now()
+	if _, err := Acquire(path, 0); !errors.Is(err, ErrTimeout) {
+		t.Fatalf("second Acquire error = %v, want ErrTimeout", err)
+	}
+	if waited := time.Since(start); waited >= pollInterval {
+		t.Errorf("second Acquire waited %s with a zero timeout", waited)
+	}
+}
@@ -0,0 +1,43 @@
+package podsync
+
+// Category is an Apple Podcasts category and the subcategories that may be
+// listed under it.
+type Category struct {
+	Name          string   `json:"name"`
+	Subcategories []string `json:"subcategories"`
+}
+
+// Categories is Apple's podcast category taxonomy. Podsync lists
+// custom.subcategories under custom.category, so each subcategory must belong
+// to that category.
+var Categories = []Category{
+	{"Arts", []string{"Books", "Design", "Fashion & Beauty", "Food", "Performing Arts", "Visual Arts"}},
+	{"Business", []string{"Careers", "Entrepreneurship", "Investing", "Management", "Marketing", "Non-Profit"}},
+	{"Comedy", []string{"Comedy Interviews", "Improv", "Stand-Up"}},
+	{"Education", []string{"Courses", "How To", "Language Learning", "Self-Improvement"}},
+	{"Fiction", []string{"Comedy Fiction", "Drama", "Science Fiction"}},
+	{"Government", []string{}},
+	{"Health & Fitness", []string{"Alternative Health", "Fitness", "Medicine", "Mental Health", "Nutrition", "Sexuality"}},
+	{"History", []string{}},
+	{"Kids & Family", []string{"Education for Kids", "Parenting", "Pets & Animals", "Stories for Kids"}},
+	{"Leisure", []string{"Animation & Manga", "Automotive", "Aviation", "Crafts", "Games", "Hobbies", "Home & Garden", "Video Games"}},
+	{"Music", []string{"Music Commentary", "Music History", "Music Interviews"}},
+	{"News", []string{"Business News", "Daily News", "Entertainment News", "News Commentary", "Politics", "Sports News", "Tech News"}},
+	{"Religion & Spirituality", []string{"Buddhism", "Christianity", "Hinduism", "Islam", "Judaism", "Religion", "Spirituality"}},
+	{"Science", []string{"Astronomy", "Chemistry", "Earth Sciences", "Life Sciences", "Mathematics", "Natural Sciences", "Nature", "Physics", "Social Sciences"}},
+	{"Society & Culture", []string{"Documentary", "Personal Journals", "Philosophy", "Places & Travel", "Relationships"}},
+	{"Sports", []string{"Baseball", "Basketball", "Cricket", "Fantasy Sports", "Football", "Golf", "Hockey", "Rugby", "Running", "Soccer", "Swimming", "Tennis", "Volleyball", "Wilderness", "Wrestling"}},
+	{"TV & Film", []string{"After Shows", "Film History", "Film Interviews", "Film Reviews", "TV Reviews"}},
+	{"Technology", []string{}},
+	{"True Crime", []string{}},
+}
+
+// FindCategory returns the named category, if it is in the taxonomy.
+func FindCategory(name string) (Category, bool) {
+	for _, c := range Categories {
+		if c.Name == name {
+			return c, true
+		}
+	}
+	return Category{}, false
+}
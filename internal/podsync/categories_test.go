@@ -0,0 +1,71 @@
+package podsync
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestCategories(t *testing.T) {
+	seen := map[string]bool{}
+	for _, c := range Categories {
+		if seen[c.Name] {
+			t.Errorf("category %q listed twice", c.Name)
+		}
+		seen[c.Name] = true
+		if c.Subcategories == nil {
+			t.Errorf("category %q has nil subcategories, which encode as null", c.Name)
+		}
+		subs := map[string]bool{}
+		for _, s := range c.Subcategories {
+			if subs[s] {
+				t.Errorf("subcategory %q listed twice under %q", s, c.Name)
+			}
+			subs[s] = true
+		}
+	}
+}
+
+func TestFindCategory(t *testing.T) {
+	tests := []struct {
+		name string
+		ok   bool
+	}{
+		{"News", true},
+		{"Society & Culture", true},
+		{"news", false},
+		{"Daily News", false},
+		{"", false},
+	}
+	for _, tt := range tests {
+		if c, ok := FindCategory(tt.name); ok != tt.ok || (ok && c.Name != tt.name) {
+			t.Errorf("FindCategory(%q) = %v, %v; want ok: %v", tt.name, c, ok, tt.ok)
+		}
+	}
+}
+
+func TestCheckMetadataCategory(t *testing.T) {
+	tests := []struct {
+		name          string
+		category      string
+		subcategories []string
+		want          []string
+	}{
+		{"none", "", nil, nil},
+		{"category only", "Technology", nil, nil},
+		{"category and subcategories", "News", []string{"Daily News", "Politics"}, nil},
+		{"unknown category", "Tech", nil, []string{"feeds.news.custom.category"}},
+		{"wrong case", "news", nil, []string{"feeds.news.custom.category"}},
+		{"subcategory of another category", "News", []string{"Daily News", "Comedy Interviews"}, []string{"feeds.news.custom.subcategories"}},
+		{"subcategory of a category without any", "History", []string{"Daily News"}, []string{"feeds.news.custom.subcategories"}},
+		{"subcategories without a category", "", []string{"Daily News"}, []string{"feeds.news.custom.subcategories"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := validConfig()
+			cfg.Feeds["news"].Custom = Custom{Category: tt.category, Subcategories: tt.subcategories}
+			if got := problemPaths(t, CheckMetadata(cfg)); !slices.Equal(got, tt.want) {
+				t.Errorf("problems at %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
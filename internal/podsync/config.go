@@ -0,0 +1,145 @@
+// Package podsync models podsync's config.toml.
+//
+// The model is read from and written back to a tomledit.Document: only the
+// settings that differ between two models are rewritten, so keys the model
+// does not know about, comments and layout all survive unchanged.
+package podsync
+
+// Config is the whole podsync configuration.
+type Config struct {
+	Server     Server           `toml:"server"`
+	Storage    Storage          `toml:"storage"`
+	Tokens     Tokens           `toml:"-"`
+	Downloader Downloader       `toml:"downloader"`
+	Database   Database         `toml:"database"`
+	Log        Log              `toml:"log"`
+	Feeds      map[string]*Feed `toml:"feeds"`
+}
+
+// Server configures podsync's web server.
+type Server struct {
+	Port            int    `toml:"port"`
+	Hostname        string `toml:"hostname"`
+	BindAddress     string `toml:"bind_address"`
+	Path            string `toml:"path"`
+	TLS             bool   `toml:"tls"`
+	CertificatePath string `toml:"certificate_path"`
+	KeyFilePath     string `toml:"key_file_path"`
+	WebUI           bool   `toml:"web_ui"`
+	// DataDir is deprecated in favour of storage.local.data_dir.
+	DataDir string `toml:"data_dir"`
+}
+
+// Storage selects where episodes are stored.
+type Storage struct {
+	Type  string       `toml:"type"`
+	Local LocalStorage `toml:"local"`
+	S3    S3Storage    `toml:"s3"`
+}
+
+// LocalStorage stores episodes on disk.
+type LocalStorage struct {
+	DataDir string `toml:"data_dir"`
+}
+
+// S3Storage stores episodes in an S3 compatible bucket.
+type S3Storage struct {
+	EndpointURL string `toml:"endpoint_url"`
+	Region      string `toml:"region"`
+	Bucket      string `toml:"bucket"`
+	Prefix      string `toml:"prefix"`
+}
+
+// Tokens maps a provider (youtube, vimeo, soundcloud, twitch) to its API
+// keys. Podsync rotates through the keys when a provider has several.
+type Tokens map[string][]string
+
+// Downloader configures youtube-dl / yt-dlp.
+type Downloader struct {
+	SelfUpdate bool `toml:"self_update"`
+	// Timeout is in minutes.
+	Timeout      int    `toml:"timeout"`
+	CustomBinary string `toml:"custom_binary"`
+}
+
+// Database configures podsync's metadata store.
+type Database struct {
+	Dir    string `toml:"dir"`
+	Badger Badger `toml:"badger"`
+}
+
+// Badger holds BadgerDB specific options.
+type Badger struct {
+	Truncate bool `toml:"truncate"`
+	FileIO   bool `toml:"file_io"`
+}
+
+// Log configures podsync's log file.
+type Log struct {
+	Filename   string `toml:"filename"`
+	MaxSize    int    `toml:"max_size"`
+	MaxBackups int    `toml:"max_backups"`
+	MaxAge     int    `toml:"max_age"`
+	Compress   bool   `toml:"compress"`
+	Debug      bool   `toml:"debug"`
+}
+
+// Feed is a single podcast feed.
+type Feed struct {
+	URL           string       `toml:"url"`
+	PageSize      int          `toml:"page_size"`
+	UpdatePeriod  string       `toml:"update_period"`
+	CronSchedule  string       `toml:"cron_schedule"`
+	Quality       string       `toml:"quality"`
+	Format        string       `toml:"format"`
+	CustomFormat  CustomFormat `toml:"custom_format"`
+	MaxHeight     int          `toml:"max_height"`
+	PlaylistSort  string       `toml:"playlist_sort"`
+	OPML          bool         `toml:"opml"`
+	PrivateFeed   bool         `toml:"private_feed"`
+	YouTubeDLArgs []string     `toml:"youtube_dl_args"`
+	Filters       Filters      `toml:"filters"`
+	Clean         Clean        `toml:"clean"`
+	Custom        Custom       `toml:"custom"`
+}
+
+// CustomFormat is used when a feed's format is "custom".
+type CustomFormat struct {
+	YouTubeDLFormat string `toml:"youtube_dl_format"`
+	Extension       string `toml:"extension"`
+}
+
+// Filters decide which episodes are downloaded.
+type Filters struct {
+	Title          string `toml:"title"`
+	NotTitle       string `toml:"not_title"`
+	Description    string `toml:"description"`
+	NotDescription string `toml:"not_description"`
+	// MinDuration and MaxDuration are in seconds.
+	MinDuration int64 `toml:"min_duration"`
+	MaxDuration int64 `toml:"max_duration"`
+	// MaxAge and MinAge are in days.
+	MaxAge int `toml:"max_age"`
+	MinAge int `toml:"min_age"`
+}
+
+// Clean configures removal of old episodes.
+type Clean struct {
+	KeepLast int `toml:"keep_last"`
+}
+
+// Custom overrides the podcast metadata.
+type Custom struct {
+	Title           string   `toml:"title"`
+	Description     string   `toml:"description"`
+	Author          string   `toml:"author"`
+	CoverArt        string   `toml:"cover_art"`
+	CoverArtQuality string   `toml:"cover_art_quality"`
+	Category        string   `toml:"category"`
+	Subcategories   []string `toml:"subcategories"`
+	Explicit        bool     `toml:"explicit"`
+	Lang            string   `toml:"lang"`
+	Link            string   `toml:"link"`
+	OwnerName       string   `toml:"ownerName"`
+	OwnerEmail      string   `toml:"ownerEmail"`
+}
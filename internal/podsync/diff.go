@@ -0,0 +1,137 @@
+package podsync
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+// Change is a single setting that differs between two configurations.
+type Change struct {
+	Path   string `json:"path"`
+	Before string `json:"before"`
+	After  string `json:"after"`
+}
+
+func (c Change) String() string {
+	return fmt.Sprintf("%s: %s → %s", c.Path, c.Before, c.After)
+}
+
+// unsetValue stands in for a setting that is not present.
+const unsetValue = "(unset)"
+
+// Diff lists the settings that differ between before and after, which must be
+// of the same type, with paths below prefix. Nil pointers compare as empty
+// values. Settings excluded from TOML, such as tokens, are not compared.
+func Diff(prefix []string, before, after interface{}) []Change {
+	var changes []Change
+	diffValues(&changes, prefix, reflect.ValueOf(before), reflect.ValueOf(after))
+	return changes
+}
+
+func diffValues(changes *[]Change, path []string, before, after reflect.Value) {
+	before, after = deref(before), deref(after)
+	if !before.IsValid() && !after.IsValid() {
+		return
+	}
+	var t reflect.Type
+	if after.IsValid() {
+		t = after.Type()
+	} else {
+		t = before.Type()
+	}
+	if !before.IsValid() {
+		before = reflect.Zero(t)
+	}
+	if !after.IsValid() {
+		after = reflect.Zero(t)
+	}
+
+	switch t.Kind() {
+	case reflect.Struct:
+		for i := 0; i < t.NumField(); i++ {
+			if key := tomlKey(t.Field(i)); key != "" {
+				diffValues(changes, appendPath(path, key), before.Field(i), after.Field(i))
+			}
+		}
+		return
+	case reflect.Map:
+		keys := map[string]bool{}
+		for _, k := range before.MapKeys() {
+			keys[k.String()] = true
+		}
+		for _, k := range after.MapKeys() {
+			keys[k.String()] = true
+		}
+		sorted := make([]string, 0, len(keys))
+		for k := range keys {
+			sorted = append(sorted, k)
+		}
+		sort.Strings(sorted)
+		for _, k := range sorted {
+			kv := reflect.ValueOf(k).Convert(t.Key())
+			diffValues(changes, appendPath(path, k), before.MapIndex(kv), after.MapIndex(kv))
+		}
+		return
+	}
+
+	b, a := formatSetting(before), formatSetting(after)
+	if b != a {
+		*changes = append(*changes, Change{Path: KeyPath(path...), Before: b, After: a})
+	}
+}
+
+// deref follows pointers and interfaces, returning the zero Value for nil.
+func deref(v reflect.Value) reflect.Value {
+	for v.IsValid() && (v.Kind() == reflect.Ptr || v.Kind() == reflect.Interface) {
+		if v.IsNil() {
+			return reflect.Value{}
+		}
+		v = v.Elem()
+	}
+	return v
+}
+
+// formatSetting renders a single setting for display.
+func formatSetting(v reflect.Value) string {
+	if v.IsZero() || (v.Kind() == reflect.Slice && v.Len() == 0) {
+		return unsetValue
+	}
+	if v.Kind() == reflect.Slice {
+		parts := make([]string, v.Len())
+		for i := range parts {
+			parts[i] = fmt.Sprint(v.Index(i).Interface())
+		}
+		return "[" + strings.Join(parts, ", ") + "]"
+	}
+	return fmt.Sprint(v.Interface())
+}
+
+// DiffConfig lists the settings that differ between two configurations.
+// Tokens are compared too, but only the number of keys is shown.
+func DiffConfig(before, after *Config) []Change {
+	changes := Diff(nil, before, after)
+	for _, provider := range unionKeys(before.Tokens, after.Tokens) {
+		b, a := before.Tokens[provider], after.Tokens[provider]
+		if reflect.DeepEqual(b, a) {
+			continue
+		}
+		changes = append(changes, Change{
+			Path:   KeyPath("tokens", provider),
+			Before: countKeys(len(b)),
+			After:  countKeys(len(a)),
+		})
+	}
+	return changes
+}
+
+func countKeys(n int) string {
+	switch n {
+	case 0:
+		return unsetValue
+	case 1:
+		return "1 key"
+	}
+	return fmt.Sprintf("%d keys", n)
+}
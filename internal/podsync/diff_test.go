@@ -0,0 +1,68 @@
+package podsync
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestDiff(t *testing.T) {
+	feed := &Feed{URL: "https://youtube.com/@news", PageSize: 10, Filters: Filters{Title: "daily"}}
+	tests := []struct {
+		name          string
+		before, after *Feed
+		want          []string
+	}{
+		{"unchanged", feed, feed, nil},
+		{"both nil", nil, nil, nil},
+		{"added", nil, feed, []string{
+			"feeds.news.url: (unset) → https://youtube.com/@news",
+			"feeds.news.page_size: (unset) → 10",
+			"feeds.news.filters.title: (unset) → daily",
+		}},
+		{"removed", feed, nil, []string{
+			"feeds.news.url: https://youtube.com/@news → (unset)",
+			"feeds.news.page_size: 10 → (unset)",
+			"feeds.news.filters.title: daily → (unset)",
+		}},
+		{"modified", feed, &Feed{URL: feed.URL, PageSize: 20, Custom: Custom{Subcategories: []string{"Daily News"}}}, []string{
+			"feeds.news.page_size: 10 → 20",
+			"feeds.news.filters.title: daily → (unset)",
+			"feeds.news.custom.subcategories: (unset) → [Daily News]",
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got []string
+			for _, c := range Diff([]string{"feeds", "news"}, tt.before, tt.after) {
+				got = append(got, c.String())
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("Diff = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDiffConfig(t *testing.T) {
+	before := validConfig()
+	before.Tokens = Tokens{"youtube": {"key1"}, "vimeo": {"key2"}}
+	after := validConfig()
+	after.Tokens = Tokens{"youtube": {"key1", "key3"}}
+	delete(after.Feeds, "news")
+	after.Feeds["talks"] = &Feed{URL: "https://youtube.com/@talks"}
+
+	var got []string
+	for _, c := range DiffConfig(before, after) {
+		got = append(got, c.String())
+	}
+	want := []string{
+		"feeds.news.url: https://www.youtube.com/channel/UCexample → (unset)",
+		"feeds.news.update_period: 12h → (unset)",
+		"feeds.talks.url: (unset) → https://youtube.com/@talks",
+		"tokens.vimeo: 1 key → (unset)",
+		"tokens.youtube: 1 key → 2 keys",
+	}
+	if !slices.Equal(got, want) {
+		t.Errorf("DiffConfig =\n%q\nwant\n%q", got, want)
+	}
+}
@@ -0,0 +1,225 @@
+package podsync
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/Takenobou/podconfig/internal/tomledit"
+)
+
+// Load decodes the typed configuration from doc. Values of the wrong type are
+// reported as errors rather than skipped.
+func Load(doc *tomledit.Document) (*Config, error) {
+	cfg := &Config{}
+	if err := doc.Decode(cfg); err != nil {
+		return nil, err
+	}
+	if cfg.Feeds == nil {
+		cfg.Feeds = map[string]*Feed{}
+	}
+	for key, feed := range cfg.Feeds {
+		if feed == nil {
+			cfg.Feeds[key] = &Feed{}
+		}
+	}
+
+	// Tokens may be a single string or an array of strings.
+	var raw struct {
+		Tokens map[string]interface{} `toml:"tokens"`
+	}
+	if err := doc.Decode(&raw); err != nil {
+		return nil, err
+	}
+	cfg.Tokens = Tokens{}
+	for provider, v := range raw.Tokens {
+		switch t := v.(type) {
+		case string:
+			cfg.Tokens[provider] = []string{t}
+		case []interface{}:
+			keys := make([]string, 0, len(t))
+			for _, k := range t {
+				s, ok := k.(string)
+				if !ok {
+					return nil, fmt.Errorf("tokens.%s: keys must be strings", provider)
+				}
+				keys = append(keys, s)
+			}
+			cfg.Tokens[provider] = keys
+		default:
+			return nil, fmt.Errorf("tokens.%s: must be a string or an array of strings", provider)
+		}
+	}
+	return cfg, nil
+}
+
+// Save writes every setting that differs between before and after to doc.
+// Settings that became empty are removed; everything else is left as is.
+func Save(doc *tomledit.Document, before, after *Config) error {
+	if err := apply(doc, nil, reflect.ValueOf(*before), reflect.ValueOf(*after)); err != nil {
+		return err
+	}
+	return saveTokens(doc, before.Tokens, after.Tokens)
+}
+
+func saveTokens(doc *tomledit.Document, before, after Tokens) error {
+	for _, provider := range unionKeys(before, after) {
+		path := []string{"tokens", provider}
+		keys := after[provider]
+		if reflect.DeepEqual(before[provider], keys) {
+			continue
+		}
+		var err error
+		switch len(keys) {
+		case 0:
+			_, err = doc.Delete(path)
+		case 1:
+			err = doc.Set(path, keys[0])
+		default:
+			err = doc.Set(path, keys)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// apply writes the differences between two values of the same type below path.
+func apply(doc *tomledit.Document, path []string, before, after reflect.Value) error {
+	switch after.Kind() {
+	case reflect.Struct:
+		t := after.Type()
+		for i := 0; i < t.NumField(); i++ {
+			key := tomlKey(t.Field(i))
+			if key == "" {
+				continue
+			}
+			if err := apply(doc, appendPath(path, key), before.Field(i), after.Field(i)); err != nil {
+				return err
+			}
+		}
+		return nil
+	case reflect.Map:
+		keys := map[string]bool{}
+		for _, k := range before.MapKeys() {
+			keys[k.String()] = true
+		}
+		for _, k := range after.MapKeys() {
+			keys[k.String()] = true
+		}
+		sorted := make([]string, 0, len(keys))
+		for k := range keys {
+			sorted = append(sorted, k)
+		}
+		sort.Strings(sorted)
+		for _, k := range sorted {
+			kv := reflect.ValueOf(k)
+			b, a := before.MapIndex(kv), after.MapIndex(kv)
+			keyPath := appendPath(path, k)
+			switch {
+			case !a.IsValid() || (a.Kind() == reflect.Ptr && a.IsNil()):
+				if _, err := doc.Delete(keyPath); err != nil {
+					return err
+				}
+			case !b.IsValid() || (b.Kind() == reflect.Ptr && b.IsNil()):
+				if err := doc.Set(keyPath, toTable(a)); err != nil {
+					return err
+				}
+			default:
+				if err := apply(doc, keyPath, b, a); err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	case reflect.Ptr:
+		return apply(doc, path, before.Elem(), after.Elem())
+	}
+
+	if reflect.DeepEqual(before.Interface(), after.Interface()) {
+		return nil
+	}
+	if after.IsZero() || (after.Kind() == reflect.Slice && after.Len() == 0) {
+		_, err := doc.Delete(path)
+		return err
+	}
+	return doc.Set(path, after.Interface())
+}
+
+// toTable converts a struct into an ordered table, leaving out empty settings.
+func toTable(v reflect.Value) tomledit.Table {
+	for v.Kind() == reflect.Ptr {
+		v = v.Elem()
+	}
+	var table tomledit.Table
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		key := tomlKey(t.Field(i))
+		f := v.Field(i)
+		if key == "" || f.IsZero() || (f.Kind() == reflect.Slice && f.Len() == 0) {
+			continue
+		}
+		if f.Kind() == reflect.Struct {
+			table = append(table, tomledit.KeyValue{Key: key, Value: toTable(f)})
+			continue
+		}
+		table = append(table, tomledit.KeyValue{Key: key, Value: f.Interface()})
+	}
+	return table
+}
+
+// Settings returns the settings of a section, such as a Server, keyed by their
+// TOML names. Nested tables become nested maps.
+func Settings(section interface{}) map[string]interface{} {
+	v := reflect.ValueOf(section)
+	for v.Kind() == reflect.Ptr {
+		v = v.Elem()
+	}
+	settings := map[string]interface{}{}
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		key := tomlKey(t.Field(i))
+		if key == "" {
+			continue
+		}
+		if f := v.Field(i); f.Kind() == reflect.Struct {
+			settings[key] = Settings(f.Interface())
+		} else {
+			settings[key] = f.Interface()
+		}
+	}
+	return settings
+}
+
+func tomlKey(f reflect.StructField) string {
+	tag, _, _ := strings.Cut(f.Tag.Get("toml"), ",")
+	if tag == "-" || !f.IsExported() {
+		return ""
+	}
+	if tag == "" {
+		return f.Name
+	}
+	return tag
+}
+
+func appendPath(path []string, key string) []string {
+	return append(append([]string{}, path...), key)
+}
+
+func unionKeys(a, b Tokens) []string {
+	keys := map[string]bool{}
+	for k := range a {
+		keys[k] = true
+	}
+	for k := range b {
+		keys[k] = true
+	}
+	out := make([]string, 0, len(keys))
+	for k := range keys {
+		out = append(out, k)
+	}
+	sort.Strings(out)
+	return out
+}
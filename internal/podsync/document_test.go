@@ -0,0 +1,206 @@
+package podsync
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/Takenobou/podconfig/internal/tomledit"
+)
+
+// parse parses src, failing the test if it is not valid TOML.
+func parse(t *testing.T, src string) *tomledit.Document {
+	t.Helper()
+	doc, err := tomledit.Parse([]byte(src))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return doc
+}
+
+func TestLoad(t *testing.T) {
+	tests := []struct {
+		name    string
+		src     string
+		check   func(t *testing.T, cfg *Config)
+		wantErr string
+	}{
+		{
+			name: "empty",
+			src:  "",
+			check: func(t *testing.T, cfg *Config) {
+				if cfg.Feeds == nil || cfg.Tokens == nil {
+					t.Errorf("Feeds = %v, Tokens = %v, want empty maps", cfg.Feeds, cfg.Tokens)
+				}
+			},
+		},
+		{
+			name: "typed feed settings",
+			src:  "[feeds.news]\nurl = \"https://youtube.com/@news\"\npage_size = 25\nfilters = { title = \"live\", max_age = 30, min_duration = 60 }\ncustom = { subcategories = [\"Daily News\"], explicit = true }\n",
+			check: func(t *testing.T, cfg *Config) {
+				want := &Feed{
+					URL:      "https://youtube.com/@news",
+					PageSize: 25,
+					Filters:  Filters{Title: "live", MaxAge: 30, MinDuration: 60},
+					Custom:   Custom{Subcategories: []string{"Daily News"}, Explicit: true},
+				}
+				if got := cfg.Feeds["news"]; !reflect.DeepEqual(got, want) {
+					t.Errorf("feed = %+v, want %+v", got, want)
+				}
+			},
+		},
+		{
+			name: "empty feed table",
+			src:  "[feeds.news]\n",
+			check: func(t *testing.T, cfg *Config) {
+				if cfg.Feeds["news"] == nil {
+					t.Error("feed is nil, want an empty feed")
+				}
+			},
+		},
+		{
+			name: "tokens as string or array",
+			src:  "[tokens]\nyoutube = \"key1\"\nvimeo = [\"key2\", \"key3\"]\n",
+			check: func(t *testing.T, cfg *Config) {
+				want := Tokens{"youtube": {"key1"}, "vimeo": {"key2", "key3"}}
+				if !reflect.DeepEqual(cfg.Tokens, want) {
+					t.Errorf("Tokens = %v, want %v", cfg.Tokens, want)
+				}
+			},
+		},
+		{
+			name: "unknown keys ignored",
+			src:  "[server]\nport = 8080\nfuture_setting = true\n[feeds.news]\nurl = \"https://youtube.com/@news\"\nnew_option = 1\n",
+			check: func(t *testing.T, cfg *Config) {
+				if cfg.Server.Port != 8080 || cfg.Feeds["news"].URL == "" {
+					t.Errorf("config = %+v", cfg)
+				}
+			},
+		},
+		{name: "max_age as string", src: "[feeds.news]\nfilters = { max_age = \"30\" }\n", wantErr: "MaxAge"},
+		{name: "page_size as string", src: "[feeds.news]\npage_size = \"25\"\n", wantErr: "PageSize"},
+		{name: "token not a string", src: "[tokens]\nyoutube = 1\n", wantErr: "tokens.youtube"},
+		{name: "token key not a string", src: "[tokens]\nyoutube = [\"key1\", 2]\n", wantErr: "tokens.youtube"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg, err := Load(parse(t, tt.src))
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("Load error = %v, want one mentioning %s", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Load: %v", err)
+			}
+			tt.check(t, cfg)
+		})
+	}
+}
+
+func TestSave(t *testing.T) {
+	src := `# Podsync config
+[server]
+port = 8080 # public port
+future_setting = true
+
+[tokens]
+youtube = "key1"
+
+[feeds]
+  # Main channel
+  [feeds.news]
+  url = "https://youtube.com/@news"
+  page_size = 25
+  new_option = 1 # kept
+`
+	tests := []struct {
+		name   string
+		change func(cfg *Config)
+		want   string
+	}{
+		{"unchanged", func(cfg *Config) {}, src},
+		{"set a value", func(cfg *Config) { cfg.Server.Port = 9090 },
+			strings.Replace(src, "port = 8080 #", "port = 9090 #", 1)},
+		{"clear a value", func(cfg *Config) { cfg.Feeds["news"].PageSize = 0 },
+			strings.Replace(src, "  page_size = 25\n", "", 1)},
+		{"add a nested value", func(cfg *Config) { cfg.Feeds["news"].Filters.MaxAge = 30 },
+			src + "\n[feeds.news.filters]\nmax_age = 30\n"},
+		{"tokens to an array", func(cfg *Config) { cfg.Tokens["youtube"] = []string{"key1", "key2"} },
+			strings.Replace(src, `youtube = "key1"`, `youtube = ["key1", "key2"]`, 1)},
+		{"emptied table removed", func(cfg *Config) { delete(cfg.Tokens, "youtube") },
+			strings.Replace(src, "[tokens]\nyoutube = \"key1\"\n\n", "", 1)},
+		{"feed added", func(cfg *Config) { cfg.Feeds["tech"] = &Feed{URL: "https://youtube.com/@tech", OPML: true} },
+			src + "\n[feeds.tech]\nurl = \"https://youtube.com/@tech\"\nopml = true\n"},
+		{"feed removed", func(cfg *Config) { delete(cfg.Feeds, "news") },
+			"# Podsync config\n[server]\nport = 8080 # public port\nfuture_setting = true\n\n[tokens]\nyoutube = \"key1\"\n\n[feeds]\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			doc := parse(t, src)
+			before, err := Load(doc)
+			if err != nil {
+				t.Fatal(err)
+			}
+			after, err := Load(doc)
+			if err != nil {
+				t.Fatal(err)
+			}
+			tt.change(after)
+			if err := Save(doc, before, after); err != nil {
+				t.Fatalf("Save: %v", err)
+			}
+			if got := string(doc.Bytes()); got != tt.want {
+				t.Errorf("Save =\n%s\nwant\n%s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSaveSwitchToS3(t *testing.T) {
+	src := `[server]
+port = 8080
+
+[storage]
+  [storage.local]
+  data_dir = "/app/data"
+
+[feeds]
+  # Main channel
+  [feeds.foo]
+  url = "https://youtube.com/channel/x"
+`
+	doc := parse(t, src)
+	before, err := Load(doc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	after, err := Load(doc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	after.Storage = Storage{Type: "s3", S3: S3Storage{Bucket: "pods", Region: "eu-west-1"}}
+	if err := Save(doc, before, after); err != nil {
+		t.Fatalf("Save: %v", err)
+	}
+
+	want := `[server]
+port = 8080
+
+[storage]
+type = "s3"
+
+[storage.s3]
+region = "eu-west-1"
+bucket = "pods"
+
+[feeds]
+  # Main channel
+  [feeds.foo]
+  url = "https://youtube.com/channel/x"
+`
+	if got := string(doc.Bytes()); got != want {
+		t.Errorf("Save =\n%s\nwant\n%s", got, want)
+	}
+}
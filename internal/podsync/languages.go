@@ -0,0 +1,36 @@
+package podsync
+
+import (
+	"regexp"
+	"strings"
+)
+
+// languageTag matches an ISO 639-1 code with an optional region, such as
+// "en" or "en-gb", as used in a podcast's <language>.
+var languageTag = regexp.MustCompile(`^([A-Za-z]{2})(-([A-Za-z]{2}|[0-9]{3}))?$`)
+
+// isoLanguages holds the ISO 639-1 language codes.
+var isoLanguages = toSet(strings.Fields(`
+	aa ab ae af ak am an ar as av ay az ba be bg bi bm bn bo br bs ca ce ch
+	co cr cs cu cv cy da de dv dz ee el en eo es et eu fa ff fi fj fo fr fy
+	ga gd gl gn gu gv ha he hi ho hr ht hu hy hz ia id ie ig ii ik io is it
+	iu ja jv ka kg ki kj kk kl km kn ko kr ks ku kv kw ky la lb lg li ln lo
+	lt lu lv mg mh mi mk ml mn mr ms mt my na nb nd ne ng nl nn no nr nv ny
+	oc oj om or os pa pi pl ps pt qu rm rn ro ru rw sa sc sd se sg si sk sl
+	sm sn so sq sr ss st su sv sw ta te tg th ti tk tl tn to tr ts tt tw ty
+	ug uk ur uz ve vi vo wa wo xh yi yo za zh zu`))
+
+func toSet(values []string) map[string]bool {
+	set := make(map[string]bool, len(values))
+	for _, v := range values {
+		set[v] = true
+	}
+	return set
+}
+
+// ValidLanguage reports whether lang is an ISO 639-1 language code,
+// optionally followed by a region.
+func ValidLanguage(lang string) bool {
+	m := languageTag.FindStringSubmatch(lang)
+	return m != nil && isoLanguages[strings.ToLower(m[1])]
+}
@@ -0,0 +1,396 @@
+package podsync
+
+import (
+	"fmt"
+	"net"
+	"net/mail"
+	"net/url"
+	"regexp"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/robfig/cron/v3"
+)
+
+// Problem is a single validation failure at a TOML key path.
+type Problem struct {
+	Path    string `json:"path"`
+	Message string `json:"message"`
+}
+
+func (p Problem) String() string {
+	return p.Path + ": " + p.Message
+}
+
+// ValidationError lists every problem found in a configuration.
+type ValidationError struct {
+	Problems []Problem
+}
+
+func (e *ValidationError) Error() string {
+	lines := make([]string, len(e.Problems))
+	for i, p := range e.Problems {
+		lines[i] = p.String()
+	}
+	return "invalid config: " + strings.Join(lines, "; ")
+}
+
+// Validate checks cfg against the rules podsync applies when it starts. It
+// returns a *ValidationError listing every problem, or nil.
+func Validate(cfg *Config) error {
+	v := &validator{}
+	v.server(&cfg.Server)
+	v.storage(&cfg.Storage, cfg.Server.DataDir)
+	v.tokens(cfg.Tokens)
+	v.downloader(&cfg.Downloader)
+	v.log(&cfg.Log)
+	if len(cfg.Feeds) == 0 {
+		v.add([]string{"feeds"}, "at least one feed must be specified")
+	}
+	for _, key := range feedKeys(cfg) {
+		v.feed(key, cfg.Feeds[key])
+	}
+	return v.err()
+}
+
+// CheckMetadata checks values podsync starts with but passes on unchecked:
+// API key formats, and the URLs, language, owner email and category of each
+// podcast. Podsync itself accepts them, so they are checked as they are
+// written rather than before a reload.
+func CheckMetadata(cfg *Config) error {
+	v := &validator{}
+	v.tokenKeys(cfg.Tokens)
+	for _, key := range feedKeys(cfg) {
+		v.custom(key, &cfg.Feeds[key].Custom)
+	}
+	return v.err()
+}
+
+// Check runs both Validate and CheckMetadata, as every write does.
+func Check(cfg *Config) error {
+	var problems []Problem
+	for _, err := range []error{Validate(cfg), CheckMetadata(cfg)} {
+		if verr, ok := err.(*ValidationError); ok {
+			problems = append(problems, verr.Problems...)
+		}
+	}
+	if len(problems) == 0 {
+		return nil
+	}
+	return &ValidationError{Problems: problems}
+}
+
+func feedKeys(cfg *Config) []string {
+	keys := make([]string, 0, len(cfg.Feeds))
+	for key := range cfg.Feeds {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// NewProblems returns the problems in after that are not already in before,
+// so edits to a config with existing problems are not blocked by them.
+func NewProblems(before, after error) error {
+	afterErr, ok := after.(*ValidationError)
+	if !ok {
+		return after
+	}
+	known := map[Problem]bool{}
+	if beforeErr, ok := before.(*ValidationError); ok {
+		for _, p := range beforeErr.Problems {
+			known[p] = true
+		}
+	}
+	var fresh []Problem
+	for _, p := range afterErr.Problems {
+		if !known[p] {
+			fresh = append(fresh, p)
+		}
+	}
+	if len(fresh) == 0 {
+		return nil
+	}
+	return &ValidationError{Problems: fresh}
+}
+
+// serverPath matches the path prefixes podsync accepts for server.path.
+var serverPath = regexp.MustCompile(`^[A-Za-z0-9]*$`)
+
+type validator struct {
+	problems []Problem
+}
+
+func (v *validator) err() error {
+	if len(v.problems) == 0 {
+		return nil
+	}
+	return &ValidationError{Problems: v.problems}
+}
+
+func (v *validator) add(path []string, format string, args ...interface{}) {
+	v.problems = append(v.problems, Problem{Path: KeyPath(path...), Message: fmt.Sprintf(format, args...)})
+}
+
+func (v *validator) oneOf(path []string, val string, allowed ...string) {
+	if val == "" {
+		return
+	}
+	for _, a := range allowed {
+		if val == a {
+			return
+		}
+	}
+	v.add(path, "must be one of %s, got %q", strings.Join(allowed, ", "), val)
+}
+
+func (v *validator) nonNegative(path []string, val int64) {
+	if val < 0 {
+		v.add(path, "must not be negative, got %d", val)
+	}
+}
+
+func (v *validator) httpURL(path []string, val string) {
+	if val == "" {
+		return
+	}
+	u, err := url.Parse(val)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		v.add(path, "must be an http or https URL, got %q", val)
+	}
+}
+
+// category checks a category and its subcategories against the Apple
+// Podcasts taxonomy.
+func (v *validator) category(path []string, name string, subcategories []string) {
+	at := func(key string) []string { return append(append([]string{}, path...), key) }
+	if name == "" {
+		if len(subcategories) > 0 {
+			v.add(at("subcategories"), "require custom.category")
+		}
+		return
+	}
+	c, ok := FindCategory(name)
+	if !ok {
+		v.add(at("category"), "must be an Apple Podcasts category such as %q, got %q", Categories[0].Name, name)
+		return
+	}
+	for _, sub := range subcategories {
+		if !slices.Contains(c.Subcategories, sub) {
+			v.add(at("subcategories"), "%q is not a subcategory of %q", sub, name)
+		}
+	}
+}
+
+func (v *validator) email(path []string, val string) {
+	if val == "" {
+		return
+	}
+	if addr, err := mail.ParseAddress(val); err != nil || addr.Address != val {
+		v.add(path, "must be an email address, got %q", val)
+	}
+}
+
+func (v *validator) regex(path []string, val string) {
+	if val == "" {
+		return
+	}
+	if _, err := regexp.Compile(val); err != nil {
+		v.add(path, "invalid regular expression: %v", err)
+	}
+}
+
+func (v *validator) server(s *Server) {
+	if s.Port < 0 || s.Port > 65535 {
+		v.add([]string{"server", "port"}, "must be between 1 and 65535, got %d", s.Port)
+	}
+	v.httpURL([]string{"server", "hostname"}, s.Hostname)
+	if s.BindAddress != "" && s.BindAddress != "*" && net.ParseIP(s.BindAddress) == nil {
+		v.add([]string{"server", "bind_address"}, "must be an IP address, got %q", s.BindAddress)
+	}
+	if !serverPath.MatchString(s.Path) {
+		v.add([]string{"server", "path"}, "may only contain letters and digits, got %q", s.Path)
+	}
+	if s.TLS {
+		if s.CertificatePath == "" {
+			v.add([]string{"server", "certificate_path"}, "is required when tls is enabled")
+		}
+		if s.KeyFilePath == "" {
+			v.add([]string{"server", "key_file_path"}, "is required when tls is enabled")
+		}
+	}
+}
+
+func (v *validator) storage(s *Storage, deprecatedDataDir string) {
+	v.oneOf([]string{"storage", "type"}, s.Type, "local", "s3")
+	if (s.Type == "" || s.Type == "local") && s.Local.DataDir == "" && deprecatedDataDir == "" {
+		v.add([]string{"storage", "local", "data_dir"}, "is required for local storage")
+	}
+	if s.Type == "s3" {
+		if s.S3.EndpointURL == "" {
+			v.add([]string{"storage", "s3", "endpoint_url"}, "is required when type is s3")
+		}
+		v.httpURL([]string{"storage", "s3", "endpoint_url"}, s.S3.EndpointURL)
+		if s.S3.Region == "" {
+			v.add([]string{"storage", "s3", "region"}, "is required when type is s3")
+		}
+		if s.S3.Bucket == "" {
+			v.add([]string{"storage", "s3", "bucket"}, "is required when type is s3")
+		}
+	}
+}
+
+func (v *validator) tokens(t Tokens) {
+	providers := make([]string, 0, len(t))
+	for p := range t {
+		providers = append(providers, p)
+	}
+	sort.Strings(providers)
+	for _, p := range providers {
+		v.oneOf([]string{"tokens", p}, p, TokenProviders...)
+	}
+}
+
+// tokenKeys checks each API key against its provider's format.
+func (v *validator) tokenKeys(t Tokens) {
+	providers := make([]string, 0, len(t))
+	for p := range t {
+		providers = append(providers, p)
+	}
+	sort.Strings(providers)
+	for _, p := range providers {
+		for i, key := range t[p] {
+			if err := CheckToken(p, key); err != nil {
+				v.add([]string{"tokens", p}, "key %d %v", i+1, err)
+			}
+		}
+	}
+}
+
+// TokenProviders are the services podsync reads API keys for.
+var TokenProviders = []string{"youtube", "vimeo", "soundcloud", "twitch"}
+
+// tokenFormats describes the keys each provider issues.
+var tokenFormats = map[string]struct {
+	re   *regexp.Regexp
+	desc string
+}{
+	"youtube":    {regexp.MustCompile(`^AIza[0-9A-Za-z_-]{35}$`), "a YouTube Data API key: AIza followed by 35 letters, digits, - or _"},
+	"vimeo":      {regexp.MustCompile(`^[0-9a-f]{32}$`), "a Vimeo access token: 32 hexadecimal digits"},
+	"soundcloud": {regexp.MustCompile(`^[0-9A-Za-z]{32}$`), "a SoundCloud client ID: 32 letters and digits"},
+	"twitch":     {regexp.MustCompile(`^[0-9a-z]{30}:[0-9a-z]{30}$`), "a Twitch client ID and secret as CLIENT_ID:CLIENT_SECRET, 30 letters and digits each"},
+}
+
+// CheckToken reports whether key looks like an API key for provider. The
+// error never includes the key itself.
+func CheckToken(provider, key string) error {
+	if strings.TrimSpace(key) == "" {
+		return fmt.Errorf("is empty")
+	}
+	format, ok := tokenFormats[provider]
+	if !ok {
+		return nil
+	}
+	if !format.re.MatchString(key) {
+		return fmt.Errorf("is not %s", format.desc)
+	}
+	return nil
+}
+
+func (v *validator) downloader(d *Downloader) {
+	v.nonNegative([]string{"downloader", "timeout"}, int64(d.Timeout))
+}
+
+func (v *validator) log(l *Log) {
+	v.nonNegative([]string{"log", "max_size"}, int64(l.MaxSize))
+	v.nonNegative([]string{"log", "max_backups"}, int64(l.MaxBackups))
+	v.nonNegative([]string{"log", "max_age"}, int64(l.MaxAge))
+}
+
+func (v *validator) feed(key string, f *Feed) {
+	path := func(keys ...string) []string {
+		return append([]string{"feeds", key}, keys...)
+	}
+
+	if f.URL == "" {
+		v.add(path("url"), "is required")
+	} else {
+		v.httpURL(path("url"), f.URL)
+	}
+	if f.PageSize < 0 {
+		v.add(path("page_size"), "must be positive, got %d", f.PageSize)
+	}
+	if f.UpdatePeriod != "" {
+		if d, err := time.ParseDuration(f.UpdatePeriod); err != nil {
+			v.add(path("update_period"), "must be a duration such as 30m, 6h or 24h, got %q", f.UpdatePeriod)
+		} else if d <= 0 {
+			v.add(path("update_period"), "must be positive, got %q", f.UpdatePeriod)
+		}
+	}
+	if f.CronSchedule != "" {
+		if _, err := cron.ParseStandard(f.CronSchedule); err != nil {
+			v.add(path("cron_schedule"), "invalid cron expression: %v", err)
+		}
+	}
+	v.oneOf(path("quality"), f.Quality, "high", "low")
+	v.oneOf(path("format"), f.Format, "audio", "video", "custom")
+	if f.Format == "custom" {
+		if f.CustomFormat.YouTubeDLFormat == "" {
+			v.add(path("custom_format", "youtube_dl_format"), "is required when format is custom")
+		}
+		if f.CustomFormat.Extension == "" {
+			v.add(path("custom_format", "extension"), "is required when format is custom")
+		}
+	}
+	v.nonNegative(path("max_height"), int64(f.MaxHeight))
+	v.oneOf(path("playlist_sort"), f.PlaylistSort, "asc", "desc")
+
+	v.regex(path("filters", "title"), f.Filters.Title)
+	v.regex(path("filters", "not_title"), f.Filters.NotTitle)
+	v.regex(path("filters", "description"), f.Filters.Description)
+	v.regex(path("filters", "not_description"), f.Filters.NotDescription)
+	v.nonNegative(path("filters", "min_duration"), f.Filters.MinDuration)
+	v.nonNegative(path("filters", "max_duration"), f.Filters.MaxDuration)
+	if f.Filters.MaxDuration > 0 && f.Filters.MinDuration > f.Filters.MaxDuration {
+		v.add(path("filters", "min_duration"), "must not exceed max_duration")
+	}
+	v.nonNegative(path("filters", "max_age"), int64(f.Filters.MaxAge))
+	v.nonNegative(path("filters", "min_age"), int64(f.Filters.MinAge))
+	if f.Filters.MaxAge > 0 && f.Filters.MinAge > f.Filters.MaxAge {
+		v.add(path("filters", "min_age"), "must not exceed max_age")
+	}
+
+	v.nonNegative(path("clean", "keep_last"), int64(f.Clean.KeepLast))
+
+	v.oneOf(path("custom", "cover_art_quality"), f.Custom.CoverArtQuality, "high", "low")
+}
+
+// custom checks the podcast metadata of a feed; see CheckMetadata.
+func (v *validator) custom(key string, c *Custom) {
+	path := func(name string) []string {
+		return []string{"feeds", key, "custom", name}
+	}
+	v.httpURL(path("cover_art"), c.CoverArt)
+	v.httpURL(path("link"), c.Link)
+	if c.Lang != "" && !ValidLanguage(c.Lang) {
+		v.add(path("lang"), "must be an ISO 639-1 language code such as en or en-gb, got %q", c.Lang)
+	}
+	v.category([]string{"feeds", key, "custom"}, c.Category, c.Subcategories)
+	v.email(path("ownerEmail"), c.OwnerEmail)
+}
+
+// KeyPath formats a TOML key path, quoting parts that are not bare keys.
+func KeyPath(parts ...string) string {
+	quoted := make([]string, len(parts))
+	for i, p := range parts {
+		quoted[i] = p
+		if p == "" || strings.IndexFunc(p, func(r rune) bool {
+			return !(r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '_' || r == '-')
+		}) >= 0 {
+			quoted[i] = fmt.Sprintf("%q", p)
+		}
+	}
+	return strings.Join(quoted, ".")
+}
@@ -0,0 +1,124 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"time"
+)
+
+// BackupListHandler returns the list of config backups in HTML (partial).
+func (h *Handler) BackupListHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	backups, err := h.Backups.List()
+	if err != nil {
+		log.Printf("Error listing backups: %v", err)
+		http.Error(w, "Failed to list backups", http.StatusInternalServerError)
+		return
+	}
+	data := map[string]interface{}{
+		"Backups": backups,
+	}
+	w.Header().Set("Content-Type", "text/html")
+	if err := tmpl.ExecuteTemplate(w, "backupList", data); err != nil {
+		http.Error(w, "Template error", http.StatusInternalServerError)
+	}
+}
+
+// BackupViewHandler returns the content of a single backup as plain text,
+// with API keys masked.
+func (h *Handler) BackupViewHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	content, ok := h.readBackup(w, r.URL.Query().Get("name"))
+	if !ok {
+		return
+	}
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.Write(maskSecrets(content))
+}
+
+// BackupDiffHandler returns a unified diff from a backup to the current config.
+func (h *Handler) BackupDiffHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	name := r.URL.Query().Get("name")
+	content, ok := h.readBackup(w, name)
+	if !ok {
+		return
+	}
+	current, err := os.ReadFile(h.PodsyncConfigPath)
+	if err != nil {
+		log.Printf("Error reading config: %v", err)
+		http.Error(w, "Failed to read config", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.Write([]byte(configDiff(name, "config.toml", content, current)))
+}
+
+// RestoreBackupHandler replaces the current config with a backup.
+func (h *Handler) RestoreBackupHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	name := r.FormValue("name")
+	if name == "" {
+		http.Error(w, "name is required", http.StatusBadRequest)
+		return
+	}
+	err := h.FeedService.RestoreBackup(h.PodsyncConfigPath, name)
+	if errors.Is(err, ErrBackupNotFound) {
+		http.Error(w, "Backup not found", http.StatusNotFound)
+		return
+	}
+	if validationFailed(w, err) || lockFailed(w, err) {
+		return
+	}
+	if err != nil {
+		log.Printf("Error restoring backup: %v", err)
+		http.Error(w, "Failed to restore backup", http.StatusInternalServerError)
+		return
+	}
+
+	h.addChange(ChangeEntry{
+		Time:      time.Now().UTC(),
+		Actor:     requestActor(r),
+		Operation: OpRestore,
+		Message:   fmt.Sprintf("Restored backup '%s'", name),
+	})
+
+	successMsg := fmt.Sprintf("Backup '%s' restored successfully!", name)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"message": successMsg})
+}
+
+// readBackup loads the named backup, writing an error response on failure.
+func (h *Handler) readBackup(w http.ResponseWriter, name string) ([]byte, bool) {
+	if name == "" {
+		http.Error(w, "name is required", http.StatusBadRequest)
+		return nil, false
+	}
+	content, err := h.Backups.Read(name)
+	if errors.Is(err, ErrBackupNotFound) {
+		http.Error(w, "Backup not found", http.StatusNotFound)
+		return nil, false
+	}
+	if err != nil {
+		log.Printf("Error reading backup: %v", err)
+		http.Error(w, "Failed to read backup", http.StatusInternalServerError)
+		return nil, false
+	}
+	return content, true
+}
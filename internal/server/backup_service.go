@@ -0,0 +1,130 @@
+package server
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+)
+
+// backupTimeFormat prefixes backup file names, so sorting by name sorts by age.
+const backupTimeFormat = "20060102T150405.000000000Z"
+
+// ErrBackupNotFound is returned when a backup name does not exist.
+var ErrBackupNotFound = errors.New("backup not found")
+
+// BackupService keeps timestamped copies of the podsync config.
+type BackupService struct {
+	Dir string
+	// Keep is the maximum number of backups kept (0 for no limit).
+	Keep int
+	// MaxAge is how long backups are kept (0 for no limit).
+	MaxAge time.Duration
+}
+
+// Backup describes a saved copy of the config.
+type Backup struct {
+	Name    string
+	Created time.Time
+	Size    int64
+}
+
+// Save stores content as a new backup of configPath and prunes old backups.
+// Nothing is stored when content matches the latest backup.
+func (bs *BackupService) Save(configPath string, content []byte) error {
+	if err := os.MkdirAll(bs.Dir, 0700); err != nil {
+		return err
+	}
+	backups, err := bs.List()
+	if err != nil {
+		return err
+	}
+	if len(backups) > 0 {
+		latest, err := bs.Read(backups[0].Name)
+		if err == nil && bytes.Equal(latest, content) {
+			return nil
+		}
+	}
+	name := time.Now().UTC().Format(backupTimeFormat) + "-" + filepath.Base(configPath)
+	if err := os.WriteFile(filepath.Join(bs.Dir, name), content, 0600); err != nil {
+		return err
+	}
+	return bs.prune()
+}
+
+// List returns the stored backups, newest first.
+func (bs *BackupService) List() ([]Backup, error) {
+	entries, err := os.ReadDir(bs.Dir)
+	if os.IsNotExist(err) {
+		return []Backup{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	backups := []Backup{}
+	for _, e := range entries {
+		created, ok := parseBackupName(e.Name())
+		if !ok || !e.Type().IsRegular() {
+			continue
+		}
+		info, err := e.Info()
+		if err != nil {
+			continue
+		}
+		backups = append(backups, Backup{Name: e.Name(), Created: created, Size: info.Size()})
+	}
+	sort.Slice(backups, func(i, j int) bool {
+		return backups[i].Name > backups[j].Name
+	})
+	return backups, nil
+}
+
+// Read returns the content of the named backup.
+func (bs *BackupService) Read(name string) ([]byte, error) {
+	if _, ok := parseBackupName(name); !ok || filepath.Base(name) != name {
+		return nil, fmt.Errorf("%w: %s", ErrBackupNotFound, name)
+	}
+	content, err := os.ReadFile(filepath.Join(bs.Dir, name))
+	if os.IsNotExist(err) {
+		return nil, fmt.Errorf("%w: %s", ErrBackupNotFound, name)
+	}
+	return content, err
+}
+
+// prune removes backups beyond the count limit or older than the age limit.
+// The newest backup is always kept.
+func (bs *BackupService) prune() error {
+	backups, err := bs.List()
+	if err != nil {
+		return err
+	}
+	for i, b := range backups {
+		if i == 0 {
+			continue
+		}
+		tooMany := bs.Keep > 0 && i >= bs.Keep
+		tooOld := bs.MaxAge > 0 && time.Since(b.Created) > bs.MaxAge
+		if tooMany || tooOld {
+			if err := os.Remove(filepath.Join(bs.Dir, b.Name)); err != nil && !os.IsNotExist(err) {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// parseBackupName extracts the creation time from a backup file name.
+func parseBackupName(name string) (time.Time, bool) {
+	n := len(backupTimeFormat)
+	if len(name) <= n+1 || name[n] != '-' {
+		return time.Time{}, false
+	}
+	created, err := time.Parse(backupTimeFormat, name[:n])
+	if err != nil {
+		return time.Time{}, false
+	}
+	return created, true
+}
@@ -0,0 +1,105 @@
+package server
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// writeBackup stores content as a backup created at created.
+func writeBackup(t *testing.T, dir string, created time.Time, content string) string {
+	t.Helper()
+	name := created.UTC().Format(backupTimeFormat) + "-config.toml"
+	if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0600); err != nil {
+		t.Fatal(err)
+	}
+	return name
+}
+
+func TestBackupRetention(t *testing.T) {
+	now := time.Now()
+	ages := []time.Duration{time.Hour, 24 * time.Hour, 10 * 24 * time.Hour, 40 * 24 * time.Hour}
+	tests := []struct {
+		name   string
+		keep   int
+		maxAge time.Duration
+		want   int // backups left, including the new one
+		oldest time.Duration
+	}{
+		{"no limits", 0, 0, 5, 40 * 24 * time.Hour},
+		{"keep count", 3, 0, 3, 24 * time.Hour},
+		{"keep one", 1, 0, 1, 0},
+		{"max age", 0, 7 * 24 * time.Hour, 3, 24 * time.Hour},
+		{"both limits, count stricter", 2, 30 * 24 * time.Hour, 2, time.Hour},
+		{"both limits, age stricter", 10, 2 * time.Hour, 2, time.Hour},
+		{"max age below every backup", 0, time.Minute, 1, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			bs := &BackupService{Dir: t.TempDir(), Keep: tt.keep, MaxAge: tt.maxAge}
+			for i, age := range ages {
+				writeBackup(t, bs.Dir, now.Add(-age), string(rune('a'+i)))
+			}
+			if err := bs.Save("/config/config.toml", []byte("new")); err != nil {
+				t.Fatalf("Save: %v", err)
+			}
+			backups, err := bs.List()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(backups) != tt.want {
+				t.Fatalf("%d backups left, want %d", len(backups), tt.want)
+			}
+			if latest, err := bs.Read(backups[0].Name); err != nil || string(latest) != "new" {
+				t.Errorf("newest backup = %q, %v; want the saved one", latest, err)
+			}
+			oldest := backups[len(backups)-1].Created
+			if age := now.Sub(oldest).Round(time.Hour); age != tt.oldest {
+				t.Errorf("oldest backup is %v old, want %v", age, tt.oldest)
+			}
+		})
+	}
+}
+
+func TestBackupSaveUnchanged(t *testing.T) {
+	bs := &BackupService{Dir: t.TempDir()}
+	for range 2 {
+		if err := bs.Save("config.toml", []byte("same")); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if backups, _ := bs.List(); len(backups) != 1 {
+		t.Errorf("%d backups of unchanged content, want 1", len(backups))
+	}
+}
+
+func TestBackupRead(t *testing.T) {
+	bs := &BackupService{Dir: t.TempDir()}
+	name := writeBackup(t, bs.Dir, time.Now(), "content")
+	if err := os.WriteFile(filepath.Join(bs.Dir, "notes.txt"), nil, 0600); err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name    string
+		backup  string
+		wantErr bool
+	}{
+		{"backup", name, false},
+		{"not a backup name", "notes.txt", true},
+		{"path outside the directory", "../" + name, true},
+		{"missing", time.Now().Add(time.Hour).UTC().Format(backupTimeFormat) + "-config.toml", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := bs.Read(tt.backup)
+			if tt.wantErr != errors.Is(err, ErrBackupNotFound) {
+				t.Errorf("Read(%q) error = %v, want ErrBackupNotFound: %v", tt.backup, err, tt.wantErr)
+			}
+		})
+	}
+	if backups, _ := bs.List(); len(backups) != 1 {
+		t.Errorf("List = %v, want only the backup", backups)
+	}
+}
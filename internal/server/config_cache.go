@@ -0,0 +1,63 @@
+package server
+
+import (
+	"os"
+
+	"github.com/Takenobou/podconfig/internal/podsync"
+)
+
+// configCache is the last parse of the config file, together with the file
+// information it was read under.
+type configCache struct {
+	path    string
+	info    os.FileInfo
+	version string
+	cfg     *podsync.Config
+	err     error
+}
+
+// matches reports whether the file described by info is still the one that
+// was parsed: same file (device and inode), size and modification time.
+func (c *configCache) matches(path string, info os.FileInfo) bool {
+	return c != nil && c.path == path && os.SameFile(c.info, info) &&
+		c.info.Size() == info.Size() && c.info.ModTime().Equal(info.ModTime())
+}
+
+// cachedConfig returns the parsed config and the version it was read from,
+// parsing the file again only when it has changed. The returned config is
+// shared between callers and must not be modified. Callers must hold fs.mu
+// for reading.
+func (fs *FeedService) cachedConfig(configPath string) (*podsync.Config, string, error) {
+	info, err := os.Stat(configPath)
+	if err != nil {
+		return nil, "", err
+	}
+	fs.cacheMu.Lock()
+	c := fs.cache
+	fs.cacheMu.Unlock()
+	if c.matches(configPath, info) {
+		return c.cfg, c.version, c.err
+	}
+
+	// If the file changes between the Stat and the read, the next Stat will
+	// not match and the file is parsed again.
+	content, err := os.ReadFile(configPath)
+	if err != nil {
+		return nil, "", err
+	}
+	cfg, err := loadModel(content)
+	version := fs.rememberVersion(content)
+
+	fs.cacheMu.Lock()
+	fs.cache = &configCache{path: configPath, info: info, version: version, cfg: cfg, err: err}
+	fs.cacheMu.Unlock()
+	return cfg, version, err
+}
+
+// invalidateCache drops the parsed config, for changes that might not show in
+// the file's size or modification time.
+func (fs *FeedService) invalidateCache() {
+	fs.cacheMu.Lock()
+	fs.cache = nil
+	fs.cacheMu.Unlock()
+}
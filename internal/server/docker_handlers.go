@@ -4,9 +4,11 @@ package server
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
 	"net/http"
+	"os"
 	"time"
 
 	"github.com/docker/docker/api/types/container"
@@ -20,25 +22,27 @@ func (h *Handler) ReloadHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	cli, err := client.NewClientWithOpts(client.FromEnv, client.WithAPIVersionNegotiation())
-	if err != nil {
-		log.Printf("Error creating Docker client: %v", err)
-		http.Error(w, "Failed to create Docker client", http.StatusInternalServerError)
+	// Refuse to restart podsync into a config it would reject, unless it is
+	// already running with the same problems.
+	applied, _, err := h.Snapshots.Load()
+	if err != nil && !errors.Is(err, ErrNoSnapshot) {
+		log.Printf("Error reading applied snapshot: %v", err)
+	}
+	if err := h.FeedService.CheckReload(h.PodsyncConfigPath, applied); err != nil {
+		if validationFailed(w, err) {
+			return
+		}
+		log.Printf("Error reading config before reload: %v", err)
+		http.Error(w, "Failed to read config: "+err.Error(), http.StatusUnprocessableEntity)
 		return
 	}
 
-	timeout := 10 * time.Second
-	ctx := context.Background()
-	intTimeout := int(timeout.Seconds())
-	err = cli.ContainerRestart(ctx, h.DockerContainerName, container.StopOptions{Timeout: &intTimeout})
-	if err != nil {
+	if err := h.restartPodsync(); err != nil {
 		log.Printf("Error restarting container: %v", err)
 		http.Error(w, "Failed to reload docker container", http.StatusInternalServerError)
 		return
 	}
 
-	h.clearChanges()
-
 	successMsg := fmt.Sprintf("Docker container '%s' reloaded successfully!", h.DockerContainerName)
 	log.Printf("Reload successful: %s", successMsg)
 
@@ -54,3 +58,51 @@ func (h *Handler) ReloadHandler(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(data)
 }
+
+// restartPodsync restarts the podsync container so it picks up the live config,
+// records that config as applied and clears the pending changelog.
+func (h *Handler) restartPodsync() error {
+	cli, err := client.NewClientWithOpts(client.FromEnv, client.WithAPIVersionNegotiation())
+	if err != nil {
+		return fmt.Errorf("creating Docker client: %w", err)
+	}
+	defer cli.Close()
+
+	// Read the config before restarting, so the snapshot is no newer than
+	// what podsync loads.
+	applied, readErr := os.ReadFile(h.PodsyncConfigPath)
+
+	timeout := 10 * time.Second
+	ctx := context.Background()
+	intTimeout := int(timeout.Seconds())
+	err = cli.ContainerRestart(ctx, h.DockerContainerName, container.StopOptions{Timeout: &intTimeout})
+	if err != nil {
+		return err
+	}
+
+	if readErr != nil {
+		log.Printf("Error reading config for the applied snapshot: %v", readErr)
+	} else if err := h.Snapshots.Save(applied); err != nil {
+		log.Printf("Error saving applied snapshot: %v", err)
+	}
+	h.clearChanges()
+	return nil
+}
+
+// containerStartedAt returns when the podsync container was last started.
+func (h *Handler) containerStartedAt(ctx context.Context) (time.Time, error) {
+	cli, err := client.NewClientWithOpts(client.FromEnv, client.WithAPIVersionNegotiation())
+	if err != nil {
+		return time.Time{}, fmt.Errorf("creating Docker client: %w", err)
+	}
+	defer cli.Close()
+
+	info, err := cli.ContainerInspect(ctx, h.DockerContainerName)
+	if err != nil {
+		return time.Time{}, err
+	}
+	if info.State == nil || !info.State.Running {
+		return time.Time{}, fmt.Errorf("container '%s' is not running", h.DockerContainerName)
+	}
+	return time.Parse(time.RFC3339Nano, info.State.StartedAt)
+}
@@ -0,0 +1,105 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+)
+
+// DraftDiffHandler returns the staged changes as a unified diff (text/plain).
+func (h *Handler) DraftDiffHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	draft, err := h.FeedService.GetDraft(h.PodsyncConfigPath)
+	if err != nil {
+		log.Printf("Error reading staged changes: %v", err)
+		http.Error(w, "Failed to read staged changes", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	if draft != nil {
+		w.Write([]byte(draft.Diff))
+	}
+}
+
+// ApplyDraftHandler writes the staged changes to the live config and reloads
+// the podsync container.
+func (h *Handler) ApplyDraftHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	version, ok := requestVersion(w, r)
+	if !ok {
+		return
+	}
+	changes, err := h.FeedService.ApplyDraft(h.PodsyncConfigPath, version)
+	if errors.Is(err, ErrNoDraft) {
+		http.Error(w, "Nothing is staged", http.StatusNotFound)
+		return
+	}
+	if conflictFailed(w, err) || validationFailed(w, err) || lockFailed(w, err) {
+		return
+	}
+	if err != nil {
+		log.Printf("Error applying staged changes: %v", err)
+		http.Error(w, "Failed to apply staged changes", http.StatusInternalServerError)
+		return
+	}
+
+	msg := "Applied staged changes"
+	if len(changes) > 0 {
+		msg += ": " + summarise(changes)
+	}
+	h.applyChanges(msg, changes)
+	h.Undo.Applied()
+	h.Events.Publish("config", "")
+
+	if err := h.restartPodsync(); err != nil {
+		log.Printf("Error restarting container: %v", err)
+		http.Error(w, "The staged changes were applied, but reloading the podsync container failed", http.StatusBadGateway)
+		return
+	}
+
+	successMsg := fmt.Sprintf("Applied %d staged change(s) and reloaded '%s'.", len(changes), h.DockerContainerName)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"message": successMsg})
+}
+
+// DiscardDraftHandler throws the staged changes away.
+func (h *Handler) DiscardDraftHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	version, ok := requestVersion(w, r)
+	if !ok {
+		return
+	}
+	err := h.FeedService.DiscardDraft(h.PodsyncConfigPath, version)
+	if errors.Is(err, ErrNoDraft) {
+		http.Error(w, "Nothing is staged", http.StatusNotFound)
+		return
+	}
+	if conflictFailed(w, err) || lockFailed(w, err) {
+		return
+	}
+	if err != nil {
+		log.Printf("Error discarding staged changes: %v", err)
+		http.Error(w, "Failed to discard staged changes", http.StatusInternalServerError)
+		return
+	}
+	h.Undo.Discard()
+	if err := h.Journal.Discard(); err != nil {
+		log.Printf("Error saving change journal: %v", err)
+	}
+	h.Events.Publish("config", "")
+	h.Events.Publish("changelog", "")
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"message": "Staged changes discarded."})
+}
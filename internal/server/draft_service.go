@@ -0,0 +1,235 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/Takenobou/podconfig/internal/atomicfile"
+)
+
+// ErrNoDraft is returned when there are no staged changes to apply or discard.
+var ErrNoDraft = errors.New("no staged changes")
+
+// Feed edits are staged in a draft copy of the config, next to it or in
+// fs.DraftDir, with a small JSON file recording the live content the draft
+// started from and a description of each staged change. Nothing reaches the
+// live config until the draft is applied.
+func (fs *FeedService) draftPath(configPath string) string {
+	return fs.draftFile(configPath, ".draft")
+}
+
+func (fs *FeedService) draftMetaPath(configPath string) string {
+	return fs.draftFile(configPath, ".draft.json")
+}
+
+func (fs *FeedService) draftFile(configPath, suffix string) string {
+	if fs.DraftDir == "" {
+		return configPath + suffix
+	}
+	return filepath.Join(fs.DraftDir, filepath.Base(configPath)+suffix)
+}
+
+// draftMeta describes how a draft came about.
+type draftMeta struct {
+	// Base is the live content the draft was started from.
+	Base    string        `json:"base"`
+	Changes []ChangeEntry `json:"changes"`
+}
+
+// Draft describes the staged changes to the config.
+type Draft struct {
+	Changes []ChangeEntry
+	// Diff is a unified diff from the live config to the draft.
+	Diff string
+	// Stale is set when the live config changed after the draft was started,
+	// so applying the draft would overwrite those changes.
+	Stale bool
+}
+
+// StaleDraftError is returned when applying a draft whose live config has
+// changed since the draft was started.
+type StaleDraftError struct {
+	// Diff is a unified diff from the draft's starting point to the live config.
+	Diff string
+}
+
+func (e *StaleDraftError) Error() string {
+	return "the live config changed since the changes were staged"
+}
+
+// workingPath returns the file edits apply to: the draft if there is one,
+// otherwise the live config.
+func (fs *FeedService) workingPath(configPath string) string {
+	if _, err := os.Stat(fs.draftPath(configPath)); err == nil {
+		return fs.draftPath(configPath)
+	}
+	return configPath
+}
+
+func (fs *FeedService) readDraftMeta(configPath string) (*draftMeta, error) {
+	data, err := os.ReadFile(fs.draftMetaPath(configPath))
+	if os.IsNotExist(err) {
+		return &draftMeta{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	meta := &draftMeta{}
+	if err := json.Unmarshal(data, meta); err != nil {
+		return nil, fmt.Errorf("reading draft: %w", err)
+	}
+	return meta, nil
+}
+
+func (fs *FeedService) writeDraftMeta(configPath string, meta *draftMeta) error {
+	data, err := json.MarshalIndent(meta, "", "  ")
+	if err != nil {
+		return err
+	}
+	return atomicfile.WriteFile(fs.draftMetaPath(configPath), data, 0644)
+}
+
+// writeDraft validates content and stores it as the draft, starting one from
+// the live config if needed. Callers must hold the lock from fs.lock.
+func (fs *FeedService) writeDraft(configPath string, previous, content []byte) error {
+	if err := checkConfig(previous, content); err != nil {
+		return err
+	}
+	if _, err := os.Stat(fs.draftMetaPath(configPath)); os.IsNotExist(err) {
+		live, err := os.ReadFile(configPath)
+		if err != nil {
+			return err
+		}
+		if err := os.MkdirAll(filepath.Dir(fs.draftPath(configPath)), 0755); err != nil {
+			return fmt.Errorf("starting draft: %w", err)
+		}
+		if err := fs.writeDraftMeta(configPath, &draftMeta{Base: string(live)}); err != nil {
+			return fmt.Errorf("starting draft: %w", err)
+		}
+	}
+	err := atomicfile.WriteFile(fs.draftPath(configPath), content, 0644)
+	fs.invalidateCache()
+	if err != nil {
+		return err
+	}
+	fs.rememberVersion(content)
+	return nil
+}
+
+// NoteDraftChange adds a description of a staged change to the draft.
+func (fs *FeedService) NoteDraftChange(configPath string, entry ChangeEntry) error {
+	unlock, err := fs.lock(configPath)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	meta, err := fs.readDraftMeta(configPath)
+	if err != nil {
+		return err
+	}
+	meta.Changes = append(meta.Changes, entry)
+	return fs.writeDraftMeta(configPath, meta)
+}
+
+// GetDraft returns the staged changes, or nil if nothing is staged.
+func (fs *FeedService) GetDraft(configPath string) (*Draft, error) {
+	fs.mu.RLock()
+	defer fs.mu.RUnlock()
+
+	content, err := os.ReadFile(fs.draftPath(configPath))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	meta, err := fs.readDraftMeta(configPath)
+	if err != nil {
+		return nil, err
+	}
+	live, err := os.ReadFile(configPath)
+	if err != nil {
+		return nil, err
+	}
+	return &Draft{
+		Changes: meta.Changes,
+		Diff:    configDiff("config.toml", "config.toml (staged)", live, content),
+		Stale:   meta.Base != "" && meta.Base != string(live),
+	}, nil
+}
+
+// ApplyDraft validates the draft and writes it as the live config, then
+// removes it. It returns the applied changes. If version is set, the draft
+// must still match it.
+func (fs *FeedService) ApplyDraft(configPath string, version string) ([]ChangeEntry, error) {
+	unlock, err := fs.lock(configPath)
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+
+	content, err := os.ReadFile(fs.draftPath(configPath))
+	if os.IsNotExist(err) {
+		return nil, ErrNoDraft
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := fs.checkVersion(version, content); err != nil {
+		return nil, err
+	}
+	meta, err := fs.readDraftMeta(configPath)
+	if err != nil {
+		return nil, err
+	}
+	live, err := os.ReadFile(configPath)
+	if err != nil {
+		return nil, err
+	}
+	if meta.Base != "" && meta.Base != string(live) {
+		return nil, &StaleDraftError{Diff: configDiff("config.toml (staged from)", "config.toml (live)", []byte(meta.Base), live)}
+	}
+	if err := fs.writeConfig(configPath, live, content); err != nil {
+		return nil, err
+	}
+	return meta.Changes, fs.removeDraft(configPath)
+}
+
+// DiscardDraft throws the staged changes away. If version is set, the draft
+// must still match it.
+func (fs *FeedService) DiscardDraft(configPath string, version string) error {
+	unlock, err := fs.lock(configPath)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	content, err := os.ReadFile(fs.draftPath(configPath))
+	if os.IsNotExist(err) {
+		return ErrNoDraft
+	}
+	if err != nil {
+		return err
+	}
+	if err := fs.checkVersion(version, content); err != nil {
+		return err
+	}
+	return fs.removeDraft(configPath)
+}
+
+// removeDraft deletes the draft and its description. Callers must hold the
+// lock from fs.lock.
+func (fs *FeedService) removeDraft(configPath string) error {
+	defer fs.invalidateCache()
+	if err := os.Remove(fs.draftPath(configPath)); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	if err := os.Remove(fs.draftMetaPath(configPath)); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,158 @@
+package server
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/Takenobou/podconfig/internal/podsync"
+)
+
+func TestDraftLifecycle(t *testing.T) {
+	const external = "\n# edited by hand\n"
+	tests := []struct {
+		name     string
+		draftDir bool
+		// external is appended to the live config after staging.
+		external bool
+		// finish applies or discards the draft, or neither when empty.
+		finish  string
+		version func(staged string) string
+		wantErr func(err error) bool
+		// wantLive reports whether the live config must hold the staged edit.
+		wantLive  bool
+		wantDraft bool
+		wantStale bool
+	}{
+		{name: "staged", wantDraft: true},
+		{name: "staged in DraftDir", draftDir: true, wantDraft: true},
+		{name: "applied", finish: "apply", wantLive: true},
+		{name: "applied from DraftDir", draftDir: true, finish: "apply", wantLive: true},
+		{name: "applied at its version", finish: "apply", version: func(v string) string { return v }, wantLive: true},
+		{name: "discarded", finish: "discard"},
+		{
+			name:      "apply at another version",
+			finish:    "apply",
+			version:   func(string) string { return "0123456789abcdef" },
+			wantErr:   func(err error) bool { var c *ConflictError; return errors.As(err, &c) },
+			wantDraft: true,
+		},
+		{
+			name:      "discard at another version",
+			finish:    "discard",
+			version:   func(string) string { return "0123456789abcdef" },
+			wantErr:   func(err error) bool { var c *ConflictError; return errors.As(err, &c) },
+			wantDraft: true,
+		},
+		{name: "stale", external: true, wantDraft: true, wantStale: true},
+		{
+			name:     "stale apply refused",
+			external: true,
+			finish:   "apply",
+			wantErr: func(err error) bool {
+				var stale *StaleDraftError
+				return errors.As(err, &stale) && strings.Contains(stale.Diff, "+# edited by hand")
+			},
+			wantDraft: true,
+			wantStale: true,
+		},
+		{name: "stale discard", external: true, finish: "discard"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := writeTestConfig(t, twoFeedsConfig)
+			fs := &FeedService{}
+			if tt.draftDir {
+				fs.DraftDir = filepath.Join(t.TempDir(), "drafts")
+			}
+			if _, err := fs.ModifyFeed(path, "", "news", func(feed *podsync.Feed) error {
+				feed.PageSize = 20
+				return nil
+			}); err != nil {
+				t.Fatalf("ModifyFeed: %v", err)
+			}
+			if err := fs.NoteDraftChange(path, ChangeEntry{ID: "c1", Message: "Modified feed news"}); err != nil {
+				t.Fatal(err)
+			}
+			staged := readTestFile(t, fs.draftPath(path))
+			if !strings.Contains(staged, "page_size = 20") {
+				t.Fatalf("draft does not hold the edit:\n%s", staged)
+			}
+			if tt.draftDir && filepath.Dir(fs.draftPath(path)) != fs.DraftDir {
+				t.Errorf("draft at %s, want it in %s", fs.draftPath(path), fs.DraftDir)
+			}
+			live := twoFeedsConfig
+			if tt.external {
+				live += external
+				if err := os.WriteFile(path, []byte(live), 0644); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			version := ""
+			if tt.version != nil {
+				version = tt.version(configVersion([]byte(staged)))
+			}
+			var err error
+			switch tt.finish {
+			case "apply":
+				var changes []ChangeEntry
+				changes, err = fs.ApplyDraft(path, version)
+				if err == nil && (len(changes) != 1 || changes[0].ID != "c1") {
+					t.Errorf("applied changes = %+v, want the noted change", changes)
+				}
+			case "discard":
+				err = fs.DiscardDraft(path, version)
+			}
+			if tt.wantErr == nil && err != nil || tt.wantErr != nil && !tt.wantErr(err) {
+				t.Fatalf("%s error = %v", tt.finish, err)
+			}
+
+			got := readTestFile(t, path)
+			if tt.wantLive {
+				live = staged
+			}
+			if got != live {
+				t.Errorf("live config =\n%s\nwant\n%s", got, live)
+			}
+			draft, err := fs.GetDraft(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if (draft != nil) != tt.wantDraft {
+				t.Fatalf("draft = %+v, want one: %v", draft, tt.wantDraft)
+			}
+			if draft == nil {
+				if fs.workingPath(path) != path {
+					t.Errorf("edits go to %s, want the live config", fs.workingPath(path))
+				}
+				if _, err := os.Stat(fs.draftMetaPath(path)); !os.IsNotExist(err) {
+					t.Errorf("draft description left behind: %v", err)
+				}
+				return
+			}
+			if draft.Stale != tt.wantStale {
+				t.Errorf("Stale = %v, want %v", draft.Stale, tt.wantStale)
+			}
+			if len(draft.Changes) != 1 || !strings.Contains(draft.Diff, "+  page_size = 20 # keep it short") {
+				t.Errorf("draft changes %+v, diff:\n%s", draft.Changes, draft.Diff)
+			}
+		})
+	}
+}
+
+func TestNoDraft(t *testing.T) {
+	path := writeTestConfig(t, twoFeedsConfig)
+	fs := &FeedService{}
+	if draft, err := fs.GetDraft(path); draft != nil || err != nil {
+		t.Errorf("GetDraft = %+v, %v; want nothing staged", draft, err)
+	}
+	if _, err := fs.ApplyDraft(path, ""); !errors.Is(err, ErrNoDraft) {
+		t.Errorf("ApplyDraft error = %v, want ErrNoDraft", err)
+	}
+	if err := fs.DiscardDraft(path, ""); !errors.Is(err, ErrNoDraft) {
+		t.Errorf("DiscardDraft error = %v, want ErrNoDraft", err)
+	}
+}
@@ -0,0 +1,61 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net/http"
+	"os"
+	"time"
+)
+
+// DriftHandler shows how the current config differs from the one podsync was
+// last reloaded with, and whether the container predates the config file.
+func (h *Handler) DriftHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	current, err := os.ReadFile(h.PodsyncConfigPath)
+	if err != nil {
+		log.Printf("Error reading config: %v", err)
+		http.Error(w, "Failed to read config", http.StatusInternalServerError)
+		return
+	}
+	info, err := os.Stat(h.PodsyncConfigPath)
+	if err != nil {
+		log.Printf("Error reading config: %v", err)
+		http.Error(w, "Failed to read config", http.StatusInternalServerError)
+		return
+	}
+
+	drift := &Drift{ConfigModified: info.ModTime()}
+	applied, appliedAt, err := h.Snapshots.Load()
+	switch {
+	case errors.Is(err, ErrNoSnapshot):
+	case err != nil:
+		log.Printf("Error reading applied snapshot: %v", err)
+		http.Error(w, "Failed to read applied snapshot", http.StatusInternalServerError)
+		return
+	default:
+		drift.AppliedAt = appliedAt
+		drift.Changes, drift.OtherChanges, err = configDrift(applied, current)
+		if err != nil {
+			log.Printf("Error comparing applied snapshot: %v", err)
+			http.Error(w, "Failed to compare with the applied config: "+err.Error(), http.StatusUnprocessableEntity)
+			return
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+	drift.ContainerStarted, err = h.containerStartedAt(ctx)
+	if err != nil {
+		drift.ContainerError = err.Error()
+	}
+
+	w.Header().Set("Content-Type", "text/html")
+	if err := tmpl.ExecuteTemplate(w, "drift", drift); err != nil {
+		http.Error(w, "Template error", http.StatusInternalServerError)
+	}
+}
@@ -0,0 +1,111 @@
+package server
+
+import (
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// eventKeepAlive is how often an idle event stream gets a comment line, so
+// proxies do not time it out.
+const eventKeepAlive = 30 * time.Second
+
+// event is a single server-sent event.
+type event struct {
+	Name string
+	Data string
+}
+
+// Events fans out server-sent events to every open page.
+type Events struct {
+	mu     sync.Mutex
+	subs   map[chan event]struct{}
+	closed chan struct{}
+}
+
+// NewEvents returns an Events with no subscribers.
+func NewEvents() *Events {
+	return &Events{
+		subs:   make(map[chan event]struct{}),
+		closed: make(chan struct{}),
+	}
+}
+
+// Publish sends an event to every subscriber. Subscribers that are not keeping
+// up miss the event rather than blocking the caller. Publish on a nil Events
+// does nothing.
+func (e *Events) Publish(name, data string) {
+	if e == nil {
+		return
+	}
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	for ch := range e.subs {
+		select {
+		case ch <- event{Name: name, Data: data}:
+		default:
+		}
+	}
+}
+
+// Close ends every open event stream, so server shutdown does not wait on them.
+func (e *Events) Close() {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	select {
+	case <-e.closed:
+	default:
+		close(e.closed)
+	}
+}
+
+func (e *Events) subscribe() chan event {
+	ch := make(chan event, 8)
+	e.mu.Lock()
+	e.subs[ch] = struct{}{}
+	e.mu.Unlock()
+	return ch
+}
+
+func (e *Events) unsubscribe(ch chan event) {
+	e.mu.Lock()
+	delete(e.subs, ch)
+	e.mu.Unlock()
+}
+
+// EventsHandler streams config and changelog updates as server-sent events.
+func (h *Handler) EventsHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	flusher, ok := w.(http.Flusher)
+	if h.Events == nil || !ok {
+		http.Error(w, "Live updates are not available", http.StatusNotFound)
+		return
+	}
+	ch := h.Events.subscribe()
+	defer h.Events.unsubscribe(ch)
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	fmt.Fprint(w, "retry: 5000\n\n")
+	flusher.Flush()
+
+	keepAlive := time.NewTicker(eventKeepAlive)
+	defer keepAlive.Stop()
+	for {
+		select {
+		case ev := <-ch:
+			fmt.Fprintf(w, "event: %s\ndata: %s\n\n", ev.Name, ev.Data)
+		case <-keepAlive.C:
+			fmt.Fprint(w, ": keep-alive\n\n")
+		case <-r.Context().Done():
+			return
+		case <-h.Events.closed:
+			return
+		}
+		flusher.Flush()
+	}
+}
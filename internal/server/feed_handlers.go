@@ -3,15 +3,18 @@ package server
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"html/template"
 	"log"
 	"net/http"
-	"os"
+	"net/url"
 	"strconv"
+	"strings"
 
+	"github.com/Takenobou/podconfig/internal/filelock"
+	"github.com/Takenobou/podconfig/internal/podsync"
 	"github.com/Takenobou/podconfig/web"
-	"github.com/pelletier/go-toml/v2"
 )
 
 // Replace template initialization to use web.Templates()
@@ -38,6 +41,7 @@ func init() {
 				}
 				return dict, nil
 			},
+			"join": strings.Join,
 		}).ParseFS(fs, "*.html"))
 }
 
@@ -59,20 +63,59 @@ type FeedListItem struct {
 	Format        string
 	MaxAge        string
 	CleanKeepLast string
+	// CronSchedule, when set, is used instead of UpdatePeriod.
+	CronSchedule string
+	Quality      string
+	PageSize     string
+	MaxHeight    string
+	PlaylistSort string
+	OPML         bool
+	PrivateFeed  bool
+	// Episode filters; the patterns are regular expressions, durations are
+	// in seconds and ages in days.
+	FilterTitle          string
+	FilterNotTitle       string
+	FilterDescription    string
+	FilterNotDescription string
+	MinDuration          string
+	MaxDuration          string
+	MinAge               string
+	// Custom is the podcast metadata shown in place of the channel's.
+	Custom podsync.Custom
 }
 
-// Index handles the main page rendering.
-func (h *Handler) Index(w http.ResponseWriter, r *http.Request) {
-	feedList, err := h.FeedService.GetFeedList(h.PodsyncConfigPath)
+// loadFeedList returns the template data for the feed list: the feeds, the
+// config version they came from and whether server.hostname is missing. If
+// the config cannot be read, the list is empty and ConfigError gives the
+// reason, so the page can show it instead of hiding feeds.
+func (h *Handler) loadFeedList() map[string]interface{} {
+	feedList, version, err := h.FeedService.GetFeedList(h.PodsyncConfigPath)
 	if err != nil {
 		log.Printf("Error reading feed list: %v", err)
-		feedList = []FeedListItem{}
+		return map[string]interface{}{
+			"Feeds":       []FeedListItem{},
+			"Version":     version,
+			"ConfigError": err.Error(),
+		}
 	}
-	data := map[string]interface{}{
-		"Message":        r.URL.Query().Get("message"),
-		"Feeds":          feedList,
-		"PendingChanges": h.getChanges(),
+	hostnameMissing := false
+	if cfg, _, err := h.FeedService.WorkingConfig(h.PodsyncConfigPath); err == nil {
+		hostnameMissing = cfg.Server.Hostname == ""
+	}
+	return map[string]interface{}{
+		"Feeds":           feedList,
+		"Version":         version,
+		"ConfigError":     "",
+		"HostnameMissing": hostnameMissing,
 	}
+}
+
+// Index handles the main page rendering.
+func (h *Handler) Index(w http.ResponseWriter, r *http.Request) {
+	data := h.loadFeedList()
+	data["Message"] = r.URL.Query().Get("message")
+	data["PendingChanges"] = h.getChanges()
+	data["HistoryEnabled"] = h.History != nil
 	if err := tmpl.ExecuteTemplate(w, "index", data); err != nil {
 		log.Printf("Error executing template: %v", err)
 	}
@@ -89,25 +132,41 @@ func (h *Handler) AddFeedHandler(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "YouTube URL is required", http.StatusBadRequest)
 		return
 	}
-	updatePeriod := r.FormValue("update_period")
-	if updatePeriod == "" {
-		updatePeriod = "1h"
+	version, ok := requestVersion(w, r)
+	if !ok {
+		return
 	}
 	feedFormat := r.FormValue("format")
 	if feedFormat == "" {
 		feedFormat = "video"
 	}
-	cleanKeepLast := 20
-	if val := r.FormValue("clean_keep_last"); val != "" {
-		if v, err := strconv.Atoi(val); err == nil {
-			cleanKeepLast = v
-		}
+	cleanKeepLast, err := optionalInt(r.FormValue("clean_keep_last"))
+	if err != nil {
+		http.Error(w, "clean_keep_last must be a number", http.StatusBadRequest)
+		return
 	}
-	maxAge := 90
-	if val := r.FormValue("max_age"); val != "" {
-		if v, err := strconv.Atoi(val); err == nil {
-			maxAge = v
-		}
+	maxAge, err := optionalInt(r.FormValue("max_age"))
+	if err != nil {
+		http.Error(w, "max_age must be a number", http.StatusBadRequest)
+		return
+	}
+	newFeed := DefaultFeed(feedFormat)
+	if val := r.FormValue("update_period"); val != "" {
+		newFeed.UpdatePeriod = val
+	}
+	if cleanKeepLast != nil {
+		newFeed.Clean.KeepLast = *cleanKeepLast
+	}
+	if maxAge != nil {
+		newFeed.Filters.MaxAge = *maxAge
+	}
+	// Fields left empty keep the defaults for the format.
+	form := &settingsForm{values: nonEmpty(r.PostForm)}
+	setSchedule(newFeed, form)
+	setFeedOptions(newFeed, form)
+	setFilters(&newFeed.Filters, form)
+	if fieldFailed(w, form.err) {
+		return
 	}
 	feed, err := h.FeedService.FetchChannelInfo(youtubeUrl)
 	if err != nil {
@@ -115,19 +174,23 @@ func (h *Handler) AddFeedHandler(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "Failed to fetch channel info", http.StatusInternalServerError)
 		return
 	}
-	err = h.FeedService.AppendFeedToConfig(h.PodsyncConfigPath, feed, updatePeriod, feedFormat, cleanKeepLast, maxAge)
+	change, err := h.FeedService.AppendFeedToConfig(h.PodsyncConfigPath, version, feed, newFeed)
+	if conflictFailed(w, err) || validationFailed(w, err) || lockFailed(w, err) {
+		return
+	}
 	if err != nil {
 		log.Printf("Error updating config: %v", err)
 		http.Error(w, "Failed to update config", http.StatusInternalServerError)
 		return
 	}
 
-	h.addChange(fmt.Sprintf("Added feed '%s'", feed.FeedKey))
+	entry := newFeedEntry(r, OpAdd, change, fmt.Sprintf("Added feed '%s'", feed.FeedKey))
+	h.stageFeedChange(entry)
 
-	successMsg := fmt.Sprintf("Feed for channel '%s' added successfully!", feed.ChannelName)
+	successMsg := fmt.Sprintf("Feed for channel '%s' staged. Apply the staged changes to add it.", feed.ChannelName)
 	if r.Header.Get("X-Requested-With") == "XMLHttpRequest" {
 		w.Header().Set("Content-Type", "application/json")
-		json.NewEncoder(w).Encode(map[string]string{"message": successMsg})
+		json.NewEncoder(w).Encode(map[string]string{"message": successMsg, "undo": entry.ID})
 		return
 	}
 	data := map[string]interface{}{
@@ -147,49 +210,31 @@ func (h *Handler) RemoveFeedHandler(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "feedKey is required", http.StatusBadRequest)
 		return
 	}
-	content, err := os.ReadFile(h.PodsyncConfigPath)
-	if err != nil {
-		log.Printf("Error reading config: %v", err)
-		http.Error(w, "Failed to read config", http.StatusInternalServerError)
-		return
-	}
-	var config map[string]interface{}
-	err = toml.Unmarshal(content, &config)
-	if err != nil {
-		log.Printf("Error unmarshalling config: %v", err)
-		http.Error(w, "Failed to parse config", http.StatusInternalServerError)
-		return
-	}
-	feeds, ok := config["feeds"].(map[string]interface{})
+	version, ok := requestVersion(w, r)
 	if !ok {
-		http.Error(w, "No feeds found", http.StatusInternalServerError)
 		return
 	}
-	if _, exists := feeds[feedKey]; !exists {
+	change, err := h.FeedService.RemoveFeed(h.PodsyncConfigPath, version, feedKey)
+	if errors.Is(err, ErrFeedNotFound) {
 		http.Error(w, "Feed not found", http.StatusNotFound)
 		return
 	}
-	delete(feeds, feedKey)
-	config["feeds"] = feeds
-	newContent, err := toml.Marshal(config)
-	if err != nil {
-		log.Printf("Error marshalling config: %v", err)
-		http.Error(w, "Failed to update config", http.StatusInternalServerError)
+	if conflictFailed(w, err) || validationFailed(w, err) || lockFailed(w, err) {
 		return
 	}
-	err = os.WriteFile(h.PodsyncConfigPath, newContent, 0644)
 	if err != nil {
-		log.Printf("Error writing config: %v", err)
-		http.Error(w, "Failed to write config", http.StatusInternalServerError)
+		log.Printf("Error removing feed: %v", err)
+		http.Error(w, "Failed to update config", http.StatusInternalServerError)
 		return
 	}
 
-	h.addChange(fmt.Sprintf("Removed feed '%s'", feedKey))
+	entry := newFeedEntry(r, OpRemove, change, fmt.Sprintf("Removed feed '%s'", feedKey))
+	h.stageFeedChange(entry)
 
-	successMsg := fmt.Sprintf("Feed for channel '%s' removed successfully!", feedKey)
+	successMsg := fmt.Sprintf("Removal of feed '%s' staged. Apply the staged changes to remove it.", feedKey)
 	if r.Header.Get("X-Requested-With") == "XMLHttpRequest" {
 		w.Header().Set("Content-Type", "application/json")
-		json.NewEncoder(w).Encode(map[string]string{"message": successMsg})
+		json.NewEncoder(w).Encode(map[string]string{"message": successMsg, "undo": entry.ID})
 		return
 	}
 	data := map[string]interface{}{
@@ -200,20 +245,28 @@ func (h *Handler) RemoveFeedHandler(w http.ResponseWriter, r *http.Request) {
 
 // FeedListHandler returns the list of feeds in HTML (partial).
 func (h *Handler) FeedListHandler(w http.ResponseWriter, r *http.Request) {
-	feedList, err := h.FeedService.GetFeedList(h.PodsyncConfigPath)
-	if err != nil {
-		http.Error(w, "Failed to load feed list", http.StatusInternalServerError)
-		return
-	}
-	data := map[string]interface{}{
-		"Feeds": feedList,
-	}
+	data := h.loadFeedList()
 	w.Header().Set("Content-Type", "text/html")
+	if version := data["Version"].(string); version != "" {
+		w.Header().Set("ETag", `"`+version+`"`)
+	}
 	if err := tmpl.ExecuteTemplate(w, "feedList", data); err != nil {
 		http.Error(w, "Template error", http.StatusInternalServerError)
 	}
 }
 
+// CategoriesHandler returns the Apple Podcasts categories and their
+// subcategories, the only values accepted for custom.category and
+// custom.subcategories.
+func (h *Handler) CategoriesHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(podsync.Categories)
+}
+
 // ModifyFeedHandler handles updating an existing feed.
 func (h *Handler) ModifyFeedHandler(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPost {
@@ -225,36 +278,62 @@ func (h *Handler) ModifyFeedHandler(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "feedKey is required", http.StatusBadRequest)
 		return
 	}
-	updates := make(map[string]interface{})
-	if updatePeriod := r.FormValue("update_period"); updatePeriod != "" {
-		updates["update_period"] = updatePeriod
+	version, ok := requestVersion(w, r)
+	if !ok {
+		return
 	}
-	if feedFormat := r.FormValue("format"); feedFormat != "" {
-		updates["format"] = feedFormat
+	updatePeriod := r.FormValue("update_period")
+	feedFormat := r.FormValue("format")
+	cleanKeepLast, err := optionalInt(r.FormValue("clean_keep_last"))
+	if err != nil {
+		http.Error(w, "clean_keep_last must be a number", http.StatusBadRequest)
+		return
 	}
-	if cleanKeepLastStr := r.FormValue("clean_keep_last"); cleanKeepLastStr != "" {
-		if v, err := strconv.Atoi(cleanKeepLastStr); err == nil {
-			updates["clean"] = map[string]interface{}{"keep_last": v}
-		}
+	maxAge, err := optionalInt(r.FormValue("max_age"))
+	if err != nil {
+		http.Error(w, "max_age must be a number", http.StatusBadRequest)
+		return
 	}
-	if maxAgeStr := r.FormValue("max_age"); maxAgeStr != "" {
-		if v, err := strconv.Atoi(maxAgeStr); err == nil {
-			updates["filters"] = map[string]interface{}{"max_age": v}
+	change, err := h.FeedService.ModifyFeed(h.PodsyncConfigPath, version, feedKey, func(feed *podsync.Feed) error {
+		if updatePeriod != "" {
+			feed.UpdatePeriod = updatePeriod
+		}
+		if feedFormat != "" {
+			feed.Format = feedFormat
 		}
+		if cleanKeepLast != nil {
+			feed.Clean.KeepLast = *cleanKeepLast
+		}
+		if maxAge != nil {
+			feed.Filters.MaxAge = *maxAge
+		}
+		form := &settingsForm{values: r.PostForm}
+		setSchedule(feed, form)
+		setFeedOptions(feed, form)
+		setFilters(&feed.Filters, form)
+		setCustom(&feed.Custom, form)
+		return form.err
+	})
+	if errors.Is(err, ErrFeedNotFound) {
+		http.Error(w, "Feed not found", http.StatusNotFound)
+		return
+	}
+	if fieldFailed(w, err) || conflictFailed(w, err) || validationFailed(w, err) || lockFailed(w, err) {
+		return
 	}
-	err := h.FeedService.ModifyFeed(h.PodsyncConfigPath, feedKey, updates)
 	if err != nil {
 		log.Printf("Error modifying feed: %v", err)
 		http.Error(w, "Failed to modify feed", http.StatusInternalServerError)
 		return
 	}
 
-	h.addChange(fmt.Sprintf("Modified feed '%s'", feedKey))
+	entry := newFeedEntry(r, OpModify, change, fmt.Sprintf("Modified feed '%s'", feedKey))
+	h.stageFeedChange(entry)
 
-	successMsg := fmt.Sprintf("Feed '%s' modified successfully!.", feedKey)
+	successMsg := fmt.Sprintf("Changes to feed '%s' staged. Apply the staged changes to save them.", feedKey)
 	if r.Header.Get("X-Requested-With") == "XMLHttpRequest" {
 		w.Header().Set("Content-Type", "application/json")
-		json.NewEncoder(w).Encode(map[string]string{"message": successMsg})
+		json.NewEncoder(w).Encode(map[string]string{"message": successMsg, "undo": entry.ID})
 		return
 	}
 	data := map[string]interface{}{
@@ -263,14 +342,178 @@ func (h *Handler) ModifyFeedHandler(w http.ResponseWriter, r *http.Request) {
 	tmpl.ExecuteTemplate(w, "index", data)
 }
 
-// ChangelogHandler returns the minimal changelog partial
+// optionalInt parses an optional numeric form value; an empty value yields nil.
+func optionalInt(val string) (*int, error) {
+	if val == "" {
+		return nil, nil
+	}
+	v, err := strconv.Atoi(val)
+	if err != nil {
+		return nil, err
+	}
+	return &v, nil
+}
+
+// setSchedule applies the cron_schedule field and the schedule mode, which
+// picks between an update_period interval and a cron_schedule and removes the
+// other, since podsync ignores update_period while cron_schedule is set.
+func setSchedule(f *podsync.Feed, form *settingsForm) {
+	form.String("cron_schedule", &f.CronSchedule)
+	mode, ok := form.value("schedule")
+	if !ok {
+		return
+	}
+	switch mode {
+	case "interval":
+		f.CronSchedule = ""
+	case "cron":
+		if f.CronSchedule == "" {
+			form.fail("cron_schedule", "is required when schedule is cron")
+			return
+		}
+		f.UpdatePeriod = ""
+	default:
+		form.fail("schedule", "must be interval or cron")
+	}
+}
+
+// setFeedOptions applies the download and publishing fields that were sent.
+func setFeedOptions(f *podsync.Feed, form *settingsForm) {
+	form.String("quality", &f.Quality)
+	form.Int("page_size", &f.PageSize)
+	form.Int("max_height", &f.MaxHeight)
+	form.String("playlist_sort", &f.PlaylistSort)
+	form.Bool("opml", &f.OPML)
+	form.Bool("private_feed", &f.PrivateFeed)
+}
+
+// setFilters applies the filters.* fields that were sent. Unlike the older
+// max_age field, an empty value clears the filter.
+func setFilters(f *podsync.Filters, form *settingsForm) {
+	form.Regex("filters.title", &f.Title)
+	form.Regex("filters.not_title", &f.NotTitle)
+	form.Regex("filters.description", &f.Description)
+	form.Regex("filters.not_description", &f.NotDescription)
+	form.Int64("filters.min_duration", &f.MinDuration)
+	form.Int64("filters.max_duration", &f.MaxDuration)
+	form.Int("filters.min_age", &f.MinAge)
+}
+
+// setCustom applies the custom.* fields that were sent; an empty value
+// removes the setting, so podsync falls back to the channel's own.
+func setCustom(c *podsync.Custom, form *settingsForm) {
+	form.String("custom.title", &c.Title)
+	form.String("custom.description", &c.Description)
+	form.String("custom.author", &c.Author)
+	form.String("custom.cover_art", &c.CoverArt)
+	form.String("custom.cover_art_quality", &c.CoverArtQuality)
+	form.String("custom.category", &c.Category)
+	form.List("custom.subcategories", &c.Subcategories)
+	form.Bool("custom.explicit", &c.Explicit)
+	form.String("custom.lang", &c.Lang)
+	form.String("custom.link", &c.Link)
+	form.String("custom.ownerName", &c.OwnerName)
+	form.String("custom.ownerEmail", &c.OwnerEmail)
+}
+
+// nonEmpty returns the form values without the fields that were left empty.
+func nonEmpty(values url.Values) url.Values {
+	kept := url.Values{}
+	for name, vals := range values {
+		if len(vals) > 0 && strings.TrimSpace(vals[0]) != "" {
+			kept[name] = vals
+		}
+	}
+	return kept
+}
+
+// requestVersion returns the config version the client based its change on,
+// taken from the If-Match header or the version form field. An If-Match of *
+// skips the check. When neither is given it responds 428 and returns false.
+func requestVersion(w http.ResponseWriter, r *http.Request) (string, bool) {
+	version := r.Header.Get("If-Match")
+	if version == "" {
+		version = r.FormValue("version")
+	}
+	version = strings.Trim(strings.TrimPrefix(version, "W/"), `"`)
+	switch version {
+	case "":
+		http.Error(w, "If-Match header or version field is required; load /feeds for the current version", http.StatusPreconditionRequired)
+		return "", false
+	case "*":
+		return "", true
+	}
+	return version, true
+}
+
+// conflictFailed writes a 409 response with the changes made since the
+// client's version, or since a draft was started, if err is a conflict, and
+// reports whether it did.
+func conflictFailed(w http.ResponseWriter, err error) bool {
+	var stale *StaleDraftError
+	if errors.As(err, &stale) {
+		log.Printf("Rejected stale draft: %v", err)
+		http.Error(w, "The live config changed since these changes were staged. Discard them and stage them again.\n\n"+stale.Diff, http.StatusConflict)
+		return true
+	}
+	var conflict *ConflictError
+	if !errors.As(err, &conflict) {
+		return false
+	}
+	log.Printf("Rejected stale write: %v", err)
+	msg := "The config changed since you loaded it. Reload the feed list and try again."
+	if conflict.Diff != "" {
+		msg += "\n\n" + conflict.Diff
+	}
+	w.Header().Set("ETag", `"`+conflict.Current+`"`)
+	http.Error(w, msg, http.StatusConflict)
+	return true
+}
+
+// lockFailed writes a 503 response if err is a timeout waiting for the config
+// lock, and reports whether it did.
+func lockFailed(w http.ResponseWriter, err error) bool {
+	if !errors.Is(err, filelock.ErrTimeout) {
+		return false
+	}
+	log.Printf("Error locking config: %v", err)
+	w.Header().Set("Retry-After", "5")
+	http.Error(w, "The config is locked by another process; try again shortly.", http.StatusServiceUnavailable)
+	return true
+}
+
+// ChangelogHandler returns the minimal changelog partial, listing the staged
+// and applied changes recorded in the journal.
 func (h *Handler) ChangelogHandler(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodGet {
 		http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
 		return
 	}
+	draft, err := h.FeedService.GetDraft(h.PodsyncConfigPath)
+	if err != nil {
+		log.Printf("Error reading staged changes: %v", err)
+	}
+	undoable, redo := h.Undo.IDs()
+	pending := h.getChanges()
+	// Applied operations podsync has been reloaded with are no longer
+	// pending, but can still be undone.
+	listed := map[string]bool{}
+	for _, e := range pending {
+		listed[e.ID] = true
+	}
+	var earlier []ChangeEntry
+	for _, e := range h.Undo.AppliedUndoable() {
+		if !listed[e.ID] {
+			earlier = append(earlier, e)
+		}
+	}
 	data := map[string]interface{}{
-		"PendingChanges": h.getChanges(),
+		"Draft":          draft,
+		"StagedChanges":  h.getStagedChanges(),
+		"PendingChanges": pending,
+		"AppliedEarlier": earlier,
+		"Undoable":       undoable,
+		"Redo":           redo,
 	}
 	w.Header().Set("Content-Type", "text/html")
 	if err := tmpl.ExecuteTemplate(w, "changelogOnly", data); err != nil {
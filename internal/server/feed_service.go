@@ -2,97 +2,320 @@
 package server
 
 import (
+	"errors"
 	"fmt"
+	"log"
 	"net/http"
 	"os"
 	"sort"
+	"strconv"
 	"strings"
 	"sync"
+	"time"
 
 	"github.com/PuerkitoBio/goquery"
-	"github.com/pelletier/go-toml/v2"
+	"github.com/Takenobou/podconfig/internal/atomicfile"
+	"github.com/Takenobou/podconfig/internal/filelock"
+	"github.com/Takenobou/podconfig/internal/podsync"
+	"github.com/Takenobou/podconfig/internal/tomledit"
 )
 
+// ErrFeedNotFound is returned when a feed key does not exist in the configuration.
+var ErrFeedNotFound = errors.New("feed not found")
+
+// ErrFeedChanged is returned when a feed is not in the state an undo or redo
+// expects, because it was changed again since.
+var ErrFeedChanged = errors.New("feed has changed since")
+
+// errRawMismatch is returned when a removed feed's TOML can no longer be put
+// back as written.
+var errRawMismatch = errors.New("removed feed no longer matches its TOML")
+
 // FeedService provides business logic for managing feeds.
 type FeedService struct {
-	mu sync.Mutex
+	// mu is held for writing around every read-modify-write of the config,
+	// and for reading by readers of the cached parse.
+	mu sync.RWMutex
+
+	// cacheMu guards the fields below, which readers update concurrently.
+	cacheMu sync.Mutex
+	cache   *configCache
+	// versions holds recently served config contents by version, oldest first
+	// in versionOrder.
+	versions     map[string][]byte
+	versionOrder []string
+	// lastWritten is the version of the most recent write by this process.
+	lastWritten string
+
+	// LockPath is the lock file shared with other processes editing the
+	// config; the config's path with ".lock" appended if empty.
+	LockPath string
+	// LockTimeout is how long a write waits for another process holding the
+	// config's lock file.
+	LockTimeout time.Duration
+
+	// Backups, when set, receives a copy of the config before every write.
+	Backups *BackupService
+	// DraftDir holds the staged draft of the config; the config's own
+	// directory if empty.
+	DraftDir string
 }
 
-// GetFeedList returns the list of feeds from the configuration file.
-func (fs *FeedService) GetFeedList(configPath string) ([]FeedListItem, error) {
+// lock serialises read-modify-write cycles on the config, both within this
+// process and with other processes honouring the sidecar lock file. Callers
+// must call the returned function to release it.
+func (fs *FeedService) lock(configPath string) (func(), error) {
+	// The file lock also excludes other writers in this process, so waiting
+	// for it first keeps readers unblocked until the write itself.
+	path := fs.LockPath
+	if path == "" {
+		path = configPath + ".lock"
+	}
+	l, err := filelock.Acquire(path, fs.LockTimeout)
+	if err != nil {
+		return nil, err
+	}
 	fs.mu.Lock()
-	defer fs.mu.Unlock()
+	return func() {
+		fs.mu.Unlock()
+		if err := l.Release(); err != nil {
+			log.Printf("Error releasing config lock: %v", err)
+		}
+	}, nil
+}
 
-	content, err := os.ReadFile(configPath)
+// updateConfig applies edit to the working copy of the configuration (the
+// draft, or the live file when nothing is staged) and stages the result.
+// Only the tables and keys touched by edit change; comments and layout are kept.
+// If version is set and the working copy no longer matches it, nothing is
+// written and a *ConflictError is returned. Callers must hold the lock from
+// fs.lock.
+func (fs *FeedService) updateConfig(configPath string, version string, edit func(doc *tomledit.Document) error) error {
+	content, err := os.ReadFile(fs.workingPath(configPath))
 	if err != nil {
-		return nil, err
+		return err
 	}
-	var config map[string]interface{}
-	if err := toml.Unmarshal(content, &config); err != nil {
-		return nil, err
+	if err := fs.checkVersion(version, content); err != nil {
+		return err
+	}
+	doc, err := tomledit.Parse(content)
+	if err != nil {
+		return err
 	}
+	if err := edit(doc); err != nil {
+		return err
+	}
+	return fs.writeDraft(configPath, content, doc.Bytes())
+}
 
-	feeds, ok := config["feeds"].(map[string]interface{})
-	if !ok {
-		return []FeedListItem{}, nil
+// writeConfig validates the new content, backs up the previous content and
+// atomically writes the new one. Callers must hold the lock from fs.lock.
+func (fs *FeedService) writeConfig(configPath string, previous, content []byte) error {
+	if err := checkConfig(previous, content); err != nil {
+		return err
+	}
+	if fs.Backups != nil {
+		if err := fs.Backups.Save(configPath, previous); err != nil {
+			return fmt.Errorf("backing up config: %w", err)
+		}
+	}
+	err := atomicfile.WriteFile(configPath, content, 0644)
+	// Even a failed write may have changed the file.
+	fs.invalidateCache()
+	if err != nil {
+		return err
 	}
+	version := fs.rememberVersion(content)
+	fs.cacheMu.Lock()
+	fs.lastWritten = version
+	fs.cacheMu.Unlock()
+	return nil
+}
 
-	var hostname string
-	if serverSection, ok := config["server"].(map[string]interface{}); ok {
-		hostname, _ = serverSection["hostname"].(string)
+// RestoreBackup replaces the configuration with the named backup. The current
+// configuration is backed up first, so a restore can itself be undone.
+func (fs *FeedService) RestoreBackup(configPath string, name string) error {
+	if fs.Backups == nil {
+		return fmt.Errorf("%w: %s", ErrBackupNotFound, name)
 	}
+	restored, err := fs.Backups.Read(name)
+	if err != nil {
+		return err
+	}
+	return fs.ReplaceConfig(configPath, restored)
+}
 
-	var feedList []FeedListItem
-	for key, v := range feeds {
-		entry, ok := v.(map[string]interface{})
-		if !ok {
-			continue
-		}
-		// Determine feed name
-		name := key
-		if custom, ok := entry["custom"].(map[string]interface{}); ok {
-			if t, ok := custom["title"].(string); ok && t != "" {
-				name = t
-			}
+// ReplaceConfig validates content and writes it as the whole configuration.
+func (fs *FeedService) ReplaceConfig(configPath string, content []byte) error {
+	unlock, err := fs.lock(configPath)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	current, err := os.ReadFile(configPath)
+	if err != nil {
+		return err
+	}
+	return fs.writeConfig(configPath, current, content)
+}
+
+// wroteVersion reports whether version is what this process last wrote, as
+// opposed to an edit made by something else.
+func (fs *FeedService) wroteVersion(version string) bool {
+	fs.cacheMu.Lock()
+	defer fs.cacheMu.Unlock()
+	return version == fs.lastWritten
+}
+
+// ReadConfig returns the typed podsync configuration. It is shared with other
+// readers and must not be modified.
+func (fs *FeedService) ReadConfig(configPath string) (*podsync.Config, error) {
+	fs.mu.RLock()
+	defer fs.mu.RUnlock()
+
+	cfg, _, err := fs.cachedConfig(configPath)
+	return cfg, err
+}
+
+// ValidateConfig checks the configuration file against the rules podsync
+// applies when it starts, and separately against the metadata checks applied
+// to written values.
+func (fs *FeedService) ValidateConfig(configPath string) (startup, metadata error, err error) {
+	cfg, err := fs.ReadConfig(configPath)
+	if err != nil {
+		return nil, nil, err
+	}
+	return podsync.Validate(cfg), podsync.CheckMetadata(cfg), nil
+}
+
+// CheckReload returns the problems that would stop podsync starting with the
+// configuration file, leaving out any it already started with in applied (nil
+// if unknown). Metadata checks do not block a reload.
+func (fs *FeedService) CheckReload(configPath string, applied []byte) error {
+	cfg, err := fs.ReadConfig(configPath)
+	if err != nil {
+		return err
+	}
+	var existing error
+	if applied != nil {
+		if before, err := loadModel(applied); err == nil {
+			existing = podsync.Validate(before)
 		}
+	}
+	return podsync.NewProblems(existing, podsync.Validate(cfg))
+}
 
-		// Potential feed source URL
-		urlVal, _ := entry["url"].(string)
+func loadModel(content []byte) (*podsync.Config, error) {
+	doc, err := tomledit.Parse(content)
+	if err != nil {
+		return nil, err
+	}
+	return podsync.Load(doc)
+}
 
-		// Construct the feed’s XML URL, if hostname is configured
-		xmlURL := ""
-		if hostname != "" {
-			xmlURL = strings.TrimRight(hostname, "/") + "/" + key + ".xml"
+// checkConfig rejects content that podsync could not load, or that has
+// validation or metadata problems the previous content did not already have.
+func checkConfig(previous, content []byte) error {
+	after, err := loadModel(content)
+	if err != nil {
+		return fmt.Errorf("invalid config: %w", err)
+	}
+	var existing error
+	if before, err := loadModel(previous); err == nil {
+		existing = podsync.Check(before)
+	}
+	return podsync.NewProblems(existing, podsync.Check(after))
+}
+
+// updateModel passes the typed configuration to mutate and stages only the
+// settings it changed. It returns the configuration before and after the
+// change. Callers must hold the lock from fs.lock.
+func (fs *FeedService) updateModel(configPath string, version string, mutate func(cfg *podsync.Config) error) (before, after *podsync.Config, err error) {
+	err = fs.updateConfig(configPath, version, func(doc *tomledit.Document) error {
+		var err error
+		if before, err = podsync.Load(doc); err != nil {
+			return err
+		}
+		if after, err = podsync.Load(doc); err != nil {
+			return err
+		}
+		if err := mutate(after); err != nil {
+			return err
 		}
+		return podsync.Save(doc, before, after)
+	})
+	return before, after, err
+}
+
+// FeedChange is the effect of an edit on a single feed. Before is nil for an
+// added feed and After is nil for a removed one.
+type FeedChange struct {
+	Key    string
+	Before *podsync.Feed
+	After  *podsync.Feed
+	// Raw is a removed feed's table as written, when it could be cut out
+	// whole, so undoing the removal also restores keys and comments the
+	// model does not know.
+	Raw string
+}
+
+// feedChange picks the feed key out of the configurations returned by
+// updateModel.
+func feedChange(key string, before, after *podsync.Config, err error) (*FeedChange, error) {
+	if err != nil {
+		return nil, err
+	}
+	return &FeedChange{Key: key, Before: before.Feeds[key], After: after.Feeds[key]}, nil
+}
 
-		updatePeriod, _ := entry["update_period"].(string)
-		format, _ := entry["format"].(string)
+// GetFeedList returns the list of feeds as staged, along with the version of
+// the file it was read from.
+func (fs *FeedService) GetFeedList(configPath string) ([]FeedListItem, string, error) {
+	cfg, version, err := fs.WorkingConfig(configPath)
+	if err != nil {
+		return nil, version, err
+	}
 
-		// Retrieve max_age from filters
-		var maxAge string
-		if filters, ok := entry["filters"].(map[string]interface{}); ok {
-			if ma, ok := filters["max_age"]; ok {
-				maxAge = fmt.Sprintf("%v", ma)
-			}
+	feedList := []FeedListItem{}
+	for key, feed := range cfg.Feeds {
+		// Determine feed name
+		name := key
+		if feed.Custom.Title != "" {
+			name = feed.Custom.Title
 		}
 
-		// Retrieve keep_last from clean
-		var cleanKeepLast string
-		if clean, ok := entry["clean"].(map[string]interface{}); ok {
-			if ck, ok := clean["keep_last"]; ok {
-				cleanKeepLast = fmt.Sprintf("%v", ck)
-			}
+		// Construct the feed’s XML URL, if hostname is configured
+		xmlURL := ""
+		if cfg.Server.Hostname != "" {
+			xmlURL = strings.TrimRight(cfg.Server.Hostname, "/") + "/" + key + ".xml"
 		}
 
 		feedList = append(feedList, FeedListItem{
 			Key:           key,
 			Name:          name,
-			URL:           urlVal,
+			URL:           feed.URL,
 			XMLURL:        xmlURL,
-			UpdatePeriod:  updatePeriod,
-			Format:        format,
-			MaxAge:        maxAge,
-			CleanKeepLast: cleanKeepLast,
+			UpdatePeriod:  feed.UpdatePeriod,
+			CronSchedule:  feed.CronSchedule,
+			Format:        feed.Format,
+			Quality:       feed.Quality,
+			PageSize:      formatOptionalInt(feed.PageSize),
+			MaxHeight:     formatOptionalInt(feed.MaxHeight),
+			PlaylistSort:  feed.PlaylistSort,
+			OPML:          feed.OPML,
+			PrivateFeed:   feed.PrivateFeed,
+			MaxAge:        formatOptionalInt(feed.Filters.MaxAge),
+			CleanKeepLast: formatOptionalInt(feed.Clean.KeepLast),
+
+			FilterTitle:          feed.Filters.Title,
+			FilterNotTitle:       feed.Filters.NotTitle,
+			FilterDescription:    feed.Filters.Description,
+			FilterNotDescription: feed.Filters.NotDescription,
+			MinDuration:          formatOptionalInt(int(feed.Filters.MinDuration)),
+			MaxDuration:          formatOptionalInt(int(feed.Filters.MaxDuration)),
+			MinAge:               formatOptionalInt(feed.Filters.MinAge),
+			Custom:               feed.Custom,
 		})
 	}
 
@@ -100,7 +323,15 @@ func (fs *FeedService) GetFeedList(configPath string) ([]FeedListItem, error) {
 		return feedList[i].Name < feedList[j].Name
 	})
 
-	return feedList, nil
+	return feedList, version, nil
+}
+
+// formatOptionalInt renders an unset (zero) setting as an empty string.
+func formatOptionalInt(v int) string {
+	if v == 0 {
+		return ""
+	}
+	return strconv.Itoa(v)
 }
 
 // FetchChannelInfo retrieves channel info from the given YouTube URL.
@@ -144,94 +375,162 @@ func (fs *FeedService) FetchChannelInfo(youtubeUrl string) (*NewFeedInfo, error)
 	}, nil
 }
 
-// AppendFeedToConfig appends a new feed to the configuration.
-func (fs *FeedService) AppendFeedToConfig(configPath string, feed *NewFeedInfo, updatePeriod string,
-	feedFormat string, cleanKeepLast int, maxAge int) error {
-
-	fs.mu.Lock()
-	defer fs.mu.Unlock()
+// DefaultFeed returns the settings a new feed in the given format starts
+// with, before the add form's choices are applied. As in podsync, max_height
+// is left unset, so video is not capped unless the form asks for it.
+func DefaultFeed(format string) *podsync.Feed {
+	return &podsync.Feed{
+		PageSize:      50,
+		UpdatePeriod:  "1h",
+		Quality:       "high",
+		Format:        format,
+		OPML:          true,
+		PrivateFeed:   false,
+		YouTubeDLArgs: []string{"--add-metadata", "--embed-thumbnail", "--write-description"},
+		Clean:         podsync.Clean{KeepLast: 20},
+		Filters:       podsync.Filters{MaxAge: 90},
+	}
+}
 
-	content, err := os.ReadFile(configPath)
+// AppendFeedToConfig stages newFeed, usually based on DefaultFeed, as a new
+// feed for the channel, filling in its URL and custom block from the channel.
+// As with every write, an empty version skips the conflict check.
+func (fs *FeedService) AppendFeedToConfig(configPath string, version string, feed *NewFeedInfo, newFeed *podsync.Feed) (*FeedChange, error) {
+	unlock, err := fs.lock(configPath)
 	if err != nil {
-		return err
+		return nil, err
 	}
-	var config map[string]interface{}
-	if err := toml.Unmarshal(content, &config); err != nil {
-		return err
+	defer unlock()
+
+	newFeed.URL = feed.URL
+	newFeed.Custom = podsync.Custom{
+		Title:       feed.ChannelName,
+		Description: "Episodes from the '" + feed.ChannelName + "' Youtube channel in a podcast format.",
+		Author:      feed.ChannelName,
+		CoverArt:    feed.ProfilePicture,
+		Lang:        "en",
+		Explicit:    false,
 	}
 
-	feeds, ok := config["feeds"].(map[string]interface{})
-	if !ok {
-		feeds = make(map[string]interface{})
-		config["feeds"] = feeds
-	}
-
-	newFeed := map[string]interface{}{
-		"url":             feed.URL,
-		"page_size":       50,
-		"update_period":   updatePeriod,
-		"quality":         "high",
-		"format":          feedFormat,
-		"opml":            true,
-		"private_feed":    false,
-		"youtube_dl_args": []string{"--add-metadata", "--embed-thumbnail", "--write-description"},
-		"clean":           map[string]interface{}{"keep_last": cleanKeepLast},
-		"filters":         map[string]interface{}{"max_age": maxAge},
-		"custom": map[string]interface{}{
-			"title":       feed.ChannelName,
-			"description": "Episodes from the '" + feed.ChannelName + "' Youtube channel in a podcast format.",
-			"author":      feed.ChannelName,
-			"cover_art":   feed.ProfilePicture,
-			"lang":        "en",
-			"explicit":    false,
-		},
-	}
-
-	feeds[feed.FeedKey] = newFeed
-	newContent, err := toml.Marshal(config)
+	before, after, err := fs.updateModel(configPath, version, func(cfg *podsync.Config) error {
+		cfg.Feeds[feed.FeedKey] = newFeed
+		return nil
+	})
+	return feedChange(feed.FeedKey, before, after, err)
+}
+
+// ModifyFeed passes an existing feed to mutate and stages the settings it
+// changed. Everything else about the feed, including keys podconfig does not
+// know, is left untouched.
+func (fs *FeedService) ModifyFeed(configPath string, version string, feedKey string, mutate func(feed *podsync.Feed) error) (*FeedChange, error) {
+	unlock, err := fs.lock(configPath)
 	if err != nil {
-		return err
+		return nil, err
 	}
-	return os.WriteFile(configPath, newContent, 0644)
-}
+	defer unlock()
 
-// ModifyFeed updates an existing feed's configuration with the provided updates.
-func (fs *FeedService) ModifyFeed(configPath string, feedKey string, updates map[string]interface{}) error {
-	fs.mu.Lock()
-	defer fs.mu.Unlock()
+	before, after, err := fs.updateModel(configPath, version, func(cfg *podsync.Config) error {
+		feed, ok := cfg.Feeds[feedKey]
+		if !ok {
+			return fmt.Errorf("%w: %s", ErrFeedNotFound, feedKey)
+		}
+		return mutate(feed)
+	})
+	return feedChange(feedKey, before, after, err)
+}
 
-	content, err := os.ReadFile(configPath)
+// RemoveFeed stages the removal of a feed and all of its settings.
+func (fs *FeedService) RemoveFeed(configPath string, version string, feedKey string) (*FeedChange, error) {
+	unlock, err := fs.lock(configPath)
 	if err != nil {
-		return err
-	}
-	var config map[string]interface{}
-	if err := toml.Unmarshal(content, &config); err != nil {
-		return err
+		return nil, err
 	}
+	defer unlock()
 
-	feeds, ok := config["feeds"].(map[string]interface{})
-	if !ok {
-		return fmt.Errorf("no feeds found in config")
-	}
-	feed, exists := feeds[feedKey]
-	if !exists {
-		return fmt.Errorf("feed %s not found", feedKey)
-	}
-	feedMap, ok := feed.(map[string]interface{})
-	if !ok {
-		return fmt.Errorf("invalid feed format")
-	}
+	var change *FeedChange
+	err = fs.updateConfig(configPath, version, func(doc *tomledit.Document) error {
+		cfg, err := podsync.Load(doc)
+		if err != nil {
+			return err
+		}
+		feed, ok := cfg.Feeds[feedKey]
+		if !ok {
+			return fmt.Errorf("%w: %s", ErrFeedNotFound, feedKey)
+		}
+		path := []string{"feeds", feedKey}
+		raw, _ := doc.Section(path)
+		if _, err := doc.Delete(path); err != nil {
+			return err
+		}
+		change = &FeedChange{Key: feedKey, Before: feed, Raw: raw}
+		return nil
+	})
+	return change, err
+}
 
-	// Merge each update into feedMap
-	for key, value := range updates {
-		feedMap[key] = value
+// ReplaceFeed stages feed as the settings of feedKey, or the feed's removal if
+// feed is nil. The feed's current settings must match expect (nil for a feed
+// that does not exist), otherwise ErrFeedChanged is returned. When a removed
+// feed is put back, raw is its table as it was written (see FeedChange.Raw);
+// it is used as long as it still holds feed's settings.
+func (fs *FeedService) ReplaceFeed(configPath string, version string, feedKey string, expect, feed *podsync.Feed, raw string) (*FeedChange, error) {
+	unlock, err := fs.lock(configPath)
+	if err != nil {
+		return nil, err
 	}
+	defer unlock()
 
-	newContent, err := toml.Marshal(config)
-	if err != nil {
-		return err
+	if raw != "" && expect == nil && feed != nil {
+		change, err := fs.restoreFeed(configPath, version, feedKey, feed, raw)
+		if !errors.Is(err, errRawMismatch) {
+			return change, err
+		}
 	}
-	return os.WriteFile(configPath, newContent, 0644)
+
+	before, after, err := fs.updateModel(configPath, version, func(cfg *podsync.Config) error {
+		if len(podsync.Diff(nil, cfg.Feeds[feedKey], expect)) > 0 {
+			return fmt.Errorf("%w: %s", ErrFeedChanged, feedKey)
+		}
+		if feed == nil {
+			delete(cfg.Feeds, feedKey)
+			return nil
+		}
+		replacement := *feed
+		cfg.Feeds[feedKey] = &replacement
+		return nil
+	})
+	return feedChange(feedKey, before, after, err)
+}
+
+// restoreFeed stages raw, the table of a removed feed, back into the config.
+// It returns errRawMismatch without staging anything if raw cannot be put
+// back or no longer holds feed's settings. Callers must hold the lock from
+// fs.lock.
+func (fs *FeedService) restoreFeed(configPath string, version string, feedKey string, feed *podsync.Feed, raw string) (*FeedChange, error) {
+	var change *FeedChange
+	err := fs.updateConfig(configPath, version, func(doc *tomledit.Document) error {
+		cfg, err := podsync.Load(doc)
+		if err != nil {
+			return err
+		}
+		if cfg.Feeds[feedKey] != nil {
+			return fmt.Errorf("%w: %s", ErrFeedChanged, feedKey)
+		}
+		if err := doc.InsertSection([]string{"feeds", feedKey}, raw); err != nil {
+			return fmt.Errorf("%w: %v", errRawMismatch, err)
+		}
+		cfg, err = podsync.Load(doc)
+		if err != nil {
+			return fmt.Errorf("%w: %v", errRawMismatch, err)
+		}
+		restored := cfg.Feeds[feedKey]
+		if restored == nil || len(podsync.Diff(nil, restored, feed)) > 0 {
+			return errRawMismatch
+		}
+		change = &FeedChange{Key: feedKey, After: restored}
+		return nil
+	})
+	return change, err
 }
 
 // Sanitise creates a feed key from the given channel name.
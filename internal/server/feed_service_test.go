@@ -0,0 +1,39 @@
+package server
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/Takenobou/podconfig/internal/podsync"
+)
+
+// writeTestConfig writes content as config.toml in a temporary directory and
+// returns its path.
+func writeTestConfig(t *testing.T, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "config.toml")
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestRemoveLastFeedRefused(t *testing.T) {
+	path := writeTestConfig(t, `[storage.local]
+data_dir = "/app/data"
+
+[feeds.news]
+url = "https://www.youtube.com/channel/UCexample"
+`)
+	fs := &FeedService{}
+	_, err := fs.RemoveFeed(path, "", "news")
+	var verr *podsync.ValidationError
+	if !errors.As(err, &verr) || len(verr.Problems) != 1 || verr.Problems[0].Path != "feeds" {
+		t.Fatalf("RemoveFeed error = %v, want a problem at feeds", err)
+	}
+	if _, err := os.Stat(fs.draftPath(path)); !os.IsNotExist(err) {
+		t.Errorf("removal was staged anyway: %v", err)
+	}
+}
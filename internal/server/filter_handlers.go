@@ -0,0 +1,165 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/Takenobou/podconfig/internal/podsync"
+)
+
+// filterPreviewTimeout bounds fetching the uploads for a filter preview.
+const filterPreviewTimeout = 20 * time.Second
+
+// FilterResult is an upload marked with whether the feed's filters let it
+// through ("pass"), reject it ("reject", with the first filter that did) or
+// depend on its duration, which is not known ("unknown").
+type FilterResult struct {
+	Upload
+	AgeDays int    `json:"age_days"`
+	Result  string `json:"result"`
+	Reason  string `json:"reason,omitempty"`
+}
+
+// FilterPreviewHandler shows which of a feed's recent uploads its filters
+// would pass or reject. It uses the staged filters of feedKey, overridden by
+// any filters.* (or max_age) fields sent, so filters can be tried before they
+// are saved.
+func (h *Handler) FilterPreviewHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, "Invalid form", http.StatusBadRequest)
+		return
+	}
+	feedKey := r.PostForm.Get("feedKey")
+	if feedKey == "" {
+		http.Error(w, "feedKey is required", http.StatusBadRequest)
+		return
+	}
+	cfg, _, err := h.FeedService.WorkingConfig(h.PodsyncConfigPath)
+	if err != nil {
+		log.Printf("Error reading config: %v", err)
+		http.Error(w, "Failed to read config", http.StatusInternalServerError)
+		return
+	}
+	feed, ok := cfg.Feeds[feedKey]
+	if !ok {
+		http.Error(w, "Feed not found", http.StatusNotFound)
+		return
+	}
+	filters := feed.Filters
+	form := &settingsForm{values: r.PostForm}
+	form.Int("max_age", &filters.MaxAge)
+	setFilters(&filters, form)
+	if fieldFailed(w, form.err) {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), filterPreviewTimeout)
+	defer cancel()
+	uploads, source, err := h.Uploads.Recent(ctx, feed.URL)
+	if errors.Is(err, ErrUnsupportedFeedURL) {
+		http.Error(w, fmt.Sprintf("Recent uploads cannot be looked up for %s", feed.URL), http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		log.Printf("Error fetching uploads for %s: %v", feedKey, err)
+		http.Error(w, fmt.Sprintf("Failed to fetch recent uploads: %v", err), http.StatusBadGateway)
+		return
+	}
+
+	now := time.Now()
+	durations := durationFilters(&filters)
+	results := make([]FilterResult, 0, len(uploads))
+	counts := map[string]int{}
+	for _, u := range uploads {
+		res := FilterResult{Upload: u, AgeDays: ageDays(u.Published, now), Result: "pass"}
+		if reason := filterReason(&filters, u, now); reason != "" {
+			res.Result, res.Reason = "reject", reason
+		} else if durations != "" {
+			// Podsync may still reject it by duration.
+			res.Result, res.Reason = "unknown", "duration not checked against "+durations
+		}
+		counts[res.Result]++
+		results = append(results, res)
+	}
+	resp := map[string]interface{}{
+		"feed":     feedKey,
+		"source":   source,
+		"passed":   counts["pass"],
+		"rejected": counts["reject"],
+		"unknown":  counts["unknown"],
+		"videos":   results,
+	}
+	if durations != "" {
+		resp["note"] = "The uploads feed does not give durations, so uploads the other filters pass are unknown until " + durations + " is checked by podsync."
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
+}
+
+// filterReason applies podsync's episode filters to an upload in podsync's
+// order and returns why it is rejected, or "" if it passes. As in podsync,
+// a pattern that does not compile is ignored, and ages are whole days.
+// Durations are not known and not checked; see durationFilters.
+func filterReason(f *podsync.Filters, u Upload, now time.Time) string {
+	patterns := []struct {
+		name, pattern, field, value string
+		negative                    bool
+	}{
+		{"title", f.Title, "title", u.Title, false},
+		{"not_title", f.NotTitle, "title", u.Title, true},
+		{"description", f.Description, "description", u.Description, false},
+		{"not_description", f.NotDescription, "description", u.Description, true},
+	}
+	for _, p := range patterns {
+		if p.pattern == "" {
+			continue
+		}
+		re, err := regexp.Compile(p.pattern)
+		if err != nil {
+			continue
+		}
+		if re.MatchString(p.value) == p.negative {
+			if p.negative {
+				return fmt.Sprintf("%s matches %s %q", p.field, p.name, p.pattern)
+			}
+			return fmt.Sprintf("%s does not match %s %q", p.field, p.name, p.pattern)
+		}
+	}
+	age := ageDays(u.Published, now)
+	if f.MaxAge > 0 && age > f.MaxAge {
+		return fmt.Sprintf("%d days old, older than max_age %d", age, f.MaxAge)
+	}
+	if f.MinAge > 0 && age < f.MinAge {
+		return fmt.Sprintf("%d days old, newer than min_age %d", age, f.MinAge)
+	}
+	return ""
+}
+
+// durationFilters describes the duration filters that are set, such as
+// "min_duration 60 and max_duration 3600", or returns "" if none are.
+func durationFilters(f *podsync.Filters) string {
+	var set []string
+	if f.MinDuration > 0 {
+		set = append(set, fmt.Sprintf("min_duration %d", f.MinDuration))
+	}
+	if f.MaxDuration > 0 {
+		set = append(set, fmt.Sprintf("max_duration %d", f.MaxDuration))
+	}
+	return strings.Join(set, " and ")
+}
+
+// ageDays is how many whole days ago t was, as podsync counts them.
+func ageDays(t, now time.Time) int {
+	return int(now.Sub(t).Hours()) / 24
+}
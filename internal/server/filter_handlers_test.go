@@ -0,0 +1,204 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Takenobou/podconfig/internal/podsync"
+)
+
+func TestFilterPreviewHandler(t *testing.T) {
+	now := time.Now()
+	srv, _ := newYouTubeStub(t, []stubUpload{
+		{"v1", "Weekly news", "This week", now.Add(-2 * 24 * time.Hour)},
+		{"v2", "Cooking show", "Sponsored by news", now.Add(-24 * time.Hour)},
+		{"v3", "Old news", "", now.Add(-40 * 24 * time.Hour)},
+	})
+	configPath := filepath.Join(t.TempDir(), "config.toml")
+	config := `[feeds]
+  [feeds.example]
+  url = "https://www.youtube.com/@example"
+  filters = { title = "news", max_age = 30 }
+`
+	if err := os.WriteFile(configPath, []byte(config), 0644); err != nil {
+		t.Fatal(err)
+	}
+	h := &Handler{
+		PodsyncConfigPath: configPath,
+		FeedService:       &FeedService{},
+		Uploads:           &UploadService{FeedURL: srv.URL + "/feeds/videos.xml", SiteURL: srv.URL},
+	}
+
+	tests := []struct {
+		name    string
+		form    url.Values
+		status  int
+		reasons map[string]string // by video ID; "" for a pass, "duration not checked ..." for unknown
+		note    bool
+	}{
+		{
+			name:   "staged filters",
+			form:   url.Values{"feedKey": {"example"}},
+			status: http.StatusOK,
+			reasons: map[string]string{
+				"v1": "",
+				"v2": `title does not match title "news"`,
+				"v3": "40 days old, older than max_age 30",
+			},
+		},
+		{
+			name: "overridden filters",
+			form: url.Values{
+				"feedKey":                 {"example"},
+				"filters.title":           {""},
+				"filters.not_title":       {"^Weekly"},
+				"filters.description":     {"news"},
+				"filters.min_age":         {"2"},
+				"max_age":                 {"60"},
+				"filters.min_duration":    {"60"},
+				"filters.not_description": {""},
+			},
+			status: http.StatusOK,
+			reasons: map[string]string{
+				"v1": `title matches not_title "^Weekly"`,
+				"v2": "1 days old, newer than min_age 2",
+				"v3": `description does not match description "news"`,
+			},
+			note: true,
+		},
+		{
+			name: "duration filters",
+			form: url.Values{
+				"feedKey":              {"example"},
+				"filters.title":        {""},
+				"filters.max_duration": {"600"},
+			},
+			status: http.StatusOK,
+			reasons: map[string]string{
+				"v1": "duration not checked against max_duration 600",
+				"v2": "duration not checked against max_duration 600",
+				"v3": "40 days old, older than max_age 30",
+			},
+			note: true,
+		},
+		{
+			name:   "invalid pattern",
+			form:   url.Values{"feedKey": {"example"}, "filters.title": {"("}},
+			status: http.StatusBadRequest,
+		},
+		{
+			name:   "unknown feed",
+			form:   url.Values{"feedKey": {"missing"}},
+			status: http.StatusNotFound,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, "/filters/preview", strings.NewReader(tt.form.Encode()))
+			req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+			rec := httptest.NewRecorder()
+			h.FilterPreviewHandler(rec, req)
+			if rec.Code != tt.status {
+				t.Fatalf("status = %d, want %d: %s", rec.Code, tt.status, rec.Body)
+			}
+			if tt.status != http.StatusOK {
+				return
+			}
+
+			var resp struct {
+				Source   string         `json:"source"`
+				Passed   int            `json:"passed"`
+				Rejected int            `json:"rejected"`
+				Unknown  int            `json:"unknown"`
+				Videos   []FilterResult `json:"videos"`
+				Note     string         `json:"note"`
+			}
+			if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil {
+				t.Fatal(err)
+			}
+			if !strings.HasSuffix(resp.Source, "?channel_id=UCexample") {
+				t.Errorf("source = %s, want the channel resolved through the stub", resp.Source)
+			}
+			counts := map[string]int{}
+			for _, v := range resp.Videos {
+				want, ok := tt.reasons[v.ID]
+				if !ok {
+					t.Errorf("unexpected video %s", v.ID)
+					continue
+				}
+				wantResult := "reject"
+				switch {
+				case want == "":
+					wantResult = "pass"
+				case strings.HasPrefix(want, "duration not checked"):
+					wantResult = "unknown"
+				}
+				counts[wantResult]++
+				if v.Result != wantResult || v.Reason != want {
+					t.Errorf("%s: result %q, reason %q; want %q, %q", v.ID, v.Result, v.Reason, wantResult, want)
+				}
+			}
+			if len(resp.Videos) != len(tt.reasons) || resp.Passed != counts["pass"] || resp.Rejected != counts["reject"] || resp.Unknown != counts["unknown"] {
+				t.Errorf("got %d videos, %d passed, %d rejected, %d unknown", len(resp.Videos), resp.Passed, resp.Rejected, resp.Unknown)
+			}
+			if (resp.Note != "") != tt.note {
+				t.Errorf("note = %q, want one: %v", resp.Note, tt.note)
+			}
+		})
+	}
+}
+
+func TestFilterReason(t *testing.T) {
+	now := time.Date(2026, 10, 17, 12, 0, 0, 0, time.UTC)
+	upload := Upload{Title: "Episode 12: news", Description: "Weekly roundup", Published: now.Add(-10 * 24 * time.Hour)}
+	tests := []struct {
+		name    string
+		filters podsync.Filters
+		want    string
+	}{
+		{"no filters", podsync.Filters{}, ""},
+		{"title matches", podsync.Filters{Title: `Episode \d+`}, ""},
+		{"title does not match", podsync.Filters{Title: "^news"}, `title does not match title "^news"`},
+		{"not_title matches", podsync.Filters{NotTitle: "news$"}, `title matches not_title "news$"`},
+		{"description does not match", podsync.Filters{Description: "daily"}, `description does not match description "daily"`},
+		{"not_description matches", podsync.Filters{NotDescription: "(?i)weekly"}, `description matches not_description "(?i)weekly"`},
+		{"invalid pattern ignored", podsync.Filters{Title: "("}, ""},
+		{"title checked before age", podsync.Filters{Title: "^news", MaxAge: 5}, `title does not match title "^news"`},
+		{"too old", podsync.Filters{MaxAge: 9}, "10 days old, older than max_age 9"},
+		{"max_age boundary", podsync.Filters{MaxAge: 10}, ""},
+		{"too new", podsync.Filters{MinAge: 11}, "10 days old, newer than min_age 11"},
+		{"durations not checked", podsync.Filters{MinDuration: 3600, MaxDuration: 1}, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := filterReason(&tt.filters, upload, now); got != tt.want {
+				t.Errorf("filterReason = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDurationFilters(t *testing.T) {
+	tests := []struct {
+		filters podsync.Filters
+		want    string
+	}{
+		{podsync.Filters{}, ""},
+		{podsync.Filters{MinAge: 7}, ""},
+		{podsync.Filters{MinDuration: 60}, "min_duration 60"},
+		{podsync.Filters{MaxDuration: 3600}, "max_duration 3600"},
+		{podsync.Filters{MinDuration: 60, MaxDuration: 3600}, "min_duration 60 and max_duration 3600"},
+	}
+	for _, tt := range tests {
+		if got := durationFilters(&tt.filters); got != tt.want {
+			t.Errorf("durationFilters(%+v) = %q, want %q", tt.filters, got, tt.want)
+		}
+	}
+}
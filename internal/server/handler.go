@@ -1,6 +1,9 @@
 package server
 
-import "sync"
+import (
+	"log"
+	"strings"
+)
 
 // Handler is the HTTP handler for podconfig.
 type Handler struct {
@@ -9,30 +12,120 @@ type Handler struct {
 
 	// Inject the feed service (no global var).
 	FeedService *FeedService
+	Backups     *BackupService
+	// History is nil unless git-backed config history is enabled.
+	History *HistoryService
+	// Events pushes live updates to open pages.
+	Events *Events
+	// Journal holds the changes podsync has not been reloaded with yet.
+	Journal *JournalService
+	// Snapshots holds the config podsync was last reloaded with.
+	Snapshots *SnapshotService
+	// Undo remembers feed operations so they can be undone and redone.
+	Undo *UndoStack
+	// Uploads fetches channels' recent uploads for filter previews.
+	Uploads *UploadService
+}
+
+// addChange records an entry in the pending changelog and, when history is
+// enabled, commits the config with its message.
+func (h *Handler) addChange(entry ChangeEntry) {
+	h.addChanges(entry.Message, entry)
+}
+
+// addChanges records entries in the pending changelog and, when history is
+// enabled, commits the config with msg. Undone feed operations can no longer
+// be redone.
+func (h *Handler) addChanges(msg string, entries ...ChangeEntry) {
+	h.Undo.ClearRedo()
+	if err := h.Journal.Add(entries...); err != nil {
+		log.Printf("Error saving change journal: %v", err)
+	}
+	h.Events.Publish("changelog", "")
+	h.commitHistory(msg)
+}
 
-	mu      sync.Mutex
-	pending []string
+// applyChanges moves the staged changes in the journal to the pending
+// changelog as entries, now that they are in the live config, and commits the
+// config with msg when history is enabled.
+func (h *Handler) applyChanges(msg string, entries []ChangeEntry) {
+	if err := h.Journal.Apply(entries...); err != nil {
+		log.Printf("Error saving change journal: %v", err)
+	}
+	h.Events.Publish("changelog", "")
+	h.commitHistory(msg)
 }
 
-// addChange records a message in the pending changelog.
-func (h *Handler) addChange(msg string) {
-	h.mu.Lock()
-	defer h.mu.Unlock()
-	h.pending = append(h.pending, msg)
+// commitHistory commits the config with msg when history is enabled.
+func (h *Handler) commitHistory(msg string) {
+	if h.History == nil {
+		return
+	}
+	if err := h.History.Commit(msg); err != nil {
+		log.Printf("Error committing config history: %v", err)
+	}
 }
 
-// clearChanges removes all pending changes (after a successful container reload).
+// stageChange records a new change against the staged changes and tells open
+// pages. Undone feed operations can no longer be redone.
+func (h *Handler) stageChange(entry ChangeEntry) {
+	h.Undo.ClearRedo()
+	h.noteStaged(entry)
+}
+
+// noteStaged records an entry against the staged changes and tells open pages.
+func (h *Handler) noteStaged(entry ChangeEntry) {
+	if err := h.FeedService.NoteDraftChange(h.PodsyncConfigPath, entry); err != nil {
+		log.Printf("Error recording staged change: %v", err)
+	}
+	if err := h.Journal.Stage(entry); err != nil {
+		log.Printf("Error saving change journal: %v", err)
+	}
+	h.Events.Publish("config", "")
+	h.Events.Publish("changelog", "")
+}
+
+// stageFeedChange stages a new feed operation and remembers it for undo.
+func (h *Handler) stageFeedChange(entry ChangeEntry) {
+	h.noteStaged(entry)
+	h.Undo.Record(entry)
+}
+
+// clearChanges removes the applied changes once the container has been
+// reloaded with them. Staged changes stay in the journal.
 func (h *Handler) clearChanges() {
-	h.mu.Lock()
-	defer h.mu.Unlock()
-	h.pending = nil
-}
-
-// getChanges returns a snapshot of the current pending changes.
-func (h *Handler) getChanges() []string {
-	h.mu.Lock()
-	defer h.mu.Unlock()
-	cpy := make([]string, len(h.pending))
-	copy(cpy, h.pending)
-	return cpy
+	if err := h.Journal.Clear(); err != nil {
+		log.Printf("Error saving change journal: %v", err)
+	}
+	h.Events.Publish("changelog", "")
+}
+
+// getChanges returns a snapshot of the applied changes pending a reload.
+func (h *Handler) getChanges() []ChangeEntry {
+	return h.journalEntries(false)
+}
+
+// getStagedChanges returns a snapshot of the staged changes, oldest first.
+func (h *Handler) getStagedChanges() []ChangeEntry {
+	return h.journalEntries(true)
+}
+
+// journalEntries returns the journal entries whose Staged flag is staged.
+func (h *Handler) journalEntries(staged bool) []ChangeEntry {
+	var entries []ChangeEntry
+	for _, e := range h.Journal.Entries() {
+		if e.Staged == staged {
+			entries = append(entries, e)
+		}
+	}
+	return entries
+}
+
+// summarise joins the messages of entries into one line.
+func summarise(entries []ChangeEntry) string {
+	msgs := make([]string, len(entries))
+	for i, e := range entries {
+		msgs[i] = e.Message
+	}
+	return strings.Join(msgs, "; ")
 }
@@ -0,0 +1,70 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// newTestHandler returns a handler for a config holding content, with its
+// backups, journal and snapshot next to it in a temporary directory.
+func newTestHandler(t *testing.T, content string) *Handler {
+	t.Helper()
+	path := writeTestConfig(t, content)
+	dir := filepath.Dir(path)
+	journal, err := OpenJournal(filepath.Join(dir, "podconfig-journal.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	backups := &BackupService{Dir: filepath.Join(dir, "backups")}
+	events := NewEvents()
+	t.Cleanup(events.Close)
+	return &Handler{
+		PodsyncConfigPath: path,
+		FeedService:       &FeedService{Backups: backups},
+		Backups:           backups,
+		Events:            events,
+		Journal:           journal,
+		Snapshots:         &SnapshotService{Path: filepath.Join(dir, "podconfig-applied.toml")},
+		Undo:              &UndoStack{},
+	}
+}
+
+// formRequest returns a request posting form to target from the page's
+// scripts, with version sent as If-Match when it is set.
+func formRequest(target string, form url.Values, version string) *http.Request {
+	req := httptest.NewRequest(http.MethodPost, target, strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("X-Requested-With", "XMLHttpRequest")
+	if version != "" {
+		req.Header.Set("If-Match", `"`+version+`"`)
+	}
+	return req
+}
+
+// serve runs handler with req and returns the response.
+func serve(handler http.HandlerFunc, req *http.Request) *httptest.ResponseRecorder {
+	rec := httptest.NewRecorder()
+	handler(rec, req)
+	return rec
+}
+
+// readTestFile returns the content of path.
+func readTestFile(t *testing.T, path string) string {
+	t.Helper()
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(data)
+}
+
+// workingVersion returns the version of the config edits apply to.
+func workingVersion(t *testing.T, h *Handler) string {
+	t.Helper()
+	return configVersion([]byte(readTestFile(t, h.FeedService.workingPath(h.PodsyncConfigPath))))
+}
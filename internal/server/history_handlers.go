@@ -0,0 +1,148 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+)
+
+// historyLimit caps the number of commits shown in the history list.
+const historyLimit = 100
+
+// HistoryListHandler returns the commits that changed the config in HTML (partial).
+func (h *Handler) HistoryListHandler(w http.ResponseWriter, r *http.Request) {
+	if !h.historyEnabled(w, r, http.MethodGet) {
+		return
+	}
+	entries, err := h.History.Log(historyLimit)
+	if err != nil {
+		log.Printf("Error reading config history: %v", err)
+		http.Error(w, "Failed to read history", http.StatusInternalServerError)
+		return
+	}
+	feedList, _, err := h.FeedService.GetFeedList(h.PodsyncConfigPath)
+	if err != nil {
+		log.Printf("Error reading feed list: %v", err)
+		feedList = []FeedListItem{}
+	}
+	data := map[string]interface{}{
+		"History": entries,
+		"Feeds":   feedList,
+	}
+	w.Header().Set("Content-Type", "text/html")
+	if err := tmpl.ExecuteTemplate(w, "historyList", data); err != nil {
+		http.Error(w, "Template error", http.StatusInternalServerError)
+	}
+}
+
+// HistoryDiffHandler returns the config change made by a commit as a unified diff.
+func (h *Handler) HistoryDiffHandler(w http.ResponseWriter, r *http.Request) {
+	if !h.historyEnabled(w, r, http.MethodGet) {
+		return
+	}
+	rev := r.URL.Query().Get("commit")
+	if rev == "" {
+		http.Error(w, "commit is required", http.StatusBadRequest)
+		return
+	}
+	patch, err := h.History.Diff(rev)
+	if errors.Is(err, ErrCommitNotFound) {
+		http.Error(w, "Commit not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		log.Printf("Error diffing commit: %v", err)
+		http.Error(w, "Failed to diff commit", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.Write([]byte(patch))
+}
+
+// HistoryBlameHandler shows which commit last changed each line of a feed in HTML (partial).
+func (h *Handler) HistoryBlameHandler(w http.ResponseWriter, r *http.Request) {
+	if !h.historyEnabled(w, r, http.MethodGet) {
+		return
+	}
+	feedKey := r.URL.Query().Get("feed")
+	if feedKey == "" {
+		http.Error(w, "feed is required", http.StatusBadRequest)
+		return
+	}
+	lines, err := h.History.BlameFeed(feedKey)
+	if errors.Is(err, ErrFeedNotFound) || errors.Is(err, ErrCommitNotFound) {
+		http.Error(w, "Feed not found in history", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		log.Printf("Error blaming feed: %v", err)
+		http.Error(w, "Failed to read feed history", http.StatusInternalServerError)
+		return
+	}
+	data := map[string]interface{}{
+		"FeedKey": feedKey,
+		"Lines":   lines,
+	}
+	w.Header().Set("Content-Type", "text/html")
+	if err := tmpl.ExecuteTemplate(w, "historyBlame", data); err != nil {
+		http.Error(w, "Template error", http.StatusInternalServerError)
+	}
+}
+
+// HistoryRevertHandler restores the config as it was at a commit.
+func (h *Handler) HistoryRevertHandler(w http.ResponseWriter, r *http.Request) {
+	if !h.historyEnabled(w, r, http.MethodPost) {
+		return
+	}
+	rev := r.FormValue("commit")
+	if rev == "" {
+		http.Error(w, "commit is required", http.StatusBadRequest)
+		return
+	}
+	content, shortHash, err := h.History.Content(rev)
+	if errors.Is(err, ErrCommitNotFound) {
+		http.Error(w, "Commit not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		log.Printf("Error reading commit: %v", err)
+		http.Error(w, "Failed to read commit", http.StatusInternalServerError)
+		return
+	}
+	if err := h.FeedService.ReplaceConfig(h.PodsyncConfigPath, content); err != nil {
+		if validationFailed(w, err) || lockFailed(w, err) {
+			return
+		}
+		log.Printf("Error reverting config: %v", err)
+		http.Error(w, "Failed to revert config", http.StatusInternalServerError)
+		return
+	}
+
+	h.addChange(ChangeEntry{
+		Time:      time.Now().UTC(),
+		Actor:     requestActor(r),
+		Operation: OpRevert,
+		Message:   fmt.Sprintf("Reverted config to %s", shortHash),
+	})
+
+	successMsg := fmt.Sprintf("Config reverted to %s successfully!", shortHash)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"message": successMsg})
+}
+
+// historyEnabled checks the method and that history is enabled, writing an
+// error response if not.
+func (h *Handler) historyEnabled(w http.ResponseWriter, r *http.Request, method string) bool {
+	if r.Method != method {
+		http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+		return false
+	}
+	if h.History == nil {
+		http.Error(w, "Config history is disabled", http.StatusNotFound)
+		return false
+	}
+	return true
+}
@@ -0,0 +1,422 @@
+package server
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/Takenobou/podconfig/internal/tomledit"
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/filemode"
+	"github.com/go-git/go-git/v5/plumbing/object"
+)
+
+// ErrCommitNotFound is returned when a revision does not name a commit.
+var ErrCommitNotFound = errors.New("commit not found")
+
+// historySignature identifies podconfig as the author of history commits.
+var historySignature = object.Signature{Name: "podconfig", Email: "podconfig@localhost"}
+
+// HistoryService records every config change as a commit in a git repository,
+// either in the directory holding the podsync config or in a directory of its
+// own holding a copy of the config.
+type HistoryService struct {
+	mu   sync.Mutex
+	repo *git.Repository
+	path string // config file name, in the worktree root
+	abs  string // absolute config path
+	// copy is where the config is copied to before each commit, when the
+	// repository is kept apart from the config.
+	copy string
+}
+
+// HistoryEntry describes a commit that changed the config.
+type HistoryEntry struct {
+	Hash      string
+	ShortHash string
+	Message   string
+	When      time.Time
+}
+
+// BlameLine attributes a line of the config to the commit that last changed it.
+type BlameLine struct {
+	Line int
+	Text string
+	HistoryEntry
+}
+
+// OpenHistory opens the git repository in the directory holding configPath,
+// creating one there if there is none, and commits the config if it is not
+// yet tracked or has changed since the last commit. If dir is set, the
+// repository is kept there instead, tracking a copy of the config made on
+// every commit, so it can live on a volume other than the config's.
+func OpenHistory(configPath string, dir string) (*HistoryService, error) {
+	abs, err := filepath.Abs(configPath)
+	if err != nil {
+		return nil, err
+	}
+	name := filepath.Base(abs)
+	hs := &HistoryService{path: name, abs: abs}
+	if dir != "" {
+		if dir, err = filepath.Abs(dir); err != nil {
+			return nil, err
+		}
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return nil, err
+		}
+		hs.copy = filepath.Join(dir, name)
+	} else {
+		dir = filepath.Dir(abs)
+	}
+	message := "Record config changes made outside podconfig"
+	// Only a repository rooted at dir itself is reused: one around a parent
+	// directory has other files staged in its index, and a path of its own
+	// for the config.
+	hs.repo, err = git.PlainOpen(dir)
+	if errors.Is(err, git.ErrRepositoryNotExists) {
+		message = "Start config history"
+		hs.repo, err = initHistoryRepo(dir, name)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if _, err := hs.repo.Worktree(); err != nil {
+		return nil, fmt.Errorf("%s: %w", dir, err)
+	}
+	if err := hs.Commit(message); err != nil {
+		return nil, err
+	}
+	return hs, nil
+}
+
+// initHistoryRepo creates a repository in dir that ignores everything except
+// the config file, since podsync often keeps its media next to the config.
+// The .gitignore is committed along with the config in the first commit.
+func initHistoryRepo(dir, configName string) (*git.Repository, error) {
+	repo, err := git.PlainInit(dir, false)
+	if err != nil {
+		return nil, err
+	}
+	ignore := "*\n!.gitignore\n!" + configName + "\n"
+	if err := os.WriteFile(filepath.Join(dir, ".gitignore"), []byte(ignore), 0644); err != nil {
+		return nil, err
+	}
+	return repo, nil
+}
+
+// Commit records the current config with the given message. Nothing is
+// committed when the config matches the last commit. Only the config is
+// committed, whatever else is staged in the repository's index.
+func (hs *HistoryService) Commit(message string) error {
+	hs.mu.Lock()
+	defer hs.mu.Unlock()
+
+	content, err := os.ReadFile(hs.abs)
+	if err != nil {
+		return err
+	}
+	if head, err := hs.headContent(); err == nil && bytes.Equal(head, content) {
+		return nil
+	}
+	if hs.copy != "" {
+		if err := os.WriteFile(hs.copy, content, 0644); err != nil {
+			return err
+		}
+	}
+	paths := []string{hs.path}
+	if _, err := hs.repo.Head(); errors.Is(err, plumbing.ErrReferenceNotFound) {
+		paths = append(paths, ".gitignore")
+	}
+	return hs.commitPaths(message, paths)
+}
+
+// commitPaths commits the worktree files at paths, which are in the
+// worktree root, on top of HEAD's tree, leaving every other path as HEAD has
+// it. A path missing from the worktree is left out. The index is updated
+// for the committed paths only.
+func (hs *HistoryService) commitPaths(message string, paths []string) error {
+	wt, err := hs.repo.Worktree()
+	if err != nil {
+		return err
+	}
+	entries := map[string]object.TreeEntry{}
+	var parents []plumbing.Hash
+	head, err := hs.repo.Head()
+	switch {
+	case err == nil:
+		c, err := hs.repo.CommitObject(head.Hash())
+		if err != nil {
+			return err
+		}
+		tree, err := c.Tree()
+		if err != nil {
+			return err
+		}
+		for _, e := range tree.Entries {
+			entries[e.Name] = e
+		}
+		parents = []plumbing.Hash{c.Hash}
+	case !errors.Is(err, plumbing.ErrReferenceNotFound):
+		return err
+	}
+
+	changed := false
+	for _, p := range paths {
+		content, err := os.ReadFile(filepath.Join(wt.Filesystem.Root(), p))
+		if errors.Is(err, os.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		hash, err := hs.storeObject(plumbing.BlobObject, content)
+		if err != nil {
+			return err
+		}
+		if e, ok := entries[p]; ok && e.Hash == hash && e.Mode == filemode.Regular {
+			continue
+		}
+		entries[p] = object.TreeEntry{Name: p, Mode: filemode.Regular, Hash: hash}
+		changed = true
+		if err := wt.AddWithOptions(&git.AddOptions{Path: p, SkipStatus: true}); err != nil {
+			return err
+		}
+	}
+	if !changed {
+		return nil
+	}
+
+	tree := &object.Tree{}
+	for _, e := range entries {
+		tree.Entries = append(tree.Entries, e)
+	}
+	// Git orders tree entries by name, comparing directories as if their
+	// names ended in a slash.
+	sortName := func(e object.TreeEntry) string {
+		if e.Mode == filemode.Dir {
+			return e.Name + "/"
+		}
+		return e.Name
+	}
+	sort.Slice(tree.Entries, func(i, j int) bool { return sortName(tree.Entries[i]) < sortName(tree.Entries[j]) })
+	treeHash, err := hs.storeEncoded(tree)
+	if err != nil {
+		return err
+	}
+	sig := historySignature
+	sig.When = time.Now()
+	commitHash, err := hs.storeEncoded(&object.Commit{
+		Author:       sig,
+		Committer:    sig,
+		Message:      message,
+		TreeHash:     treeHash,
+		ParentHashes: parents,
+	})
+	if err != nil {
+		return err
+	}
+	return hs.setHead(commitHash)
+}
+
+// setHead moves the branch HEAD points at, or HEAD itself when detached, to
+// hash.
+func (hs *HistoryService) setHead(hash plumbing.Hash) error {
+	name := plumbing.HEAD
+	ref, err := hs.repo.Storer.Reference(plumbing.HEAD)
+	if err != nil {
+		return err
+	}
+	if ref.Type() == plumbing.SymbolicReference {
+		name = ref.Target()
+	}
+	return hs.repo.Storer.SetReference(plumbing.NewHashReference(name, hash))
+}
+
+func (hs *HistoryService) storeObject(t plumbing.ObjectType, content []byte) (plumbing.Hash, error) {
+	obj := hs.repo.Storer.NewEncodedObject()
+	obj.SetType(t)
+	w, err := obj.Writer()
+	if err != nil {
+		return plumbing.ZeroHash, err
+	}
+	if _, err := w.Write(content); err != nil {
+		return plumbing.ZeroHash, err
+	}
+	if err := w.Close(); err != nil {
+		return plumbing.ZeroHash, err
+	}
+	return hs.repo.Storer.SetEncodedObject(obj)
+}
+
+func (hs *HistoryService) storeEncoded(o interface {
+	Encode(plumbing.EncodedObject) error
+}) (plumbing.Hash, error) {
+	obj := hs.repo.Storer.NewEncodedObject()
+	if err := o.Encode(obj); err != nil {
+		return plumbing.ZeroHash, err
+	}
+	return hs.repo.Storer.SetEncodedObject(obj)
+}
+
+// Log returns up to limit commits that changed the config, newest first.
+func (hs *HistoryService) Log(limit int) ([]HistoryEntry, error) {
+	hs.mu.Lock()
+	defer hs.mu.Unlock()
+
+	entries := []HistoryEntry{}
+	if _, err := hs.repo.Head(); errors.Is(err, plumbing.ErrReferenceNotFound) {
+		return entries, nil
+	}
+	iter, err := hs.repo.Log(&git.LogOptions{FileName: &hs.path})
+	if err != nil {
+		return nil, err
+	}
+	defer iter.Close()
+	for len(entries) < limit {
+		c, err := iter.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		entries = append(entries, historyEntry(c))
+	}
+	return entries, nil
+}
+
+// Diff returns a unified diff of the config change made by a commit.
+func (hs *HistoryService) Diff(rev string) (string, error) {
+	hs.mu.Lock()
+	defer hs.mu.Unlock()
+
+	c, err := hs.commit(rev)
+	if err != nil {
+		return "", err
+	}
+	after, err := hs.fileAt(c)
+	if err != nil {
+		return "", err
+	}
+	var before []byte
+	if c.NumParents() > 0 {
+		parent, err := c.Parent(0)
+		if err != nil {
+			return "", err
+		}
+		// The config may not exist before the first commit that tracks it.
+		before, _ = hs.fileAt(parent)
+	}
+	return configDiff("a/"+hs.path, "b/"+hs.path, before, after), nil
+}
+
+// Content returns the config as it was at a commit.
+func (hs *HistoryService) Content(rev string) ([]byte, string, error) {
+	hs.mu.Lock()
+	defer hs.mu.Unlock()
+
+	c, err := hs.commit(rev)
+	if err != nil {
+		return nil, "", err
+	}
+	content, err := hs.fileAt(c)
+	if err != nil {
+		return nil, "", err
+	}
+	return content, c.Hash.String()[:7], nil
+}
+
+// BlameFeed attributes each line of a feed's settings to the commit that last
+// changed it.
+func (hs *HistoryService) BlameFeed(feedKey string) ([]BlameLine, error) {
+	hs.mu.Lock()
+	defer hs.mu.Unlock()
+
+	head, err := hs.commit("HEAD")
+	if err != nil {
+		return nil, err
+	}
+	content, err := hs.fileAt(head)
+	if err != nil {
+		return nil, err
+	}
+	doc, err := tomledit.Parse(content)
+	if err != nil {
+		return nil, err
+	}
+	ranges := doc.LineRanges([]string{"feeds", feedKey})
+	if len(ranges) == 0 {
+		return nil, fmt.Errorf("%w: %s", ErrFeedNotFound, feedKey)
+	}
+	blame, err := git.Blame(head, hs.path)
+	if err != nil {
+		return nil, err
+	}
+
+	commits := map[plumbing.Hash]HistoryEntry{}
+	var lines []BlameLine
+	for _, r := range ranges {
+		for n := r[0]; n <= r[1] && n <= len(blame.Lines); n++ {
+			l := blame.Lines[n-1]
+			entry, ok := commits[l.Hash]
+			if !ok {
+				c, err := hs.repo.CommitObject(l.Hash)
+				if err != nil {
+					return nil, err
+				}
+				entry = historyEntry(c)
+				commits[l.Hash] = entry
+			}
+			lines = append(lines, BlameLine{Line: n, Text: l.Text, HistoryEntry: entry})
+		}
+	}
+	return lines, nil
+}
+
+func (hs *HistoryService) commit(rev string) (*object.Commit, error) {
+	hash, err := hs.repo.ResolveRevision(plumbing.Revision(rev))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrCommitNotFound, rev)
+	}
+	return hs.repo.CommitObject(*hash)
+}
+
+func (hs *HistoryService) fileAt(c *object.Commit) ([]byte, error) {
+	f, err := c.File(hs.path)
+	if errors.Is(err, object.ErrFileNotFound) {
+		return nil, fmt.Errorf("%w: %s does not exist at %s", ErrCommitNotFound, hs.path, c.Hash.String()[:7])
+	}
+	if err != nil {
+		return nil, err
+	}
+	content, err := f.Contents()
+	return []byte(content), err
+}
+
+func (hs *HistoryService) headContent() ([]byte, error) {
+	head, err := hs.commit("HEAD")
+	if err != nil {
+		return nil, err
+	}
+	return hs.fileAt(head)
+}
+
+func historyEntry(c *object.Commit) HistoryEntry {
+	msg := c.Message
+	if i := bytes.IndexByte([]byte(msg), '\n'); i >= 0 {
+		msg = msg[:i]
+	}
+	return HistoryEntry{
+		Hash:      c.Hash.String(),
+		ShortHash: c.Hash.String()[:7],
+		Message:   msg,
+		When:      c.Author.When,
+	}
+}
@@ -0,0 +1,190 @@
+package server
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing/object"
+)
+
+// stageFile writes a file into a repository's worktree and stages it.
+func stageFile(t *testing.T, repo *git.Repository, name, content string) {
+	t.Helper()
+	wt, err := repo.Worktree()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(wt.Filesystem.Root(), name), []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := wt.Add(name); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// headFiles returns the names of the files in a repository's HEAD commit.
+func headFiles(t *testing.T, repo *git.Repository) []string {
+	t.Helper()
+	head, err := repo.Head()
+	if err != nil {
+		t.Fatal(err)
+	}
+	c, err := repo.CommitObject(head.Hash())
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	files, err := c.Files()
+	if err != nil {
+		t.Fatal(err)
+	}
+	files.ForEach(func(f *object.File) error {
+		names = append(names, f.Name)
+		return nil
+	})
+	slices.Sort(names)
+	return names
+}
+
+func TestOpenHistory(t *testing.T) {
+	tests := []struct {
+		name string
+		// setup prepares root, which holds the config at sub/config.toml,
+		// and returns a repository to check afterwards, if any.
+		setup func(t *testing.T, root string) *git.Repository
+		// repoDir is where the history repository must end up, under root.
+		repoDir string
+		// copy keeps the history in root/history.
+		copy    bool
+		want    []string
+		entries int
+		check   func(t *testing.T, repo *git.Repository) // the repository setup returned
+	}{
+		{
+			name:    "new repository",
+			repoDir: "sub",
+			want:    []string{".gitignore", "config.toml"},
+			entries: 1,
+		},
+		{
+			name: "repository around a parent directory",
+			setup: func(t *testing.T, root string) *git.Repository {
+				repo, err := git.PlainInit(root, false)
+				if err != nil {
+					t.Fatal(err)
+				}
+				stageFile(t, repo, "notes.txt", "unrelated")
+				return repo
+			},
+			repoDir: "sub",
+			want:    []string{".gitignore", "config.toml"},
+			entries: 1,
+			check: func(t *testing.T, parent *git.Repository) {
+				if _, err := parent.Head(); err == nil {
+					t.Error("parent repository gained a commit")
+				}
+				idx, err := parent.Storer.Index()
+				if err != nil {
+					t.Fatal(err)
+				}
+				if _, err := idx.Entry("notes.txt"); err != nil {
+					t.Error("parent repository lost its staged file")
+				}
+				if _, err := idx.Entry("sub/config.toml"); err == nil {
+					t.Error("config was staged in the parent repository")
+				}
+			},
+		},
+		{
+			name: "existing repository with other files staged",
+			setup: func(t *testing.T, root string) *git.Repository {
+				repo, err := git.PlainInit(filepath.Join(root, "sub"), false)
+				if err != nil {
+					t.Fatal(err)
+				}
+				stageFile(t, repo, "notes.txt", "unrelated")
+				return repo
+			},
+			repoDir: "sub",
+			want:    []string{"config.toml"},
+			entries: 1,
+			check: func(t *testing.T, repo *git.Repository) {
+				idx, err := repo.Storer.Index()
+				if err != nil {
+					t.Fatal(err)
+				}
+				if _, err := idx.Entry("notes.txt"); err != nil {
+					t.Error("staged file was dropped from the index")
+				}
+			},
+		},
+		{
+			name:    "separate history directory",
+			repoDir: "history",
+			copy:    true,
+			want:    []string{".gitignore", "config.toml"},
+			entries: 1,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			root := t.TempDir()
+			if err := os.MkdirAll(filepath.Join(root, "sub"), 0755); err != nil {
+				t.Fatal(err)
+			}
+			var other *git.Repository
+			if tt.setup != nil {
+				other = tt.setup(t, root)
+			}
+			configPath := filepath.Join(root, "sub", "config.toml")
+			if err := os.WriteFile(configPath, []byte("[server]\nport = 8080\n"), 0644); err != nil {
+				t.Fatal(err)
+			}
+			dir := ""
+			if tt.copy {
+				dir = filepath.Join(root, "history")
+			}
+			hs, err := OpenHistory(configPath, dir)
+			if err != nil {
+				t.Fatalf("OpenHistory: %v", err)
+			}
+
+			repo, err := git.PlainOpen(filepath.Join(root, tt.repoDir))
+			if err != nil {
+				t.Fatalf("no repository in %s: %v", tt.repoDir, err)
+			}
+			if got := headFiles(t, repo); !slices.Equal(got, tt.want) {
+				t.Errorf("committed %v, want %v", got, tt.want)
+			}
+			if entries, err := hs.Log(10); err != nil || len(entries) != tt.entries {
+				t.Errorf("Log = %d entries, %v; want %d", len(entries), err, tt.entries)
+			}
+			if tt.check != nil {
+				tt.check(t, other)
+			}
+
+			if err := os.WriteFile(configPath, []byte("[server]\nport = 9090\n"), 0644); err != nil {
+				t.Fatal(err)
+			}
+			if err := hs.Commit("Change port"); err != nil {
+				t.Fatalf("Commit: %v", err)
+			}
+			if err := hs.Commit("Nothing changed"); err != nil {
+				t.Fatalf("Commit: %v", err)
+			}
+			entries, err := hs.Log(10)
+			if err != nil || len(entries) != tt.entries+1 || entries[0].Message != "Change port" {
+				t.Errorf("Log after a change = %+v, %v", entries, err)
+			}
+			if content, _, err := hs.Content("HEAD"); err != nil || string(content) != "[server]\nport = 9090\n" {
+				t.Errorf("Content(HEAD) = %q, %v", content, err)
+			}
+			if got := headFiles(t, repo); !slices.Equal(got, tt.want) {
+				t.Errorf("committed %v after a change, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,222 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/Takenobou/podconfig/internal/atomicfile"
+	"github.com/Takenobou/podconfig/internal/podsync"
+)
+
+// Operations recorded in the change journal.
+const (
+	OpAdd      = "add"
+	OpModify   = "modify"
+	OpRemove   = "remove"
+	OpRestore  = "restore"
+	OpRevert   = "revert"
+	OpExternal = "external-edit"
+	OpRawEdit  = "raw-edit"
+	OpSettings = "settings"
+)
+
+// ChangeEntry is a single change to the config.
+type ChangeEntry struct {
+	ID        string    `json:"id"`
+	Time      time.Time `json:"time"`
+	Actor     string    `json:"actor"`
+	Operation string    `json:"operation"`
+	// FeedKey, Before and After are set for changes to a single feed. Before
+	// is nil for an added feed and After is nil for a removed one.
+	FeedKey string        `json:"feed_key,omitempty"`
+	Before  *podsync.Feed `json:"before,omitempty"`
+	After   *podsync.Feed `json:"after,omitempty"`
+	// Staged is set in the journal for changes that are staged but not yet
+	// written to the live config.
+	Staged bool `json:"staged,omitempty"`
+	// Raw is a removed feed's table as written (see FeedChange.Raw).
+	Raw string `json:"raw,omitempty"`
+	// Settings lists the changed settings for changes not limited to one feed.
+	Settings []podsync.Change `json:"settings,omitempty"`
+	Message  string           `json:"message"`
+}
+
+// Fields lists the settings the change affected.
+func (e ChangeEntry) Fields() []podsync.Change {
+	if e.FeedKey == "" {
+		return e.Settings
+	}
+	return podsync.Diff([]string{"feeds", e.FeedKey}, e.Before, e.After)
+}
+
+// newEntry describes a change made through the web interface.
+func newEntry(r *http.Request, op string, msg string) ChangeEntry {
+	now := time.Now().UTC()
+	return ChangeEntry{
+		ID:        strconv.FormatInt(now.UnixNano(), 36),
+		Time:      now,
+		Actor:     requestActor(r),
+		Operation: op,
+		Message:   msg,
+	}
+}
+
+// newFeedEntry describes a change made through the web interface to one feed.
+func newFeedEntry(r *http.Request, op string, change *FeedChange, msg string) ChangeEntry {
+	entry := newEntry(r, op, msg)
+	entry.FeedKey = change.Key
+	entry.Before = change.Before
+	entry.After = change.After
+	entry.Raw = change.Raw
+	return entry
+}
+
+// newConfigEntry describes a change made through the web interface to
+// settings outside a single feed.
+func newConfigEntry(r *http.Request, op string, before, after *podsync.Config, msg string) ChangeEntry {
+	entry := newEntry(r, op, msg)
+	entry.Settings = podsync.DiffConfig(before, after)
+	return entry
+}
+
+// feedOperation names the operation that takes a feed from before to after.
+func feedOperation(before, after *podsync.Feed) string {
+	switch {
+	case before == nil:
+		return OpAdd
+	case after == nil:
+		return OpRemove
+	}
+	return OpModify
+}
+
+// requestActor names whoever made a request: the user reported by an
+// authenticating proxy if there is one, otherwise the client address.
+func requestActor(r *http.Request) string {
+	for _, header := range []string{"X-Forwarded-User", "X-Remote-User", "Remote-User"} {
+		if user := r.Header.Get(header); user != "" {
+			return user
+		}
+	}
+	if host, _, err := net.SplitHostPort(r.RemoteAddr); err == nil {
+		return host
+	}
+	return r.RemoteAddr
+}
+
+// JournalService keeps the changes the running podsync container has not
+// picked up yet, both those written to the live config and those still
+// staged. They are stored on disk, so a podconfig restart does not forget
+// that podsync is out of date.
+type JournalService struct {
+	mu      sync.Mutex
+	path    string
+	entries []ChangeEntry
+}
+
+// OpenJournal loads the journal at path, starting an empty one if it does not
+// exist yet.
+func OpenJournal(path string) (*JournalService, error) {
+	j := &JournalService{path: path}
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return j, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, &j.entries); err != nil {
+		return nil, fmt.Errorf("reading journal %s: %w", path, err)
+	}
+	return j, nil
+}
+
+// Add appends entries written to the live config to the journal.
+func (j *JournalService) Add(entries ...ChangeEntry) error {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	j.entries = append(j.entries, entries...)
+	return j.save()
+}
+
+// Stage appends a staged change to the journal.
+func (j *JournalService) Stage(entry ChangeEntry) error {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	entry.Staged = true
+	j.entries = append(j.entries, entry)
+	return j.save()
+}
+
+// Apply replaces the staged changes with entries, the changes the applied
+// draft was made of, now that they are in the live config.
+func (j *JournalService) Apply(entries ...ChangeEntry) error {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	j.entries = j.keep(false)
+	for _, e := range entries {
+		e.Staged = false
+		j.entries = append(j.entries, e)
+	}
+	return j.save()
+}
+
+// Discard removes the staged changes, once they have been thrown away.
+func (j *JournalService) Discard() error {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	j.entries = j.keep(false)
+	return j.save()
+}
+
+// Entries returns a snapshot of the journal, oldest first.
+func (j *JournalService) Entries() []ChangeEntry {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	cpy := make([]ChangeEntry, len(j.entries))
+	copy(cpy, j.entries)
+	return cpy
+}
+
+// Clear removes the changes written to the live config, once podsync has
+// been reloaded with them. Staged changes are kept.
+func (j *JournalService) Clear() error {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	j.entries = j.keep(true)
+	return j.save()
+}
+
+// keep returns the entries whose Staged flag is staged. Callers must hold j.mu.
+func (j *JournalService) keep(staged bool) []ChangeEntry {
+	var kept []ChangeEntry
+	for _, e := range j.entries {
+		if e.Staged == staged {
+			kept = append(kept, e)
+		}
+	}
+	return kept
+}
+
+// save writes the journal to disk. Callers must hold j.mu.
+func (j *JournalService) save() error {
+	if err := os.MkdirAll(filepath.Dir(j.path), 0755); err != nil {
+		return err
+	}
+	entries := j.entries
+	if entries == nil {
+		entries = []ChangeEntry{}
+	}
+	data, err := json.MarshalIndent(entries, "", "  ")
+	if err != nil {
+		return err
+	}
+	return atomicfile.WriteFile(j.path, data, 0644)
+}
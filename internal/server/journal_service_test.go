@@ -0,0 +1,164 @@
+package server
+
+import (
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/Takenobou/podconfig/internal/podsync"
+)
+
+// entryIDs lists the IDs of entries, with a "*" after staged ones.
+func entryIDs(entries []ChangeEntry) []string {
+	ids := []string{}
+	for _, e := range entries {
+		id := e.ID
+		if e.Staged {
+			id += "*"
+		}
+		ids = append(ids, id)
+	}
+	return ids
+}
+
+func TestJournalPersists(t *testing.T) {
+	tests := []struct {
+		name string
+		ops  func(j *JournalService) error
+		want []string
+	}{
+		{"empty", func(j *JournalService) error { return nil }, []string{}},
+		{"added", func(j *JournalService) error {
+			return j.Add(ChangeEntry{ID: "a1"}, ChangeEntry{ID: "a2"})
+		}, []string{"a1", "a2"}},
+		{"staged", func(j *JournalService) error {
+			return j.Stage(ChangeEntry{ID: "s1"})
+		}, []string{"s1*"}},
+		{"applied", func(j *JournalService) error {
+			if err := j.Add(ChangeEntry{ID: "a1"}); err != nil {
+				return err
+			}
+			if err := j.Stage(ChangeEntry{ID: "s1"}); err != nil {
+				return err
+			}
+			return j.Apply(ChangeEntry{ID: "s1"})
+		}, []string{"a1", "s1"}},
+		{"discarded", func(j *JournalService) error {
+			if err := j.Add(ChangeEntry{ID: "a1"}); err != nil {
+				return err
+			}
+			if err := j.Stage(ChangeEntry{ID: "s1"}); err != nil {
+				return err
+			}
+			return j.Discard()
+		}, []string{"a1"}},
+		{"cleared after a reload", func(j *JournalService) error {
+			if err := j.Add(ChangeEntry{ID: "a1"}); err != nil {
+				return err
+			}
+			if err := j.Stage(ChangeEntry{ID: "s1"}); err != nil {
+				return err
+			}
+			return j.Clear()
+		}, []string{"s1*"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "state", "journal.json")
+			j, err := OpenJournal(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := tt.ops(j); err != nil {
+				t.Fatal(err)
+			}
+			if got := entryIDs(j.Entries()); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("entries = %v, want %v", got, tt.want)
+			}
+			reopened, err := OpenJournal(path)
+			if err != nil {
+				t.Fatalf("OpenJournal after a restart: %v", err)
+			}
+			if got := entryIDs(reopened.Entries()); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("entries after a restart = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestJournalKeepsEntryDetails(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "journal.json")
+	j, err := OpenJournal(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	entry := ChangeEntry{
+		ID:        "r1",
+		Time:      time.Date(2026, 10, 17, 12, 0, 0, 0, time.UTC),
+		Actor:     "alice",
+		Operation: OpRemove,
+		FeedKey:   "news",
+		Before:    &podsync.Feed{URL: "https://www.youtube.com/channel/UCnews", PageSize: 10},
+		Raw:       "[feeds.news]\nurl = \"https://www.youtube.com/channel/UCnews\"\nunknown_key = 1\n",
+		Message:   "Removed feed news",
+	}
+	settings := ChangeEntry{
+		ID:        "s1",
+		Operation: OpSettings,
+		Settings:  []podsync.Change{{Path: "server.port", Before: "8080", After: "9090"}},
+		Message:   "Changed server settings",
+		Staged:    true,
+	}
+	if err := j.Add(entry); err != nil {
+		t.Fatal(err)
+	}
+	if err := j.Stage(settings); err != nil {
+		t.Fatal(err)
+	}
+	reopened, err := OpenJournal(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := reopened.Entries(), []ChangeEntry{entry, settings}; !reflect.DeepEqual(got, want) {
+		t.Errorf("entries after a restart =\n%+v\nwant\n%+v", got, want)
+	}
+}
+
+func TestOpenJournalCorrupt(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "journal.json")
+	if err := os.WriteFile(path, []byte("{not json"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := OpenJournal(path); err == nil {
+		t.Error("OpenJournal read a corrupt journal without an error")
+	}
+}
+
+func TestRequestActor(t *testing.T) {
+	tests := []struct {
+		name    string
+		headers map[string]string
+		remote  string
+		want    string
+	}{
+		{"client address", nil, "192.0.2.1:1234", "192.0.2.1"},
+		{"address without port", nil, "192.0.2.1", "192.0.2.1"},
+		{"forwarded user", map[string]string{"X-Forwarded-User": "alice", "Remote-User": "bob"}, "192.0.2.1:1234", "alice"},
+		{"remote user", map[string]string{"Remote-User": "bob"}, "192.0.2.1:1234", "bob"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest("POST", "/modify", nil)
+			r.RemoteAddr = tt.remote
+			for k, v := range tt.headers {
+				r.Header.Set(k, v)
+			}
+			if got := requestActor(r); got != tt.want {
+				t.Errorf("requestActor = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
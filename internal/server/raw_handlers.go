@@ -0,0 +1,95 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+
+	"github.com/Takenobou/podconfig/internal/tomledit"
+)
+
+// maxConfigSize limits the config text accepted from the raw editor.
+const maxConfigSize = 1 << 20
+
+// ConfigPageHandler renders the raw config editor.
+func (h *Handler) ConfigPageHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if err := tmpl.ExecuteTemplate(w, "configPage", nil); err != nil {
+		log.Printf("Error executing template: %v", err)
+	}
+}
+
+// RawConfigHandler returns the config text on GET, with its version as the
+// ETag, and stages a replacement for it on PUT.
+func (h *Handler) RawConfigHandler(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		content, version, err := h.FeedService.ReadRawConfig(h.PodsyncConfigPath)
+		if err != nil {
+			log.Printf("Error reading config: %v", err)
+			http.Error(w, "Failed to read config", http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		w.Header().Set("ETag", `"`+version+`"`)
+		w.Write(content)
+	case http.MethodPut:
+		h.putRawConfig(w, r)
+	default:
+		http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+func (h *Handler) putRawConfig(w http.ResponseWriter, r *http.Request) {
+	version, ok := requestVersion(w, r)
+	if !ok {
+		return
+	}
+	content, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxConfigSize))
+	if err != nil {
+		http.Error(w, fmt.Sprintf("The config must be at most %d bytes", maxConfigSize), http.StatusRequestEntityTooLarge)
+		return
+	}
+	before, after, err := h.FeedService.WriteRawConfig(h.PodsyncConfigPath, version, content)
+	if errors.Is(err, ErrNoChange) {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]string{"message": "No changes to stage."})
+		return
+	}
+	if syntaxFailed(w, err) || conflictFailed(w, err) || validationFailed(w, err) || lockFailed(w, err) {
+		return
+	}
+	if err != nil {
+		log.Printf("Error writing config: %v", err)
+		http.Error(w, "Failed to update config", http.StatusInternalServerError)
+		return
+	}
+
+	h.stageChange(newConfigEntry(r, OpRawEdit, before, after, "Edited config.toml"))
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"message": "Config edit staged. Apply the staged changes to save it."})
+}
+
+// syntaxFailed writes a 400 response giving the line and column of the error
+// as JSON if err is a TOML syntax error, and reports whether it did.
+func syntaxFailed(w http.ResponseWriter, err error) bool {
+	var serr *tomledit.SyntaxError
+	if !errors.As(err, &serr) {
+		return false
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusBadRequest)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"error":  serr.Error(),
+		"line":   serr.Line,
+		"column": serr.Column,
+	})
+	return true
+}
@@ -0,0 +1,68 @@
+package server
+
+import (
+	"bytes"
+	"errors"
+	"os"
+
+	"github.com/Takenobou/podconfig/internal/podsync"
+	"github.com/Takenobou/podconfig/internal/tomledit"
+)
+
+// ErrNoChange is returned when an edit leaves the config as it was.
+var ErrNoChange = errors.New("no change")
+
+// ReadRawConfig returns the text of the config being edited (the staged
+// changes if there are any), with API keys masked, and its version.
+func (fs *FeedService) ReadRawConfig(configPath string) ([]byte, string, error) {
+	fs.mu.RLock()
+	defer fs.mu.RUnlock()
+
+	content, err := os.ReadFile(fs.workingPath(configPath))
+	if err != nil {
+		return nil, "", err
+	}
+	return maskSecrets(content), fs.rememberVersion(content), nil
+}
+
+// WriteRawConfig stages content as the whole config text. Masked API keys, as
+// returned by ReadRawConfig, stand for the keys they mask. It is rejected with
+// a *tomledit.SyntaxError if it is not valid TOML, or with a validation error
+// if it adds problems podsync would refuse or has a masked key that matches
+// no current key. It returns the configuration before and after the edit.
+func (fs *FeedService) WriteRawConfig(configPath string, version string, content []byte) (before, after *podsync.Config, err error) {
+	unlock, err := fs.lock(configPath)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer unlock()
+
+	current, err := os.ReadFile(fs.workingPath(configPath))
+	if err != nil {
+		return nil, nil, err
+	}
+	if err := fs.checkVersion(version, current); err != nil {
+		return nil, nil, err
+	}
+	if content, err = unmaskSecrets(current, content); err != nil {
+		return nil, nil, err
+	}
+	if bytes.Equal(current, content) {
+		return nil, nil, ErrNoChange
+	}
+	if after, err = loadModel(content); err != nil {
+		var serr *tomledit.SyntaxError
+		if errors.As(err, &serr) {
+			return nil, nil, err
+		}
+		// Valid TOML that podsync cannot load, such as a token that is not a string.
+		return nil, nil, &podsync.ValidationError{Problems: []podsync.Problem{{Path: "config.toml", Message: err.Error()}}}
+	}
+	if before, err = loadModel(current); err != nil {
+		before = &podsync.Config{}
+	}
+	if err := fs.writeDraft(configPath, current, content); err != nil {
+		return nil, nil, err
+	}
+	return before, after, nil
+}
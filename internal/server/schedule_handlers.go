@@ -0,0 +1,73 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+	// The container may not ship a zoneinfo database.
+	_ "time/tzdata"
+
+	"github.com/robfig/cron/v3"
+)
+
+const (
+	defaultScheduleRuns = 5
+	maxScheduleRuns     = 50
+)
+
+// SchedulePreviewHandler parses a cron_schedule as podsync does and lists its
+// next runs, so a schedule can be checked before it is saved. It takes
+// cron_schedule, an optional IANA timezone tz (UTC by default, which is also
+// what podsync uses unless its container sets TZ) and the number of runs n.
+func (h *Handler) SchedulePreviewHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	q := r.URL.Query()
+	expr := q.Get("cron_schedule")
+	if expr == "" {
+		http.Error(w, "cron_schedule is required", http.StatusBadRequest)
+		return
+	}
+	tz := q.Get("tz")
+	if tz == "" {
+		tz = "UTC"
+	}
+	loc, err := time.LoadLocation(tz)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Unknown timezone %q", tz), http.StatusBadRequest)
+		return
+	}
+	n := defaultScheduleRuns
+	if val := q.Get("n"); val != "" {
+		n, err = strconv.Atoi(val)
+		if err != nil || n < 1 || n > maxScheduleRuns {
+			http.Error(w, fmt.Sprintf("n must be between 1 and %d", maxScheduleRuns), http.StatusBadRequest)
+			return
+		}
+	}
+	schedule, err := cron.ParseStandard(expr)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Invalid cron expression: %v", err), http.StatusBadRequest)
+		return
+	}
+
+	runs := make([]string, 0, n)
+	next := time.Now().In(loc)
+	for i := 0; i < n; i++ {
+		next = schedule.Next(next)
+		if next.IsZero() {
+			break
+		}
+		runs = append(runs, next.In(loc).Format(time.RFC3339))
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"cron_schedule": expr,
+		"timezone":      loc.String(),
+		"runs":          runs,
+	})
+}
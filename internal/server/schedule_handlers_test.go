@@ -0,0 +1,102 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Takenobou/podconfig/internal/podsync"
+)
+
+func TestSchedulePreview(t *testing.T) {
+	tests := []struct {
+		name     string
+		query    url.Values
+		status   int
+		runs     int
+		timezone string
+	}{
+		{"defaults", url.Values{"cron_schedule": {"0 */6 * * *"}}, http.StatusOK, defaultScheduleRuns, "UTC"},
+		{"one run", url.Values{"cron_schedule": {"0 */6 * * *"}, "n": {"1"}}, http.StatusOK, 1, "UTC"},
+		{"most runs", url.Values{"cron_schedule": {"@hourly"}, "n": {"50"}}, http.StatusOK, maxScheduleRuns, "UTC"},
+		{"timezone", url.Values{"cron_schedule": {"30 8 * * 1-5"}, "tz": {"Europe/London"}}, http.StatusOK, defaultScheduleRuns, "Europe/London"},
+		{"no expression", url.Values{}, http.StatusBadRequest, 0, ""},
+		{"invalid expression", url.Values{"cron_schedule": {"every day"}}, http.StatusBadRequest, 0, ""},
+		{"unknown timezone", url.Values{"cron_schedule": {"@daily"}, "tz": {"Mars/Olympus"}}, http.StatusBadRequest, 0, ""},
+		{"no runs", url.Values{"cron_schedule": {"@daily"}, "n": {"0"}}, http.StatusBadRequest, 0, ""},
+		{"too many runs", url.Values{"cron_schedule": {"@daily"}, "n": {"51"}}, http.StatusBadRequest, 0, ""},
+		{"runs not a number", url.Values{"cron_schedule": {"@daily"}, "n": {"five"}}, http.StatusBadRequest, 0, ""},
+	}
+	h := newTestHandler(t, feedFieldsConfig)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := serve(h.SchedulePreviewHandler, httptest.NewRequest(http.MethodGet, "/schedule/preview?"+tt.query.Encode(), nil))
+			if rec.Code != tt.status {
+				t.Fatalf("status = %d, want %d: %s", rec.Code, tt.status, rec.Body)
+			}
+			if tt.status != http.StatusOK {
+				return
+			}
+			var resp struct {
+				Timezone string   `json:"timezone"`
+				Runs     []string `json:"runs"`
+			}
+			if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil {
+				t.Fatal(err)
+			}
+			if resp.Timezone != tt.timezone {
+				t.Errorf("timezone = %q, want %q", resp.Timezone, tt.timezone)
+			}
+			if len(resp.Runs) != tt.runs {
+				t.Fatalf("%d runs, want %d", len(resp.Runs), tt.runs)
+			}
+			var last time.Time
+			for _, run := range resp.Runs {
+				next, err := time.Parse(time.RFC3339, run)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if !next.After(last) {
+					t.Errorf("run %s is not after %s", run, last.Format(time.RFC3339))
+				}
+				last = next
+			}
+		})
+	}
+}
+
+func TestSchedulePreviewMethod(t *testing.T) {
+	h := newTestHandler(t, feedFieldsConfig)
+	req := httptest.NewRequest(http.MethodPost, "/schedule/preview", strings.NewReader("cron_schedule=@daily"))
+	if rec := serve(h.SchedulePreviewHandler, req); rec.Code != http.StatusMethodNotAllowed {
+		t.Errorf("status = %d, want %d", rec.Code, http.StatusMethodNotAllowed)
+	}
+}
+
+func TestModifySchedule(t *testing.T) {
+	runFeedCases(t, []feedCase{
+		{"interval", url.Values{"schedule": {"interval"}, "update_period": {"6h"}}, http.StatusOK, func(f *podsync.Feed) {
+			f.UpdatePeriod = "6h"
+		}},
+		{"cron", url.Values{"schedule": {"cron"}, "cron_schedule": {"0 */6 * * *"}}, http.StatusOK, func(f *podsync.Feed) {
+			f.CronSchedule = "0 */6 * * *"
+		}},
+		{"cron drops the interval", url.Values{"schedule": {"cron"}, "cron_schedule": {"@daily"}, "update_period": {"6h"}}, http.StatusOK, func(f *podsync.Feed) {
+			f.CronSchedule = "@daily"
+		}},
+		{"interval drops the cron schedule", url.Values{"schedule": {"interval"}, "cron_schedule": {"@daily"}, "update_period": {"12h"}}, http.StatusOK, func(f *podsync.Feed) {
+			f.UpdatePeriod = "12h"
+		}},
+		{"cron schedule without a mode", url.Values{"cron_schedule": {"@hourly"}}, http.StatusOK, func(f *podsync.Feed) {
+			f.CronSchedule = "@hourly"
+		}},
+		{"cron without an expression", url.Values{"schedule": {"cron"}}, http.StatusBadRequest, nil},
+		{"unknown mode", url.Values{"schedule": {"weekly"}}, http.StatusBadRequest, nil},
+		{"invalid expression", url.Values{"schedule": {"cron"}, "cron_schedule": {"every day"}}, http.StatusUnprocessableEntity, nil},
+		{"invalid interval", url.Values{"schedule": {"interval"}, "update_period": {"daily"}}, http.StatusUnprocessableEntity, nil},
+	})
+}
@@ -0,0 +1,337 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Takenobou/podconfig/internal/podsync"
+)
+
+// SettingsPageHandler renders the forms for podsync's settings outside feeds.
+func (h *Handler) SettingsPageHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	cfg, version, err := h.FeedService.WorkingConfig(h.PodsyncConfigPath)
+	data := map[string]interface{}{
+		"Version": version,
+		"Message": r.URL.Query().Get("message"),
+	}
+	if err != nil {
+		log.Printf("Error reading config: %v", err)
+		data["ConfigError"] = err.Error()
+	} else {
+		data["Config"] = cfg
+		data["Tokens"] = maskTokens(cfg.Tokens)
+	}
+	if err := tmpl.ExecuteTemplate(w, "settingsPage", data); err != nil {
+		log.Printf("Error executing template: %v", err)
+	}
+}
+
+// ServerSettingsHandler returns the [server] settings as JSON on GET and
+// stages changes to them on POST.
+func (h *Handler) ServerSettingsHandler(w http.ResponseWriter, r *http.Request) {
+	h.settingsHandler(w, r, "server", func(cfg *podsync.Config) interface{} {
+		return cfg.Server
+	}, func(cfg *podsync.Config, form *settingsForm) {
+		s := &cfg.Server
+		form.String("hostname", &s.Hostname)
+		form.Int("port", &s.Port)
+		form.String("bind_address", &s.BindAddress)
+		form.String("path", &s.Path)
+		form.Bool("web_ui", &s.WebUI)
+		form.Bool("tls", &s.TLS)
+		form.String("certificate_path", &s.CertificatePath)
+		form.String("key_file_path", &s.KeyFilePath)
+	})
+}
+
+// StorageSettingsHandler returns the [storage] settings as JSON on GET and
+// stages changes to them on POST. The local and S3 fields are named by their
+// path below [storage], such as local.data_dir and s3.bucket.
+func (h *Handler) StorageSettingsHandler(w http.ResponseWriter, r *http.Request) {
+	h.settingsHandler(w, r, "storage", func(cfg *podsync.Config) interface{} {
+		return cfg.Storage
+	}, setStorage)
+}
+
+func setStorage(cfg *podsync.Config, form *settingsForm) {
+	s := &cfg.Storage
+	form.String("type", &s.Type)
+	form.String("local.data_dir", &s.Local.DataDir)
+	form.String("s3.endpoint_url", &s.S3.EndpointURL)
+	form.String("s3.region", &s.S3.Region)
+	form.String("s3.bucket", &s.S3.Bucket)
+	form.String("s3.prefix", &s.S3.Prefix)
+}
+
+// DownloaderSettingsHandler returns the [downloader] settings as JSON on GET
+// and stages changes to them on POST.
+func (h *Handler) DownloaderSettingsHandler(w http.ResponseWriter, r *http.Request) {
+	h.settingsHandler(w, r, "downloader", func(cfg *podsync.Config) interface{} {
+		return cfg.Downloader
+	}, func(cfg *podsync.Config, form *settingsForm) {
+		d := &cfg.Downloader
+		form.Bool("self_update", &d.SelfUpdate)
+		form.Int("timeout", &d.Timeout)
+		form.String("custom_binary", &d.CustomBinary)
+	})
+}
+
+// LogSettingsHandler returns the [log] settings as JSON on GET and stages
+// changes to them on POST.
+func (h *Handler) LogSettingsHandler(w http.ResponseWriter, r *http.Request) {
+	h.settingsHandler(w, r, "log", func(cfg *podsync.Config) interface{} {
+		return cfg.Log
+	}, func(cfg *podsync.Config, form *settingsForm) {
+		l := &cfg.Log
+		form.String("filename", &l.Filename)
+		form.Int("max_size", &l.MaxSize)
+		form.Int("max_backups", &l.MaxBackups)
+		form.Int("max_age", &l.MaxAge)
+		form.Bool("compress", &l.Compress)
+		form.Bool("debug", &l.Debug)
+	})
+}
+
+// StorageTestHandler checks that podsync could use the S3 storage by putting,
+// listing and deleting an object. It tests the staged settings, overridden by
+// any storage fields sent; access_key and secret_key may be sent to test with
+// credentials other than podconfig's own environment, and are not saved.
+func (h *Handler) StorageTestHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, "Invalid form", http.StatusBadRequest)
+		return
+	}
+	current, _, err := h.FeedService.WorkingConfig(h.PodsyncConfigPath)
+	if err != nil {
+		log.Printf("Error reading config: %v", err)
+		http.Error(w, "Failed to read config", http.StatusInternalServerError)
+		return
+	}
+	cfg := &podsync.Config{Storage: current.Storage}
+	setStorage(cfg, &settingsForm{values: r.PostForm})
+	if cfg.Storage.Type != "s3" {
+		http.Error(w, "The connection test is only available for S3 storage", http.StatusBadRequest)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), storageTestTimeout)
+	defer cancel()
+	checks, err := CheckS3(ctx, cfg.Storage.S3, r.PostForm.Get("access_key"), r.PostForm.Get("secret_key"))
+	msg := fmt.Sprintf("Connected to bucket '%s': put, list and delete all worked.", cfg.Storage.S3.Bucket)
+	if err != nil {
+		log.Printf("Storage check failed: %v", err)
+		msg = fmt.Sprintf("Storage check failed: %v", err)
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"ok":      err == nil,
+		"message": msg,
+		"checks":  checks,
+	})
+}
+
+// storageTestTimeout bounds the whole storage connection test.
+const storageTestTimeout = 20 * time.Second
+
+// settingsHandler serves one section of the settings: GET returns it as JSON,
+// keyed by TOML names, with the config version as the ETag; POST stages the
+// changes given as form fields. Fields that are not sent are left as they
+// are, and an empty value removes a setting.
+func (h *Handler) settingsHandler(w http.ResponseWriter, r *http.Request, section string,
+	get func(cfg *podsync.Config) interface{}, set func(cfg *podsync.Config, form *settingsForm)) {
+	switch r.Method {
+	case http.MethodGet:
+		cfg, version, err := h.FeedService.WorkingConfig(h.PodsyncConfigPath)
+		if err != nil {
+			log.Printf("Error reading config: %v", err)
+			http.Error(w, "Failed to read config", http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("ETag", `"`+version+`"`)
+		json.NewEncoder(w).Encode(podsync.Settings(get(cfg)))
+	case http.MethodPost:
+		h.updateSettings(w, r, section, set)
+	default:
+		http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+func (h *Handler) updateSettings(w http.ResponseWriter, r *http.Request, section string, set func(cfg *podsync.Config, form *settingsForm)) {
+	version, ok := requestVersion(w, r)
+	if !ok {
+		return
+	}
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, "Invalid form", http.StatusBadRequest)
+		return
+	}
+	form := &settingsForm{values: r.PostForm}
+	before, after, err := h.FeedService.UpdateSettings(h.PodsyncConfigPath, version, func(cfg *podsync.Config) error {
+		set(cfg, form)
+		return form.err
+	})
+	if fieldFailed(w, err) || conflictFailed(w, err) || validationFailed(w, err) || lockFailed(w, err) {
+		return
+	}
+	if err != nil {
+		log.Printf("Error updating %s settings: %v", section, err)
+		http.Error(w, "Failed to update config", http.StatusInternalServerError)
+		return
+	}
+
+	h.stageChange(newConfigEntry(r, OpSettings, before, after, fmt.Sprintf("Changed %s settings", section)))
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{
+		"message": fmt.Sprintf("Changes to the [%s] settings staged. Apply the staged changes to save them.", section),
+	})
+}
+
+// fieldError reports a form field that could not be parsed.
+type fieldError struct {
+	Field   string
+	Message string
+}
+
+func (e *fieldError) Error() string {
+	return e.Field + " " + e.Message
+}
+
+// fieldFailed responds 400 naming the field if err is a fieldError, and
+// reports whether it did.
+func fieldFailed(w http.ResponseWriter, err error) bool {
+	var ferr *fieldError
+	if !errors.As(err, &ferr) {
+		return false
+	}
+	http.Error(w, ferr.Error(), http.StatusBadRequest)
+	return true
+}
+
+// settingsForm copies the form fields that were sent into settings, keeping
+// the first field that could not be parsed as err.
+type settingsForm struct {
+	values url.Values
+	err    error
+}
+
+func (f *settingsForm) value(name string) (string, bool) {
+	v, ok := f.values[name]
+	if !ok || len(v) == 0 {
+		return "", false
+	}
+	return strings.TrimSpace(v[0]), true
+}
+
+func (f *settingsForm) fail(name, msg string) {
+	if f.err == nil {
+		f.err = &fieldError{Field: name, Message: msg}
+	}
+}
+
+// String sets dst to the field's value.
+func (f *settingsForm) String(name string, dst *string) {
+	if v, ok := f.value(name); ok {
+		*dst = v
+	}
+}
+
+// Int sets dst to the field's value; an empty value sets it to 0 (unset).
+func (f *settingsForm) Int(name string, dst *int) {
+	v, ok := f.value(name)
+	if !ok {
+		return
+	}
+	if v == "" {
+		*dst = 0
+		return
+	}
+	n, err := strconv.Atoi(v)
+	if err != nil {
+		f.fail(name, "must be a whole number")
+		return
+	}
+	*dst = n
+}
+
+// Int64 is Int for 64-bit settings.
+func (f *settingsForm) Int64(name string, dst *int64) {
+	v, ok := f.value(name)
+	if !ok {
+		return
+	}
+	if v == "" {
+		*dst = 0
+		return
+	}
+	n, err := strconv.ParseInt(v, 10, 64)
+	if err != nil {
+		f.fail(name, "must be a whole number")
+		return
+	}
+	*dst = n
+}
+
+// Regex sets dst to the field's value after checking that it compiles, so a
+// bad pattern is reported against the field rather than staged.
+func (f *settingsForm) Regex(name string, dst *string) {
+	v, ok := f.value(name)
+	if !ok {
+		return
+	}
+	if _, err := regexp.Compile(v); err != nil {
+		f.fail(name, "is not a valid regular expression: "+strings.TrimPrefix(err.Error(), "error parsing regexp: "))
+		return
+	}
+	*dst = v
+}
+
+// List sets dst to the field's comma-separated values; an empty value
+// clears it.
+func (f *settingsForm) List(name string, dst *[]string) {
+	v, ok := f.value(name)
+	if !ok {
+		return
+	}
+	var list []string
+	for _, item := range strings.Split(v, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			list = append(list, item)
+		}
+	}
+	*dst = list
+}
+
+// Bool sets dst from a true/false, on/off or 1/0 field; an empty value is false.
+func (f *settingsForm) Bool(name string, dst *bool) {
+	v, ok := f.value(name)
+	if !ok {
+		return
+	}
+	switch strings.ToLower(v) {
+	case "true", "on", "1":
+		*dst = true
+	case "", "false", "off", "0":
+		*dst = false
+	default:
+		f.fail(name, "must be true or false")
+	}
+}
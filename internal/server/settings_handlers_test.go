@@ -0,0 +1,249 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestSettingsForm(t *testing.T) {
+	type fields struct {
+		S    string
+		I    int
+		I64  int64
+		B    bool
+		L    []string
+		Re   string
+		Left string
+	}
+	set := func(f *settingsForm, dst *fields) {
+		f.String("s", &dst.S)
+		f.Int("i", &dst.I)
+		f.Int64("i64", &dst.I64)
+		f.Bool("b", &dst.B)
+		f.List("l", &dst.L)
+		f.Regex("re", &dst.Re)
+		f.String("left", &dst.Left)
+	}
+	start := fields{S: "old", I: 1, I64: 2, B: true, L: []string{"a"}, Re: "x", Left: "kept"}
+	tests := []struct {
+		name    string
+		values  url.Values
+		want    fields
+		wantErr string
+	}{
+		{"nothing sent", url.Values{}, start, ""},
+		{"values", url.Values{"s": {" new "}, "i": {"5"}, "i64": {"6"}, "b": {"off"}, "l": {"b, c,,"}, "re": {"^y"}},
+			fields{S: "new", I: 5, I64: 6, B: false, L: []string{"b", "c"}, Re: "^y", Left: "kept"}, ""},
+		{"empty values clear", url.Values{"s": {""}, "i": {""}, "i64": {""}, "b": {""}, "l": {""}, "re": {""}},
+			fields{Left: "kept"}, ""},
+		{"bool spellings", url.Values{"b": {"ON"}}, fields{S: "old", I: 1, I64: 2, B: true, L: []string{"a"}, Re: "x", Left: "kept"}, ""},
+		{"bad int", url.Values{"i": {"five"}}, start, "i must be a whole number"},
+		{"bad int64", url.Values{"i64": {"1.5"}}, start, "i64 must be a whole number"},
+		{"bad bool", url.Values{"b": {"maybe"}}, start, "b must be true or false"},
+		{"bad pattern", url.Values{"re": {"("}}, start, "re is not a valid regular expression: missing closing ): `(`"},
+		{"first error kept", url.Values{"i": {"x"}, "b": {"maybe"}}, start, "i must be a whole number"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := start
+			got.L = append([]string(nil), start.L...)
+			form := &settingsForm{values: tt.values}
+			set(form, &got)
+			if tt.wantErr != "" {
+				if form.err == nil || form.err.Error() != tt.wantErr {
+					t.Fatalf("error = %v, want %s", form.err, tt.wantErr)
+				}
+				return
+			}
+			if form.err != nil {
+				t.Fatalf("error = %v", form.err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("fields = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+// settingsCase is a POST to a settings section and what it must stage.
+type settingsCase struct {
+	name   string
+	form   url.Values
+	status int
+	// contains and absent are checked against the staged config.
+	contains []string
+	absent   []string
+}
+
+// runSettingsCases posts each case to handler against config, starting
+// afresh each time.
+func runSettingsCases(t *testing.T, config string, handler func(h *Handler) http.HandlerFunc, target string, tests []settingsCase) {
+	t.Helper()
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := newTestHandler(t, config)
+			post(t, h, handler(h), target, tt.form, tt.status)
+			staged := readTestFile(t, h.FeedService.workingPath(h.PodsyncConfigPath))
+			if tt.status != http.StatusOK && staged != config {
+				t.Errorf("refused change was staged:\n%s", staged)
+			}
+			for _, s := range tt.contains {
+				if !strings.Contains(staged, s) {
+					t.Errorf("staged config does not contain %q:\n%s", s, staged)
+				}
+			}
+			for _, s := range tt.absent {
+				if strings.Contains(staged, s) {
+					t.Errorf("staged config contains %q:\n%s", s, staged)
+				}
+			}
+		})
+	}
+}
+
+const serverConfig = `[server]
+port = 8080 # public port
+hostname = "https://pod.example.com"
+path = "/feeds"
+
+[storage.local]
+data_dir = "/app/data"
+
+[feeds.news]
+url = "https://www.youtube.com/channel/UCnews"
+`
+
+func TestServerSettings(t *testing.T) {
+	server := func(h *Handler) http.HandlerFunc { return h.ServerSettingsHandler }
+	runSettingsCases(t, serverConfig, server, "/settings/server", []settingsCase{
+		{name: "change kept in place", form: url.Values{"port": {"9090"}}, status: http.StatusOK,
+			contains: []string{"port = 9090 # public port", `path = "/feeds"`}},
+		{name: "empty value removes the setting", form: url.Values{"path": {""}}, status: http.StatusOK,
+			contains: []string{"port = 8080"}, absent: []string{"path ="}},
+		{name: "new settings", form: url.Values{"bind_address": {"0.0.0.0"}, "web_ui": {"on"}}, status: http.StatusOK,
+			contains: []string{`bind_address = "0.0.0.0"`, "web_ui = true"}},
+		{name: "tls without files", form: url.Values{"tls": {"true"}}, status: http.StatusUnprocessableEntity},
+		{name: "tls with files", form: url.Values{"tls": {"true"}, "certificate_path": {"/certs/pod.pem"}, "key_file_path": {"/certs/pod.key"}},
+			status: http.StatusOK, contains: []string{"tls = true", `certificate_path = "/certs/pod.pem"`}},
+		{name: "port not a number", form: url.Values{"port": {"http"}}, status: http.StatusBadRequest},
+		{name: "port out of range", form: url.Values{"port": {"70000"}}, status: http.StatusUnprocessableEntity},
+		{name: "hostname without scheme", form: url.Values{"hostname": {"pod.example.com"}}, status: http.StatusUnprocessableEntity},
+	})
+}
+
+func TestSettingsGet(t *testing.T) {
+	h := newTestHandler(t, serverConfig)
+	rec := httptest.NewRecorder()
+	h.ServerSettingsHandler(rec, httptest.NewRequest(http.MethodGet, "/settings/server", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d: %s", rec.Code, rec.Body)
+	}
+	if got, want := rec.Header().Get("ETag"), `"`+workingVersion(t, h)+`"`; got != want {
+		t.Errorf("ETag = %s, want %s", got, want)
+	}
+	var settings map[string]interface{}
+	if err := json.NewDecoder(rec.Body).Decode(&settings); err != nil {
+		t.Fatal(err)
+	}
+	if settings["port"] != float64(8080) || settings["hostname"] != "https://pod.example.com" || settings["tls"] != false {
+		t.Errorf("settings = %v", settings)
+	}
+}
+
+func TestStorageSettings(t *testing.T) {
+	storage := func(h *Handler) http.HandlerFunc { return h.StorageSettingsHandler }
+	s3 := url.Values{
+		"type":            {"s3"},
+		"local.data_dir":  {""},
+		"s3.endpoint_url": {"https://s3.example.com"},
+		"s3.region":       {"eu-west-1"},
+		"s3.bucket":       {"pods"},
+	}
+	without := func(field string) url.Values {
+		form := url.Values{}
+		for k, v := range s3 {
+			form[k] = v
+		}
+		form[field] = []string{""}
+		return form
+	}
+	runSettingsCases(t, serverConfig, storage, "/settings/storage", []settingsCase{
+		{name: "local data_dir", form: url.Values{"local.data_dir": {"/data"}}, status: http.StatusOK,
+			contains: []string{`data_dir = "/data"`}},
+		{name: "local data_dir removed", form: url.Values{"local.data_dir": {""}}, status: http.StatusUnprocessableEntity},
+		{name: "switch to s3", form: s3, status: http.StatusOK,
+			contains: []string{`type = "s3"`, `endpoint_url = "https://s3.example.com"`, `region = "eu-west-1"`, `bucket = "pods"`},
+			absent:   []string{"data_dir", "prefix"}},
+		{name: "s3 without endpoint_url", form: without("s3.endpoint_url"), status: http.StatusUnprocessableEntity},
+		{name: "s3 without region", form: without("s3.region"), status: http.StatusUnprocessableEntity},
+		{name: "s3 without bucket", form: without("s3.bucket"), status: http.StatusUnprocessableEntity},
+		{name: "unknown type", form: url.Values{"type": {"gcs"}}, status: http.StatusUnprocessableEntity},
+	})
+
+	t.Run("s3 prefix cleared", func(t *testing.T) {
+		h := newTestHandler(t, serverConfig)
+		form := url.Values{"s3.prefix": {"podcasts"}}
+		for k, v := range s3 {
+			form[k] = v
+		}
+		post(t, h, h.StorageSettingsHandler, "/settings/storage", form, http.StatusOK)
+		if staged := readTestFile(t, h.FeedService.workingPath(h.PodsyncConfigPath)); !strings.Contains(staged, `prefix = "podcasts"`) {
+			t.Fatalf("prefix not staged:\n%s", staged)
+		}
+		post(t, h, h.StorageSettingsHandler, "/settings/storage", url.Values{"s3.prefix": {""}}, http.StatusOK)
+		if staged := readTestFile(t, h.FeedService.workingPath(h.PodsyncConfigPath)); strings.Contains(staged, "prefix") {
+			t.Errorf("prefix left after clearing it:\n%s", staged)
+		}
+	})
+}
+
+func TestStorageTestNeedsS3(t *testing.T) {
+	h := newTestHandler(t, serverConfig)
+	rec := serve(h.StorageTestHandler, formRequest("/settings/storage/test", url.Values{}, ""))
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("testing local storage = %d, want 400: %s", rec.Code, rec.Body)
+	}
+}
+
+func TestDownloaderAndLogSettings(t *testing.T) {
+	config := serverConfig + `
+[downloader]
+self_update = true
+timeout = 15
+
+[log]
+filename = "/var/log/podsync.log"
+max_size = 50
+compress = true
+`
+	downloader := func(h *Handler) http.HandlerFunc { return h.DownloaderSettingsHandler }
+	runSettingsCases(t, config, downloader, "/settings/downloader", []settingsCase{
+		{name: "timeout", form: url.Values{"timeout": {"30"}}, status: http.StatusOK,
+			contains: []string{"timeout = 30", "self_update = true"}},
+		{name: "self_update off removes it", form: url.Values{"self_update": {"false"}}, status: http.StatusOK,
+			absent: []string{"self_update"}},
+		{name: "custom_binary", form: url.Values{"custom_binary": {"/usr/local/bin/yt-dlp"}}, status: http.StatusOK,
+			contains: []string{`custom_binary = "/usr/local/bin/yt-dlp"`}},
+		{name: "timeout cleared", form: url.Values{"timeout": {""}}, status: http.StatusOK,
+			absent: []string{"timeout"}},
+		{name: "negative timeout", form: url.Values{"timeout": {"-1"}}, status: http.StatusUnprocessableEntity},
+		{name: "timeout not a number", form: url.Values{"timeout": {"15s"}}, status: http.StatusBadRequest},
+	})
+
+	logSettings := func(h *Handler) http.HandlerFunc { return h.LogSettingsHandler }
+	runSettingsCases(t, config, logSettings, "/settings/log", []settingsCase{
+		{name: "limits", form: url.Values{"max_size": {"100"}, "max_backups": {"3"}, "max_age": {"7"}}, status: http.StatusOK,
+			contains: []string{"max_size = 100", "max_backups = 3", "max_age = 7", `filename = "/var/log/podsync.log"`}},
+		{name: "filename cleared", form: url.Values{"filename": {""}}, status: http.StatusOK,
+			absent: []string{"filename"}, contains: []string{"max_size = 50"}},
+		{name: "debug", form: url.Values{"debug": {"on"}, "compress": {"off"}}, status: http.StatusOK,
+			contains: []string{"debug = true"}, absent: []string{"compress"}},
+		{name: "negative max_backups", form: url.Values{"max_backups": {"-1"}}, status: http.StatusUnprocessableEntity},
+		{name: "compress not a bool", form: url.Values{"compress": {"gzip"}}, status: http.StatusBadRequest},
+	})
+}
@@ -0,0 +1,25 @@
+package server
+
+import "github.com/Takenobou/podconfig/internal/podsync"
+
+// WorkingConfig returns the typed configuration being edited (the staged
+// changes if there are any) and its version. It is shared with other readers
+// and must not be modified.
+func (fs *FeedService) WorkingConfig(configPath string) (*podsync.Config, string, error) {
+	fs.mu.RLock()
+	defer fs.mu.RUnlock()
+
+	return fs.cachedConfig(fs.workingPath(configPath))
+}
+
+// UpdateSettings passes the typed configuration to mutate and stages the
+// settings it changed. It returns the configuration before and after.
+func (fs *FeedService) UpdateSettings(configPath string, version string, mutate func(cfg *podsync.Config) error) (before, after *podsync.Config, err error) {
+	unlock, err := fs.lock(configPath)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer unlock()
+
+	return fs.updateModel(configPath, version, mutate)
+}
@@ -0,0 +1,80 @@
+package server
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/Takenobou/podconfig/internal/atomicfile"
+	"github.com/Takenobou/podconfig/internal/podsync"
+)
+
+// ErrNoSnapshot is returned when podsync has not been reloaded by podconfig yet.
+var ErrNoSnapshot = errors.New("no applied config recorded")
+
+// SnapshotService keeps a copy of the config podsync was last reloaded with.
+type SnapshotService struct {
+	Path string
+}
+
+// Save records content as the config podsync is now running with.
+func (ss *SnapshotService) Save(content []byte) error {
+	if err := os.MkdirAll(filepath.Dir(ss.Path), 0755); err != nil {
+		return err
+	}
+	return atomicfile.WriteFile(ss.Path, content, 0644)
+}
+
+// Load returns the last applied config and when it was applied.
+func (ss *SnapshotService) Load() ([]byte, time.Time, error) {
+	info, err := os.Stat(ss.Path)
+	if os.IsNotExist(err) {
+		return nil, time.Time{}, ErrNoSnapshot
+	}
+	if err != nil {
+		return nil, time.Time{}, err
+	}
+	content, err := os.ReadFile(ss.Path)
+	if err != nil {
+		return nil, time.Time{}, err
+	}
+	return content, info.ModTime(), nil
+}
+
+// Drift compares the config podsync is running with to the current file.
+type Drift struct {
+	// AppliedAt is when the snapshot was taken; zero if there is none.
+	AppliedAt time.Time
+	Changes   []podsync.Change
+	// OtherChanges is set when the files differ but no setting podconfig
+	// knows changed, as with comments or unknown keys.
+	OtherChanges bool
+
+	ConfigModified   time.Time
+	ContainerStarted time.Time
+	// ContainerError explains why the container's start time is unknown.
+	ContainerError string
+}
+
+// ReloadNeeded reports whether the container started before the config was
+// last modified. It is false when the start time is unknown.
+func (d *Drift) ReloadNeeded() bool {
+	return !d.ContainerStarted.IsZero() && d.ContainerStarted.Before(d.ConfigModified)
+}
+
+// configDrift lists the settings that differ between the applied and current
+// config content.
+func configDrift(applied, current []byte) ([]podsync.Change, bool, error) {
+	before, err := loadModel(applied)
+	if err != nil {
+		return nil, false, err
+	}
+	after, err := loadModel(current)
+	if err != nil {
+		return nil, false, err
+	}
+	changes := podsync.DiffConfig(before, after)
+	other := len(changes) == 0 && string(applied) != string(current)
+	return changes, other, nil
+}
@@ -0,0 +1,103 @@
+package server
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/url"
+	"path"
+	"strings"
+
+	"github.com/Takenobou/podconfig/internal/podsync"
+	"github.com/minio/minio-go/v7"
+	"github.com/minio/minio-go/v7/pkg/credentials"
+)
+
+// StorageCheck is the outcome of one step of a storage connection test.
+type StorageCheck struct {
+	Step  string `json:"step"`
+	OK    bool   `json:"ok"`
+	Error string `json:"error,omitempty"`
+}
+
+// CheckS3 tests the S3 storage settings by writing a small object under the
+// prefix, listing it and deleting it again. Credentials are the given access
+// key and secret if set, otherwise those in the AWS_ACCESS_KEY_ID and
+// AWS_SECRET_ACCESS_KEY (or MINIO_*) environment variables or
+// ~/.aws/credentials, as podsync itself would use. It returns every step
+// attempted, and an error if any failed.
+func CheckS3(ctx context.Context, s podsync.S3Storage, accessKey, secretKey string) ([]StorageCheck, error) {
+	var checks []StorageCheck
+	step := func(name string, err error) error {
+		check := StorageCheck{Step: name, OK: err == nil}
+		if err != nil {
+			check.Error = err.Error()
+		}
+		checks = append(checks, check)
+		return err
+	}
+
+	client, err := s3Client(s, accessKey, secretKey)
+	if step("connect", err) != nil {
+		return checks, err
+	}
+
+	suffix := make([]byte, 8)
+	rand.Read(suffix)
+	key := path.Join(s.Prefix, "podconfig-check-"+hex.EncodeToString(suffix)+".txt")
+	body := "podconfig storage check\n"
+	_, err = client.PutObject(ctx, s.Bucket, key, strings.NewReader(body), int64(len(body)), minio.PutObjectOptions{ContentType: "text/plain"})
+	if step("put "+key, err) != nil {
+		return checks, err
+	}
+
+	err = nil
+	found := false
+	for obj := range client.ListObjects(ctx, s.Bucket, minio.ListObjectsOptions{Prefix: key}) {
+		if obj.Err != nil {
+			err = obj.Err
+			break
+		}
+		found = found || obj.Key == key
+	}
+	if err == nil && !found {
+		err = errors.New("the object just written is not listed")
+	}
+	listErr := step("list "+key, err)
+
+	// Remove the object even if listing failed.
+	if err := step("delete "+key, client.RemoveObject(ctx, s.Bucket, key, minio.RemoveObjectOptions{})); err != nil {
+		return checks, err
+	}
+	return checks, listErr
+}
+
+// s3Client connects to the endpoint in s, or to AWS when it is not set.
+func s3Client(s podsync.S3Storage, accessKey, secretKey string) (*minio.Client, error) {
+	if s.Bucket == "" {
+		return nil, errors.New("storage.s3.bucket is required")
+	}
+	host, secure := "s3.amazonaws.com", true
+	if s.EndpointURL != "" {
+		u, err := url.Parse(s.EndpointURL)
+		if err != nil || u.Host == "" {
+			return nil, fmt.Errorf("invalid endpoint_url %q", s.EndpointURL)
+		}
+		host, secure = u.Host, u.Scheme != "http"
+	}
+	creds := credentials.NewChainCredentials([]credentials.Provider{
+		&credentials.EnvAWS{},
+		&credentials.EnvMinio{},
+		&credentials.FileAWSCredentials{},
+	})
+	if accessKey != "" || secretKey != "" {
+		creds = credentials.NewStaticV4(accessKey, secretKey, "")
+	}
+	return minio.New(host, &minio.Options{
+		Creds:  creds,
+		Secure: secure,
+		Region: s.Region,
+	})
+}
@@ -0,0 +1,340 @@
+package server
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/Takenobou/podconfig/internal/diff"
+	"github.com/Takenobou/podconfig/internal/podsync"
+	"github.com/Takenobou/podconfig/internal/tomledit"
+)
+
+var (
+	// ErrTokenNotFound is returned when no key of a provider has the given ID.
+	ErrTokenNotFound = errors.New("token not found")
+	// ErrTokenExists is returned when adding a key that is already in the rotation.
+	ErrTokenExists = errors.New("token already present")
+)
+
+// maskedToken stands in for an API key in responses, which never contain the
+// whole secret. ID identifies the key for removal.
+type maskedToken struct {
+	ID     string `json:"id"`
+	Masked string `json:"masked"`
+}
+
+// tokenProvider lists the keys of one provider, in rotation order.
+type tokenProvider struct {
+	Name string
+	Keys []maskedToken
+}
+
+// tokenID identifies a key by a short hash, so it can be named without
+// revealing it.
+func tokenID(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:6])
+}
+
+// maskToken shows only the last four characters of a key, and none of a
+// short one, followed by the key's ID so that replacing a key with another
+// ending in the same characters still shows as a change.
+func maskToken(key string) string {
+	if len(key) < 16 {
+		return fmt.Sprintf("•••• (%s)", tokenID(key))
+	}
+	return fmt.Sprintf("••••%s (%s)", key[len(key)-4:], tokenID(key))
+}
+
+// configDiff returns a unified diff between two versions of the config, with
+// API keys masked so diffs shown to clients do not reveal them.
+func configDiff(fromName, toName string, a, b []byte) string {
+	return diff.Unified(fromName, toName, maskSecrets(a), maskSecrets(b), 3)
+}
+
+// maskedTokenForm matches the text maskToken puts in place of a key.
+var maskedTokenForm = regexp.MustCompile(`^••••.{0,4} \([0-9a-f]{12}\)$`)
+
+// maskSecrets replaces every API key under [tokens] with its masked form.
+// Only the quoted keys are replaced, so the layout of the text is kept.
+// Content that cannot be parsed is returned as it is.
+func maskSecrets(content []byte) []byte {
+	masked := content
+	for _, keys := range tokenKeys(content) {
+		for _, key := range keys {
+			masked = replaceQuoted(masked, key, maskToken(key))
+		}
+	}
+	for _, keys := range tokenKeys(masked) {
+		for _, key := range keys {
+			if !maskedTokenForm.MatchString(key) {
+				// Written with escapes, so the quoted key was not found.
+				return rewriteMasked(content)
+			}
+		}
+	}
+	return masked
+}
+
+// rewriteMasked masks API keys by rewriting the values under [tokens].
+func rewriteMasked(content []byte) []byte {
+	doc, err := tomledit.Parse(content)
+	if err != nil {
+		return content
+	}
+	tokens := tokenKeys(content)
+	names := make([]string, 0, len(tokens))
+	for name := range tokens {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		var masked interface{}
+		if v, _ := doc.Get([]string{"tokens", name}); v != nil {
+			if s, ok := v.(string); ok {
+				masked = maskToken(s)
+			} else {
+				keys := make([]string, len(tokens[name]))
+				for i, k := range tokens[name] {
+					keys[i] = maskToken(k)
+				}
+				masked = keys
+			}
+		}
+		if err := doc.Set([]string{"tokens", name}, masked); err != nil {
+			return content
+		}
+	}
+	return doc.Bytes()
+}
+
+// unmaskSecrets puts the keys in current back in place of their masked form
+// in content, as shown by maskSecrets, so text edited after a masked read
+// keeps them. A masked value matching no key in current is reported as a
+// validation problem. Content that cannot be parsed is returned as it is.
+func unmaskSecrets(current, content []byte) ([]byte, error) {
+	known := map[string]string{}
+	for _, keys := range tokenKeys(current) {
+		for _, key := range keys {
+			known[maskToken(key)] = key
+		}
+	}
+	unmasked := content
+	for _, keys := range tokenKeys(content) {
+		for _, key := range keys {
+			if real, ok := known[key]; ok && maskedTokenForm.MatchString(key) {
+				unmasked = replaceQuoted(unmasked, key, real)
+			}
+		}
+	}
+
+	tokens := tokenKeys(unmasked)
+	names := make([]string, 0, len(tokens))
+	for name := range tokens {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var problems []podsync.Problem
+	for _, name := range names {
+		for i, key := range tokens[name] {
+			if maskedTokenForm.MatchString(key) {
+				problems = append(problems, podsync.Problem{
+					Path:    podsync.KeyPath("tokens", name),
+					Message: fmt.Sprintf("key %d is masked but matches no current key; enter the key in full", i+1),
+				})
+			}
+		}
+	}
+	if len(problems) > 0 {
+		return nil, &podsync.ValidationError{Problems: problems}
+	}
+	return unmasked, nil
+}
+
+// tokenKeys returns the API keys under [tokens] in content by provider, or
+// nil if content cannot be parsed. Values that are not strings are left out.
+func tokenKeys(content []byte) map[string][]string {
+	doc, err := tomledit.Parse(content)
+	if err != nil {
+		return nil
+	}
+	tokens, _ := doc.Get([]string{"tokens"})
+	providers, ok := tokens.(map[string]interface{})
+	if !ok {
+		return nil
+	}
+	keys := map[string][]string{}
+	for name, v := range providers {
+		switch v := v.(type) {
+		case string:
+			keys[name] = []string{v}
+		case []interface{}:
+			for _, k := range v {
+				if s, ok := k.(string); ok {
+					keys[name] = append(keys[name], s)
+				}
+			}
+		}
+	}
+	return keys
+}
+
+// replaceQuoted replaces every basic or literal string holding exactly from
+// with one holding to. Strings that would need escaping are left alone.
+func replaceQuoted(content []byte, from, to string) []byte {
+	if from == "" || strings.ContainsAny(from+to, "\"'\\\n") {
+		return content
+	}
+	for _, q := range []string{`"`, `'`} {
+		content = bytes.ReplaceAll(content, []byte(q+from+q), []byte(q+to+q))
+	}
+	return content
+}
+
+// maskTokens lists the keys of every provider podsync knows, followed by any
+// others in the config.
+func maskTokens(tokens podsync.Tokens) []tokenProvider {
+	names := append([]string{}, podsync.TokenProviders...)
+	var others []string
+	for name := range tokens {
+		if !contains(podsync.TokenProviders, name) {
+			others = append(others, name)
+		}
+	}
+	sort.Strings(others)
+	names = append(names, others...)
+
+	providers := make([]tokenProvider, len(names))
+	for i, name := range names {
+		providers[i] = tokenProvider{Name: name, Keys: []maskedToken{}}
+		for _, key := range tokens[name] {
+			providers[i].Keys = append(providers[i].Keys, maskedToken{ID: tokenID(key), Masked: maskToken(key)})
+		}
+	}
+	return providers
+}
+
+func contains(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+// TokensHandler returns the masked API keys of every provider as JSON, with
+// the config version as the ETag.
+func (h *Handler) TokensHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	cfg, version, err := h.FeedService.WorkingConfig(h.PodsyncConfigPath)
+	if err != nil {
+		log.Printf("Error reading config: %v", err)
+		http.Error(w, "Failed to read config", http.StatusInternalServerError)
+		return
+	}
+	tokens := map[string][]maskedToken{}
+	for _, p := range maskTokens(cfg.Tokens) {
+		tokens[p.Name] = p.Keys
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("ETag", `"`+version+`"`)
+	json.NewEncoder(w).Encode(tokens)
+}
+
+// AddTokenHandler stages a new API key at the end of a provider's rotation.
+func (h *Handler) AddTokenHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	provider := r.FormValue("provider")
+	key := strings.TrimSpace(r.FormValue("key"))
+	if !contains(podsync.TokenProviders, provider) {
+		http.Error(w, "provider must be one of "+strings.Join(podsync.TokenProviders, ", "), http.StatusBadRequest)
+		return
+	}
+	if err := podsync.CheckToken(provider, key); err != nil {
+		http.Error(w, "The key "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	h.updateTokens(w, r, provider, fmt.Sprintf("Added a %s key", provider), func(keys []string) ([]string, error) {
+		if contains(keys, key) {
+			return nil, ErrTokenExists
+		}
+		return append(keys, key), nil
+	})
+}
+
+// RemoveTokenHandler stages the removal of the provider's key with the given id.
+func (h *Handler) RemoveTokenHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	provider := r.FormValue("provider")
+	id := r.FormValue("id")
+	if provider == "" || id == "" {
+		http.Error(w, "provider and id are required", http.StatusBadRequest)
+		return
+	}
+	h.updateTokens(w, r, provider, fmt.Sprintf("Removed a %s key", provider), func(keys []string) ([]string, error) {
+		for i, k := range keys {
+			if tokenID(k) == id {
+				return append(keys[:i:i], keys[i+1:]...), nil
+			}
+		}
+		return nil, ErrTokenNotFound
+	})
+}
+
+// updateTokens stages the provider's keys as returned by edit and records msg.
+func (h *Handler) updateTokens(w http.ResponseWriter, r *http.Request, provider, msg string, edit func(keys []string) ([]string, error)) {
+	version, ok := requestVersion(w, r)
+	if !ok {
+		return
+	}
+	before, after, err := h.FeedService.UpdateSettings(h.PodsyncConfigPath, version, func(cfg *podsync.Config) error {
+		keys, err := edit(cfg.Tokens[provider])
+		if err != nil {
+			return err
+		}
+		cfg.Tokens[provider] = keys
+		return nil
+	})
+	switch {
+	case errors.Is(err, ErrTokenExists):
+		http.Error(w, "That key is already in the rotation", http.StatusConflict)
+		return
+	case errors.Is(err, ErrTokenNotFound):
+		http.Error(w, "Key not found", http.StatusNotFound)
+		return
+	}
+	if conflictFailed(w, err) || validationFailed(w, err) || lockFailed(w, err) {
+		return
+	}
+	if err != nil {
+		log.Printf("Error updating tokens: %v", err)
+		http.Error(w, "Failed to update config", http.StatusInternalServerError)
+		return
+	}
+
+	h.stageChange(newConfigEntry(r, OpSettings, before, after, msg))
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{
+		"message": "Staged: " + msg + ". Apply the staged changes to save it.",
+	})
+}
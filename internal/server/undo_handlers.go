@@ -0,0 +1,81 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+
+	"github.com/Takenobou/podconfig/internal/podsync"
+)
+
+// UndoHandler stages the inverse of a feed operation: the one named by the id
+// field, or the latest one.
+func (h *Handler) UndoHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	version, ok := requestVersion(w, r)
+	if !ok {
+		return
+	}
+	entry, err := h.Undo.Undoable(r.FormValue("id"))
+	if err != nil {
+		http.Error(w, "Nothing to undo", http.StatusNotFound)
+		return
+	}
+	if !h.replayFeed(w, r, version, entry.FeedKey, entry.After, entry.Before, entry.Raw, "Undid: "+entry.Message) {
+		return
+	}
+	h.Undo.Undone(entry.ID)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"message": fmt.Sprintf("Undid '%s'. Apply the staged changes to save it.", entry.Message)})
+}
+
+// RedoHandler stages the most recently undone feed operation again.
+func (h *Handler) RedoHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	version, ok := requestVersion(w, r)
+	if !ok {
+		return
+	}
+	entry, err := h.Undo.Redoable()
+	if err != nil {
+		http.Error(w, "Nothing to redo", http.StatusNotFound)
+		return
+	}
+	if !h.replayFeed(w, r, version, entry.FeedKey, entry.Before, entry.After, "", "Redid: "+entry.Message) {
+		return
+	}
+	h.Undo.Redone(entry.ID)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"message": fmt.Sprintf("Redid '%s'. Apply the staged changes to save it.", entry.Message), "undo": entry.ID})
+}
+
+// replayFeed stages feed as the settings of feedKey, provided they are still
+// expect, and records it as msg. raw is passed on to ReplaceFeed. On failure
+// it writes the error response and returns false.
+func (h *Handler) replayFeed(w http.ResponseWriter, r *http.Request, version, feedKey string, expect, feed *podsync.Feed, raw, msg string) bool {
+	change, err := h.FeedService.ReplaceFeed(h.PodsyncConfigPath, version, feedKey, expect, feed, raw)
+	if errors.Is(err, ErrFeedChanged) {
+		http.Error(w, fmt.Sprintf("Feed '%s' has been changed since; undo the later changes first.", feedKey), http.StatusConflict)
+		return false
+	}
+	if conflictFailed(w, err) || validationFailed(w, err) || lockFailed(w, err) {
+		return false
+	}
+	if err != nil {
+		log.Printf("Error replaying feed change: %v", err)
+		http.Error(w, "Failed to update config", http.StatusInternalServerError)
+		return false
+	}
+	h.noteStaged(newFeedEntry(r, feedOperation(change.Before, change.After), change, msg))
+	return true
+}
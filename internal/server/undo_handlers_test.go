@@ -0,0 +1,212 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/Takenobou/podconfig/internal/tomledit"
+)
+
+const twoFeedsConfig = `[storage.local]
+data_dir = "/app/data"
+
+[feeds]
+  # Main channel
+  [feeds.news]
+  url = "https://www.youtube.com/channel/UCnews"
+  page_size = 10 # keep it short
+  unknown_key = "kept"
+
+  [feeds.news.filters]
+  title = "daily"
+
+  [feeds.talks]
+  url = "https://www.youtube.com/channel/UCtalks"
+`
+
+// feedSection returns the table of feed key in content as written.
+func feedSection(t *testing.T, content, key string) string {
+	t.Helper()
+	doc, err := tomledit.Parse([]byte(content))
+	if err != nil {
+		t.Fatal(err)
+	}
+	section, ok := doc.Section([]string{"feeds", key})
+	if !ok {
+		t.Fatalf("no table for feed %s in\n%s", key, content)
+	}
+	return section
+}
+
+// post runs handler with form, sent against the current working version,
+// and fails the test unless it answers with status.
+func post(t *testing.T, h *Handler, handler http.HandlerFunc, target string, form url.Values, status int) map[string]string {
+	t.Helper()
+	rec := serve(handler, formRequest(target, form, workingVersion(t, h)))
+	if rec.Code != status {
+		t.Fatalf("POST %s %v = %d, want %d: %s", target, form, rec.Code, status, rec.Body)
+	}
+	var resp map[string]string
+	json.Unmarshal(rec.Body.Bytes(), &resp)
+	return resp
+}
+
+func TestUndoAppliedRemoval(t *testing.T) {
+	h := newTestHandler(t, twoFeedsConfig)
+	removed := post(t, h, h.RemoveFeedHandler, "/remove", url.Values{"feedKey": {"news"}}, http.StatusOK)
+
+	// There is no podsync container to reload, but the config is applied first.
+	post(t, h, h.ApplyDraftHandler, "/draft/apply", nil, http.StatusBadGateway)
+	if live := readTestFile(t, h.PodsyncConfigPath); strings.Contains(live, "[feeds.news]") {
+		t.Fatalf("removal was not applied:\n%s", live)
+	}
+	h.clearChanges()
+	applied := h.Undo.AppliedUndoable()
+	if len(applied) != 1 || applied[0].ID != removed["undo"] {
+		t.Fatalf("applied undoable operations = %+v, want the removal", applied)
+	}
+
+	post(t, h, h.UndoHandler, "/undo", url.Values{"id": {removed["undo"]}}, http.StatusOK)
+	if got, want := feedSection(t, readTestFile(t, h.FeedService.draftPath(h.PodsyncConfigPath)), "news"),
+		feedSection(t, twoFeedsConfig, "news"); got != want {
+		t.Errorf("restored feed =\n%s\nwant\n%s", got, want)
+	}
+	if len(h.Undo.AppliedUndoable()) != 0 {
+		t.Error("the undone removal can still be undone")
+	}
+
+	// Discarding the staged undo makes the applied removal undoable again.
+	post(t, h, h.DiscardDraftHandler, "/draft/discard", nil, http.StatusOK)
+	if applied := h.Undo.AppliedUndoable(); len(applied) != 1 || applied[0].ID != removed["undo"] {
+		t.Errorf("applied undoable operations after discard = %+v, want the removal", applied)
+	}
+	if _, redo := h.Undo.IDs(); redo != "" {
+		t.Errorf("redo after discard = %q, want none", redo)
+	}
+}
+
+func TestDiscardForgetsStagedOperations(t *testing.T) {
+	h := newTestHandler(t, twoFeedsConfig)
+	post(t, h, h.RemoveFeedHandler, "/remove", url.Values{"feedKey": {"talks"}}, http.StatusOK)
+	post(t, h, h.DiscardDraftHandler, "/draft/discard", nil, http.StatusOK)
+	if ids, _ := h.Undo.IDs(); len(ids) != 0 {
+		t.Errorf("undoable after discard: %v", ids)
+	}
+	rec := serve(h.UndoHandler, formRequest("/undo", nil, workingVersion(t, h)))
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("undo after discard = %d, want 404", rec.Code)
+	}
+}
+
+func TestUndoRedo(t *testing.T) {
+	tests := []struct {
+		name    string
+		handler func(h *Handler) http.HandlerFunc
+		target  string
+		form    url.Values
+		feed    string
+		// raw is set when undo must put back the feed's table as written,
+		// rather than only its settings.
+		raw bool
+	}{
+		{"modify", func(h *Handler) http.HandlerFunc { return h.ModifyFeedHandler }, "/modify",
+			url.Values{"feedKey": {"news"}, "page_size": {"20"}, "filters.title": {""}}, "news", false},
+		{"remove with comments and unknown keys", func(h *Handler) http.HandlerFunc { return h.RemoveFeedHandler }, "/remove",
+			url.Values{"feedKey": {"news"}}, "news", true},
+		{"remove the last table", func(h *Handler) http.HandlerFunc { return h.RemoveFeedHandler }, "/remove",
+			url.Values{"feedKey": {"talks"}}, "talks", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := newTestHandler(t, twoFeedsConfig)
+			// state describes the feed in the config edits apply to: its
+			// table as written, or its settings.
+			state := func() string {
+				t.Helper()
+				content := readTestFile(t, h.FeedService.workingPath(h.PodsyncConfigPath))
+				if !strings.Contains(content, "[feeds."+tt.feed+"]") {
+					return ""
+				}
+				if tt.raw {
+					return feedSection(t, content, tt.feed)
+				}
+				cfg, err := loadModel([]byte(content))
+				if err != nil {
+					t.Fatal(err)
+				}
+				return fmt.Sprintf("%+v", *cfg.Feeds[tt.feed])
+			}
+			before := state()
+			resp := post(t, h, tt.handler(h), tt.target, tt.form, http.StatusOK)
+			after := state()
+			if after == before {
+				t.Fatalf("%s changed nothing", tt.target)
+			}
+
+			post(t, h, h.UndoHandler, "/undo", url.Values{"id": {resp["undo"]}}, http.StatusOK)
+			if got := state(); got != before {
+				t.Errorf("after undo feed =\n%s\nwant\n%s", got, before)
+			}
+			if _, redo := h.Undo.IDs(); redo == "" {
+				t.Error("nothing to redo after undo")
+			}
+
+			post(t, h, h.RedoHandler, "/redo", nil, http.StatusOK)
+			if got := state(); got != after {
+				t.Errorf("after redo feed =\n%s\nwant\n%s", got, after)
+			}
+			post(t, h, h.RedoHandler, "/redo", nil, http.StatusNotFound)
+
+			// Redoing records the operation for undo again.
+			post(t, h, h.UndoHandler, "/undo", nil, http.StatusOK)
+			if got := state(); got != before {
+				t.Errorf("after a second undo feed =\n%s\nwant\n%s", got, before)
+			}
+		})
+	}
+}
+
+func TestUndoRules(t *testing.T) {
+	tests := []struct {
+		name string
+		// steps run after modifying news and then talks.
+		steps func(t *testing.T, h *Handler, news, talks string)
+	}{
+		{"nothing to undo", func(t *testing.T, h *Handler, news, talks string) {
+			post(t, h, h.UndoHandler, "/undo", url.Values{"id": {"missing"}}, http.StatusNotFound)
+		}},
+		{"undo an earlier operation on its own", func(t *testing.T, h *Handler, news, talks string) {
+			post(t, h, h.UndoHandler, "/undo", url.Values{"id": {news}}, http.StatusOK)
+			content := readTestFile(t, h.FeedService.workingPath(h.PodsyncConfigPath))
+			if !strings.Contains(content, "page_size = 10") || !strings.Contains(content, "page_size = 30") {
+				t.Errorf("undoing news touched talks:\n%s", content)
+			}
+		}},
+		{"feed changed since", func(t *testing.T, h *Handler, news, talks string) {
+			post(t, h, h.ModifyFeedHandler, "/modify", url.Values{"feedKey": {"news"}, "page_size": {"40"}}, http.StatusOK)
+			post(t, h, h.UndoHandler, "/undo", url.Values{"id": {news}}, http.StatusConflict)
+		}},
+		{"a new change ends redo", func(t *testing.T, h *Handler, news, talks string) {
+			post(t, h, h.UndoHandler, "/undo", url.Values{"id": {talks}}, http.StatusOK)
+			post(t, h, h.ModifyFeedHandler, "/modify", url.Values{"feedKey": {"news"}, "page_size": {"40"}}, http.StatusOK)
+			post(t, h, h.RedoHandler, "/redo", nil, http.StatusNotFound)
+		}},
+		{"no version", func(t *testing.T, h *Handler, news, talks string) {
+			if rec := serve(h.UndoHandler, formRequest("/undo", nil, "")); rec.Code != http.StatusPreconditionRequired {
+				t.Errorf("undo without a version = %d, want 428", rec.Code)
+			}
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := newTestHandler(t, twoFeedsConfig)
+			news := post(t, h, h.ModifyFeedHandler, "/modify", url.Values{"feedKey": {"news"}, "page_size": {"20"}}, http.StatusOK)
+			talks := post(t, h, h.ModifyFeedHandler, "/modify", url.Values{"feedKey": {"talks"}, "page_size": {"30"}}, http.StatusOK)
+			tt.steps(t, h, news["undo"], talks["undo"])
+		})
+	}
+}
@@ -0,0 +1,145 @@
+package server
+
+import (
+	"errors"
+	"sync"
+)
+
+// undoLimit caps how many feed operations are remembered for undo.
+const undoLimit = 50
+
+// ErrNothingToUndo is returned when there is no matching operation to undo or redo.
+var ErrNothingToUndo = errors.New("nothing to undo")
+
+// UndoStack remembers feed operations so each can be undone on its own, and
+// undone operations so they can be redone until a new change is made.
+// Applying the staged changes keeps them: undoing an applied operation stages
+// its inverse as a new change.
+type UndoStack struct {
+	mu     sync.Mutex
+	done   []ChangeEntry
+	undone []ChangeEntry
+	// appliedDone and appliedUndone are the lists as of the last apply, which
+	// discarding the staged changes returns to.
+	appliedDone   []ChangeEntry
+	appliedUndone []ChangeEntry
+}
+
+// Record remembers a new operation and forgets anything that could be redone.
+func (u *UndoStack) Record(entry ChangeEntry) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	u.done = append(u.done, entry)
+	if len(u.done) > undoLimit {
+		u.done = u.done[len(u.done)-undoLimit:]
+	}
+	u.undone = nil
+}
+
+// ClearRedo forgets the undone operations, once another change has been made.
+func (u *UndoStack) ClearRedo() {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	u.undone = nil
+}
+
+// Applied records that the staged operations are now in the live config, so
+// a later discard keeps them.
+func (u *UndoStack) Applied() {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	u.appliedDone = append([]ChangeEntry(nil), u.done...)
+	u.appliedUndone = append([]ChangeEntry(nil), u.undone...)
+}
+
+// Discard forgets what was staged since the last apply, once the staged
+// changes have been thrown away, returning to the lists as they were then.
+func (u *UndoStack) Discard() {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	u.done = append([]ChangeEntry(nil), u.appliedDone...)
+	u.undone = append([]ChangeEntry(nil), u.appliedUndone...)
+}
+
+// AppliedUndoable returns the operations that were applied and can still be
+// undone, oldest first.
+func (u *UndoStack) AppliedUndoable() []ChangeEntry {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	var entries []ChangeEntry
+	for _, e := range u.done {
+		if find(u.appliedDone, e.ID) >= 0 {
+			entries = append(entries, e)
+		}
+	}
+	return entries
+}
+
+// Undoable returns the operation with the given ID, or the latest one if id
+// is empty.
+func (u *UndoStack) Undoable(id string) (ChangeEntry, error) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	i := find(u.done, id)
+	if i < 0 {
+		return ChangeEntry{}, ErrNothingToUndo
+	}
+	return u.done[i], nil
+}
+
+// Redoable returns the most recently undone operation.
+func (u *UndoStack) Redoable() (ChangeEntry, error) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	if len(u.undone) == 0 {
+		return ChangeEntry{}, ErrNothingToUndo
+	}
+	return u.undone[len(u.undone)-1], nil
+}
+
+// Undone moves an operation from the undo list to the redo list.
+func (u *UndoStack) Undone(id string) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	if i := find(u.done, id); i >= 0 {
+		u.undone = append(u.undone, u.done[i])
+		u.done = append(u.done[:i], u.done[i+1:]...)
+	}
+}
+
+// Redone moves an operation from the redo list back to the undo list.
+func (u *UndoStack) Redone(id string) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	if i := find(u.undone, id); i >= 0 {
+		u.done = append(u.done, u.undone[i])
+		u.undone = append(u.undone[:i], u.undone[i+1:]...)
+	}
+}
+
+// IDs returns the IDs of the operations that can be undone, and the label of
+// the one that would be redone, if any.
+func (u *UndoStack) IDs() (map[string]bool, string) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	ids := make(map[string]bool, len(u.done))
+	for _, e := range u.done {
+		ids[e.ID] = true
+	}
+	redo := ""
+	if len(u.undone) > 0 {
+		redo = u.undone[len(u.undone)-1].Message
+	}
+	return ids, redo
+}
+
+// find returns the index of the entry with the given ID, or of the last entry
+// if id is empty; -1 if there is none.
+func find(entries []ChangeEntry, id string) int {
+	for i := len(entries) - 1; i >= 0; i-- {
+		if id == "" || entries[i].ID == id {
+			return i
+		}
+	}
+	return -1
+}
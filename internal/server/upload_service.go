@@ -0,0 +1,170 @@
+package server
+
+import (
+	"context"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/PuerkitoBio/goquery"
+)
+
+const (
+	// DefaultUploadFeedURL is YouTube's public RSS feed of a channel's or
+	// playlist's latest uploads.
+	DefaultUploadFeedURL = "https://www.youtube.com/feeds/videos.xml"
+	// DefaultChannelSiteURL is where channel pages are looked up.
+	DefaultChannelSiteURL = "https://www.youtube.com"
+)
+
+// ErrUnsupportedFeedURL is returned for feed URLs whose uploads cannot be
+// looked up.
+var ErrUnsupportedFeedURL = errors.New("unsupported feed URL")
+
+// Upload is a video from a channel's uploads feed. The feed does not give
+// durations.
+type Upload struct {
+	ID          string    `json:"id"`
+	Title       string    `json:"title"`
+	Description string    `json:"description"`
+	URL         string    `json:"url"`
+	Published   time.Time `json:"published"`
+}
+
+// UploadService fetches the recent uploads of the channel or playlist behind
+// a feed URL.
+type UploadService struct {
+	// FeedURL is the RSS endpoint queried with channel_id, user or
+	// playlist_id; DefaultUploadFeedURL if empty.
+	FeedURL string
+	// SiteURL is the site channel pages given by handle or custom name are
+	// fetched from, keeping the feed URL's path; DefaultChannelSiteURL if
+	// empty.
+	SiteURL string
+	// Client makes the requests; http.DefaultClient if nil.
+	Client *http.Client
+}
+
+// Recent returns the latest uploads for a podsync feed URL, newest first, and
+// the RSS URL they came from. Channel URLs given by handle or custom name are
+// resolved to a channel ID by fetching the channel page from s.SiteURL.
+func (s *UploadService) Recent(ctx context.Context, feedURL string) ([]Upload, string, error) {
+	query, err := s.feedQuery(ctx, feedURL)
+	if err != nil {
+		return nil, "", err
+	}
+	base := s.FeedURL
+	if base == "" {
+		base = DefaultUploadFeedURL
+	}
+	rssURL := base + "?" + query.Encode()
+
+	resp, err := s.get(ctx, rssURL)
+	if err != nil {
+		return nil, rssURL, err
+	}
+	defer resp.Body.Close()
+
+	var feed struct {
+		Entries []struct {
+			VideoID   string    `xml:"videoId"`
+			Title     string    `xml:"title"`
+			Published time.Time `xml:"published"`
+			Link      struct {
+				Href string `xml:"href,attr"`
+			} `xml:"link"`
+			Group struct {
+				Description string `xml:"description"`
+			} `xml:"group"`
+		} `xml:"entry"`
+	}
+	if err := xml.NewDecoder(resp.Body).Decode(&feed); err != nil {
+		return nil, rssURL, fmt.Errorf("reading uploads feed: %w", err)
+	}
+	uploads := make([]Upload, 0, len(feed.Entries))
+	for _, e := range feed.Entries {
+		uploads = append(uploads, Upload{
+			ID:          e.VideoID,
+			Title:       e.Title,
+			Description: e.Group.Description,
+			URL:         e.Link.Href,
+			Published:   e.Published,
+		})
+	}
+	return uploads, rssURL, nil
+}
+
+// feedQuery returns the RSS query selecting the uploads behind feedURL. Only
+// the path and query matter, so any host serving YouTube's URL layout works.
+func (s *UploadService) feedQuery(ctx context.Context, feedURL string) (url.Values, error) {
+	u, err := url.Parse(feedURL)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrUnsupportedFeedURL, err)
+	}
+	parts := strings.Split(strings.Trim(u.Path, "/"), "/")
+	switch {
+	case parts[0] == "playlist" && u.Query().Get("list") != "":
+		return url.Values{"playlist_id": {u.Query().Get("list")}}, nil
+	case parts[0] == "channel" && len(parts) > 1:
+		return url.Values{"channel_id": {parts[1]}}, nil
+	case parts[0] == "user" && len(parts) > 1:
+		return url.Values{"user": {parts[1]}}, nil
+	case parts[0] == "c" || strings.HasPrefix(parts[0], "@"):
+		site := s.SiteURL
+		if site == "" {
+			site = DefaultChannelSiteURL
+		}
+		id, err := s.channelID(ctx, strings.TrimSuffix(site, "/")+u.EscapedPath())
+		if err != nil {
+			return nil, err
+		}
+		return url.Values{"channel_id": {id}}, nil
+	}
+	return nil, fmt.Errorf("%w: %s", ErrUnsupportedFeedURL, feedURL)
+}
+
+// channelID reads the channel ID from a channel page, as FetchChannelInfo does.
+func (s *UploadService) channelID(ctx context.Context, pageURL string) (string, error) {
+	resp, err := s.get(ctx, pageURL)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	doc, err := goquery.NewDocumentFromReader(resp.Body)
+	if err != nil {
+		return "", err
+	}
+	if id, ok := doc.Find("meta[itemprop='channelId']").Attr("content"); ok && id != "" {
+		return id, nil
+	}
+	canonical, _ := doc.Find("link[rel='canonical']").Attr("href")
+	if _, id, ok := strings.Cut(canonical, "/channel/"); ok && id != "" {
+		return id, nil
+	}
+	return "", fmt.Errorf("channel id not found on %s", pageURL)
+}
+
+func (s *UploadService) get(ctx context.Context, target string) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, target, nil)
+	if err != nil {
+		return nil, err
+	}
+	client := s.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		resp.Body.Close()
+		return nil, fmt.Errorf("%s: HTTP status %d", target, resp.StatusCode)
+	}
+	return resp, nil
+}
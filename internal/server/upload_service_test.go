@@ -0,0 +1,126 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"html"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+)
+
+// stubUpload is an entry served by newYouTubeStub's uploads feed.
+type stubUpload struct {
+	id, title, description string
+	published              time.Time
+}
+
+// newYouTubeStub serves a channel page for @example and /c/Example, both
+// resolving to channel UCexample, and an uploads feed for that channel, the
+// user "example" and the playlist PLexample. The returned function lists the
+// paths requested so far.
+func newYouTubeStub(t *testing.T, uploads []stubUpload) (*httptest.Server, func() []string) {
+	t.Helper()
+	var (
+		mu        sync.Mutex
+		requested []string
+	)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		requested = append(requested, r.URL.Path)
+		mu.Unlock()
+		switch r.URL.Path {
+		case "/@example":
+			fmt.Fprint(w, `<html><head><meta itemprop="channelId" content="UCexample"></head></html>`)
+		case "/c/Example":
+			fmt.Fprint(w, `<html><head><link rel="canonical" href="https://www.youtube.com/channel/UCexample"></head></html>`)
+		case "/feeds/videos.xml":
+			q := r.URL.Query()
+			if q.Get("channel_id") != "UCexample" && q.Get("user") != "example" && q.Get("playlist_id") != "PLexample" {
+				http.NotFound(w, r)
+				return
+			}
+			fmt.Fprint(w, `<feed xmlns="http://www.w3.org/2005/Atom" xmlns:yt="http://www.youtube.com/xml/schemas/2015" xmlns:media="http://search.yahoo.com/mrss/">`)
+			for _, u := range uploads {
+				fmt.Fprintf(w, `<entry><yt:videoId>%[1]s</yt:videoId><title>%[2]s</title><link rel="alternate" href="https://www.youtube.com/watch?v=%[1]s"/><published>%[3]s</published><media:group><media:description>%[4]s</media:description></media:group></entry>`,
+					u.id, html.EscapeString(u.title), u.published.Format(time.RFC3339), html.EscapeString(u.description))
+			}
+			fmt.Fprint(w, `</feed>`)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	t.Cleanup(srv.Close)
+	return srv, func() []string {
+		mu.Lock()
+		defer mu.Unlock()
+		return append([]string(nil), requested...)
+	}
+}
+
+func TestUploadServiceRecent(t *testing.T) {
+	published := time.Date(2026, 10, 1, 12, 0, 0, 0, time.UTC)
+	uploads := []stubUpload{
+		{"v1", "First & best", "About the first", published},
+		{"v2", "Second", "", published.Add(-time.Hour)},
+	}
+
+	tests := []struct {
+		name      string
+		feedURL   string
+		wantQuery string
+		wantPage  string
+	}{
+		{"channel", "https://www.youtube.com/channel/UCexample", "channel_id=UCexample", ""},
+		{"user", "https://youtube.com/user/example", "user=example", ""},
+		{"playlist", "https://www.youtube.com/playlist?list=PLexample", "playlist_id=PLexample", ""},
+		{"handle", "https://www.youtube.com/@example", "channel_id=UCexample", "/@example"},
+		{"custom name", "https://www.youtube.com/c/Example", "channel_id=UCexample", "/c/Example"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv, requested := newYouTubeStub(t, uploads)
+			s := &UploadService{FeedURL: srv.URL + "/feeds/videos.xml", SiteURL: srv.URL}
+			got, source, err := s.Recent(context.Background(), tt.feedURL)
+			if err != nil {
+				t.Fatalf("Recent(%s): %v", tt.feedURL, err)
+			}
+			if want := srv.URL + "/feeds/videos.xml?" + tt.wantQuery; source != want {
+				t.Errorf("source = %s, want %s", source, want)
+			}
+			wantRequests := []string{"/feeds/videos.xml"}
+			if tt.wantPage != "" {
+				wantRequests = append([]string{tt.wantPage}, wantRequests...)
+			}
+			if r := requested(); !slices.Equal(r, wantRequests) {
+				t.Errorf("requested %v, want %v", r, wantRequests)
+			}
+			if len(got) != 2 {
+				t.Fatalf("got %d uploads, want 2", len(got))
+			}
+			first := got[0]
+			if first.ID != "v1" || first.Title != "First & best" || first.Description != "About the first" ||
+				first.URL != "https://www.youtube.com/watch?v=v1" || !first.Published.Equal(published) {
+				t.Errorf("first upload = %+v", first)
+			}
+		})
+	}
+}
+
+func TestUploadServiceRecentUnsupported(t *testing.T) {
+	s := &UploadService{FeedURL: "http://127.0.0.1:0/feeds/videos.xml", SiteURL: "http://127.0.0.1:0"}
+	for _, feedURL := range []string{
+		"https://www.youtube.com/watch?v=v1",
+		"https://www.youtube.com/playlist",
+		"https://www.youtube.com/",
+		"://bad",
+	} {
+		if _, _, err := s.Recent(context.Background(), feedURL); !errors.Is(err, ErrUnsupportedFeedURL) {
+			t.Errorf("Recent(%q) error = %v, want ErrUnsupportedFeedURL", feedURL, err)
+		}
+	}
+}
@@ -0,0 +1,58 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"strings"
+
+	"github.com/Takenobou/podconfig/internal/podsync"
+)
+
+// ValidateHandler checks the podsync config and returns the problems found as
+// JSON. problems would stop podsync starting; metadata lists values podsync
+// accepts but podconfig would not write, such as an unknown category.
+func (h *Handler) ValidateHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	startup, metadata, err := h.FeedService.ValidateConfig(h.PodsyncConfigPath)
+	problems := problemList(startup)
+	if err != nil {
+		// The file could not be parsed at all; report that as the only problem.
+		problems = append(problems, podsync.Problem{Path: "config.toml", Message: err.Error()})
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"valid":    len(problems) == 0,
+		"problems": problems,
+		"metadata": problemList(metadata),
+	})
+}
+
+// problemList returns the problems in a validation error, never nil.
+func problemList(err error) []podsync.Problem {
+	var verr *podsync.ValidationError
+	if errors.As(err, &verr) {
+		return verr.Problems
+	}
+	return []podsync.Problem{}
+}
+
+// validationFailed writes a 422 response listing the problems if err is a
+// validation error, and reports whether it did.
+func validationFailed(w http.ResponseWriter, err error) bool {
+	var verr *podsync.ValidationError
+	if !errors.As(err, &verr) {
+		return false
+	}
+	log.Printf("Rejected invalid config: %v", err)
+	lines := make([]string, len(verr.Problems))
+	for i, p := range verr.Problems {
+		lines[i] = p.String()
+	}
+	http.Error(w, "Invalid config:\n"+strings.Join(lines, "\n"), http.StatusUnprocessableEntity)
+	return true
+}
@@ -0,0 +1,68 @@
+package server
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+)
+
+// versionsKept is how many recently served config versions are remembered, so
+// a conflict can show what changed since the user loaded the page.
+const versionsKept = 16
+
+// ConflictError is returned when a write names a config version that is no
+// longer current, because the file changed after the user loaded it.
+type ConflictError struct {
+	Version string
+	Current string
+	// Diff is a unified diff from the user's version to the current file, or
+	// empty when that version is no longer remembered.
+	Diff string
+}
+
+func (e *ConflictError) Error() string {
+	return fmt.Sprintf("config changed since version %s (now %s)", e.Version, e.Current)
+}
+
+// configVersion returns the version identifier of the given config content.
+func configVersion(content []byte) string {
+	sum := sha256.Sum256(content)
+	return hex.EncodeToString(sum[:8])
+}
+
+// rememberVersion records content under its version and returns the version.
+func (fs *FeedService) rememberVersion(content []byte) string {
+	v := configVersion(content)
+	fs.cacheMu.Lock()
+	defer fs.cacheMu.Unlock()
+	if _, ok := fs.versions[v]; ok {
+		return v
+	}
+	if fs.versions == nil {
+		fs.versions = make(map[string][]byte)
+	}
+	fs.versions[v] = content
+	fs.versionOrder = append(fs.versionOrder, v)
+	if len(fs.versionOrder) > versionsKept {
+		delete(fs.versions, fs.versionOrder[0])
+		fs.versionOrder = fs.versionOrder[1:]
+	}
+	return v
+}
+
+// checkVersion returns a *ConflictError if version is set and does not match
+// content.
+func (fs *FeedService) checkVersion(version string, content []byte) error {
+	current := configVersion(content)
+	if version == "" || version == current {
+		return nil
+	}
+	conflict := &ConflictError{Version: version, Current: current}
+	fs.cacheMu.Lock()
+	old, ok := fs.versions[version]
+	fs.cacheMu.Unlock()
+	if ok {
+		conflict.Diff = configDiff("config.toml (yours)", "config.toml (current)", old, content)
+	}
+	return conflict
+}
@@ -0,0 +1,106 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+// watchSettle is how long the config must stay quiet before a change is
+// handled, so an editor's save or a git checkout is seen as one edit.
+const watchSettle = 200 * time.Millisecond
+
+// WatchConfig watches the podsync config until ctx is done. Edits made outside
+// podconfig are recorded in the pending changelog, and every change is pushed
+// to open pages as a "config" event.
+func (h *Handler) WatchConfig(ctx context.Context) error {
+	target := h.PodsyncConfigPath
+	if resolved, err := filepath.EvalSymlinks(target); err == nil {
+		target = resolved
+	}
+	target, err := filepath.Abs(target)
+	if err != nil {
+		return err
+	}
+
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return err
+	}
+	// Watch the directory rather than the file: editors and atomic writes
+	// replace the file, which would end a watch on the file itself.
+	if err := watcher.Add(filepath.Dir(target)); err != nil {
+		watcher.Close()
+		return err
+	}
+
+	last := ""
+	if content, err := os.ReadFile(target); err == nil {
+		last = configVersion(content)
+	}
+
+	go func() {
+		defer watcher.Close()
+		settle := time.NewTimer(watchSettle)
+		settle.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case ev, ok := <-watcher.Events:
+				if !ok {
+					return
+				}
+				if filepath.Clean(ev.Name) == target && !ev.Has(fsnotify.Chmod) {
+					settle.Reset(watchSettle)
+				}
+			case err, ok := <-watcher.Errors:
+				if !ok {
+					return
+				}
+				log.Printf("Error watching config: %v", err)
+			case <-settle.C:
+				last = h.configChanged(target, last)
+			}
+		}
+	}()
+	return nil
+}
+
+// configChanged handles a settled change to the config file and returns the
+// version now on disk.
+func (h *Handler) configChanged(path, last string) string {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		// The file is being replaced or was removed; the next event will
+		// bring us back.
+		return last
+	}
+	// An edit in place within the file system's timestamp resolution could
+	// leave size and modification time unchanged.
+	h.FeedService.invalidateCache()
+	version := configVersion(content)
+	if version == last {
+		return last
+	}
+	if !h.FeedService.wroteVersion(version) {
+		msg := "External edit to config.toml"
+		if _, err := loadModel(content); err != nil {
+			msg = fmt.Sprintf("%s (cannot be read: %v)", msg, err)
+		}
+		log.Print(msg)
+		h.addChange(ChangeEntry{
+			Time:      time.Now().UTC(),
+			Actor:     "external",
+			Operation: OpExternal,
+			Message:   msg,
+		})
+	}
+	h.Events.Publish("config", version)
+	return version
+}
@@ -0,0 +1,718 @@
+// Package tomledit edits TOML documents in place. Only the keys and tables
+// that change are rewritten; comments, key order, blank lines and the layout
+// of everything else are kept as they were.
+package tomledit
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/pelletier/go-toml/v2"
+)
+
+// Document is an editable TOML document.
+type Document struct {
+	src []byte
+	// eol is the line ending the document uses, "\n" or "\r\n", which
+	// inserted lines are written with.
+	eol string
+}
+
+// SyntaxError reports where in the source a document could not be parsed or
+// decoded. Line and Column start at 1.
+type SyntaxError struct {
+	Line, Column int
+	Msg          string
+}
+
+func (e *SyntaxError) Error() string {
+	return fmt.Sprintf("toml: line %d, column %d: %s", e.Line, e.Column, e.Msg)
+}
+
+// syntaxError converts go-toml's decode errors into a SyntaxError.
+func syntaxError(err error) error {
+	var derr *toml.DecodeError
+	if !errors.As(err, &derr) {
+		return err
+	}
+	line, column := derr.Position()
+	return &SyntaxError{Line: line, Column: column, Msg: strings.TrimPrefix(derr.Error(), "toml: ")}
+}
+
+// locate adds a position to errors go-toml reports without one, such as a
+// key defined twice, by finding the offending line in data.
+func locate(data []byte, err error) error {
+	var serr *SyntaxError
+	if errors.As(err, &serr) {
+		return err
+	}
+	entries, ierr := index(data)
+	if ierr != nil {
+		return ierr
+	}
+	if e, ok := duplicate(entries); ok {
+		line, column := position(data, e.start+len(leadingSpace(data[e.start:])))
+		return &SyntaxError{Line: line, Column: column, Msg: strings.TrimPrefix(err.Error(), "toml: ")}
+	}
+	return err
+}
+
+// Parse validates data as TOML and returns an editable document for it.
+func Parse(data []byte) (*Document, error) {
+	var v map[string]interface{}
+	if err := toml.Unmarshal(data, &v); err != nil {
+		return nil, locate(data, syntaxError(err))
+	}
+	if _, err := index(data); err != nil {
+		return nil, err
+	}
+	return &Document{src: append([]byte(nil), data...), eol: lineEnding(data)}, nil
+}
+
+// lineEnding returns "\r\n" if the first line of data ends with one, and
+// "\n" otherwise.
+func lineEnding(data []byte) string {
+	if i := bytes.IndexByte(data, '\n'); i > 0 && data[i-1] == '\r' {
+		return "\r\n"
+	}
+	return "\n"
+}
+
+// Bytes returns the current document text.
+func (d *Document) Bytes() []byte {
+	return append([]byte(nil), d.src...)
+}
+
+// Decode unmarshals the document into v.
+func (d *Document) Decode(v interface{}) error {
+	return syntaxError(toml.Unmarshal(d.src, v))
+}
+
+// Get returns the decoded value at path.
+func (d *Document) Get(path []string) (interface{}, bool) {
+	var cur interface{}
+	if err := d.Decode(&cur); err != nil {
+		return nil, false
+	}
+	for _, k := range path {
+		m, ok := cur.(map[string]interface{})
+		if !ok {
+			return nil, false
+		}
+		if cur, ok = m[k]; !ok {
+			return nil, false
+		}
+	}
+	return cur, true
+}
+
+// Has reports whether a key or table exists at path.
+func (d *Document) Has(path []string) bool {
+	_, ok := d.Get(path)
+	return ok
+}
+
+// Set writes value at path, replacing any existing value in place. Missing
+// tables are created next to their closest relatives. Table and map values
+// become [table] sections unless they replace an inline table.
+func (d *Document) Set(path []string, value interface{}) error {
+	if len(path) == 0 {
+		return errors.New("tomledit: empty path")
+	}
+	return d.edit(func(entries []entry) error {
+		for _, e := range entries {
+			if e.kind != entryKeyValue {
+				continue
+			}
+			if equalPath(e.path, path) {
+				return d.replaceValue(e.valStart, e.valEnd, value)
+			}
+			if hasPrefix(path, e.path) && d.src[e.valStart] == '{' {
+				return d.setInline(e.valStart, path[len(e.path):], value)
+			}
+		}
+		for i, e := range entries {
+			if e.kind == entryTable && equalPath(e.path, path) {
+				if !isTable(value) {
+					return fmt.Errorf("tomledit: cannot replace table %s with a value", encodeKey(path))
+				}
+				// Replace the table where it stands, keeping its leading comments.
+				at := d.removeTable(entries, path, entries[i].start)
+				return d.insertTable(entries[:0], path, value, at)
+			}
+		}
+		for _, e := range entries {
+			if hasPrefix(e.path, path) {
+				if !isTable(value) {
+					return fmt.Errorf("tomledit: cannot replace table %s with a value", encodeKey(path))
+				}
+				d.removeTable(entries, path, -1)
+				fresh, err := index(d.src)
+				if err != nil {
+					return err
+				}
+				return d.insert(fresh, path, value)
+			}
+		}
+		return d.insert(entries, path, value)
+	})
+}
+
+// Delete removes the key or table at path, including its sub-tables and any
+// comment lines directly above it. A [table] header left with nothing below
+// it by removing its last key is removed as well. It reports whether
+// anything was removed.
+func (d *Document) Delete(path []string) (bool, error) {
+	if len(path) == 0 {
+		return false, errors.New("tomledit: empty path")
+	}
+	removed := false
+	err := d.edit(func(entries []entry) error {
+		for _, e := range entries {
+			if e.kind == entryKeyValue && len(path) > len(e.path) && hasPrefix(path, e.path) && d.src[e.valStart] == '{' {
+				ok, err := d.deleteInline(e.valStart, path[len(e.path):])
+				removed = ok
+				return err
+			}
+		}
+		var header []string
+		for _, e := range entries {
+			if e.kind == entryKeyValue && equalPath(e.path, path) && e.table >= 0 && entries[e.table].kind == entryTable {
+				header = entries[e.table].path
+			}
+		}
+		removed = d.removeTable(entries, path, -1) >= 0
+		if header == nil {
+			return nil
+		}
+		fresh, err := index(d.src)
+		if err != nil {
+			return err
+		}
+		for _, e := range fresh {
+			if hasPrefix(e.path, header) && !equalPath(e.path, header) {
+				return nil
+			}
+		}
+		d.removeTable(fresh, header, -1)
+		return nil
+	})
+	return removed, err
+}
+
+// Section returns the source text of the table at path, including its
+// sub-tables and the comment lines directly above each of them, exactly as
+// written. It reports false if there is no such table or if part of it is
+// defined by key/values outside its own table headers, since such text
+// cannot be placed back on its own.
+func (d *Document) Section(path []string) (string, bool) {
+	entries, err := index(d.src)
+	if err != nil || len(path) == 0 {
+		return "", false
+	}
+	var sb strings.Builder
+	found := false
+	for i, e := range entries {
+		if !hasPrefix(e.path, path) {
+			continue
+		}
+		if e.kind == entryKeyValue {
+			if e.table < 0 || !hasPrefix(entries[e.table].path, path) {
+				return "", false
+			}
+			continue
+		}
+		found = true
+		block := string(d.src[d.leadingComments(entries, i):d.blockEnd(entries, i)])
+		sb.WriteString(strings.TrimRight(block, "\r\n") + d.eol + d.eol)
+	}
+	if !found {
+		return "", false
+	}
+	return strings.TrimSuffix(sb.String(), d.eol), true
+}
+
+// InsertSection adds text, which must hold the table at path and nothing
+// else, where Set would put a new table of that name. Nothing may exist at
+// path yet.
+func (d *Document) InsertSection(path []string, text string) error {
+	if len(path) == 0 {
+		return errors.New("tomledit: empty path")
+	}
+	section, err := Parse([]byte(text))
+	if err != nil {
+		return err
+	}
+	if other, ok := section.Section(path); !ok || strings.TrimSpace(other) != strings.TrimSpace(text) {
+		return fmt.Errorf("tomledit: text is not just the table %s", encodeKey(path))
+	}
+	return d.edit(func(entries []entry) error {
+		for _, e := range entries {
+			if hasPrefix(e.path, path) || (e.kind == entryKeyValue && hasPrefix(path, e.path)) {
+				return fmt.Errorf("tomledit: %s already exists", encodeKey(path))
+			}
+		}
+		return d.placeTable(entries, path, strings.TrimRight(text, "\r\n")+"\n", -1)
+	})
+}
+
+// edit runs fn against a fresh index of the document and rolls the text back
+// if the result is no longer valid TOML.
+func (d *Document) edit(fn func(entries []entry) error) error {
+	entries, err := index(d.src)
+	if err != nil {
+		return err
+	}
+	orig := d.src
+	d.src = append([]byte(nil), orig...)
+	if err := fn(entries); err != nil {
+		d.src = orig
+		return err
+	}
+	var v map[string]interface{}
+	if err := toml.Unmarshal(d.src, &v); err != nil {
+		d.src = orig
+		return fmt.Errorf("tomledit: edit produced invalid TOML: %w", err)
+	}
+	return nil
+}
+
+// removeTable deletes every key/value and table header at or below path.
+// If keepFrom is not negative, text before that offset (such as comments
+// above the first header) is kept. It returns the offset where the first
+// removed range started, or -1 when nothing matched.
+func (d *Document) removeTable(entries []entry, path []string, keepFrom int) int {
+	var ranges [][2]int
+	for i, e := range entries {
+		if !hasPrefix(e.path, path) {
+			continue
+		}
+		start := d.leadingComments(entries, i)
+		end := e.end
+		if e.kind != entryKeyValue {
+			end = d.blockEnd(entries, i)
+		}
+		ranges = append(ranges, [2]int{start, end})
+	}
+	if len(ranges) == 0 {
+		return -1
+	}
+	sort.Slice(ranges, func(i, j int) bool { return ranges[i][0] < ranges[j][0] })
+	merged := ranges[:1]
+	for _, r := range ranges[1:] {
+		last := &merged[len(merged)-1]
+		if r[0] <= last[1] {
+			if r[1] > last[1] {
+				last[1] = r[1]
+			}
+			continue
+		}
+		merged = append(merged, r)
+	}
+	if keepFrom >= 0 && merged[0][0] < keepFrom && keepFrom < merged[0][1] {
+		merged[0][0] = keepFrom
+	}
+	atEOF := merged[len(merged)-1][1] == len(d.src)
+	for i := len(merged) - 1; i >= 0; i-- {
+		start, end := merged[i][0], merged[i][1]
+		// A block's trailing blank line also separates the text around it.
+		if keepFrom < 0 && start > 0 && end < len(d.src) &&
+			endsBlank(d.src[start:end]) && !endsBlank(d.src[:start]) {
+			end -= len(trailingBreak(d.src[start:end]))
+		}
+		d.splice(start, end, "")
+	}
+	if atEOF && keepFrom < 0 {
+		for endsBlank(d.src) {
+			d.src = d.src[:len(d.src)-len(trailingBreak(d.src))]
+		}
+	}
+	return merged[0][0]
+}
+
+// insert adds a key or table that does not exist yet.
+func (d *Document) insert(entries []entry, path []string, value interface{}) error {
+	// The deepest explicit table that contains path.
+	parent, depth := -1, 0
+	for i, e := range entries {
+		if e.kind == entryTable && len(e.path) < len(path) && hasPrefix(path, e.path) && len(e.path) >= depth {
+			parent, depth = i, len(e.path)
+		}
+	}
+	rel := path[depth:]
+
+	// Keys defined with dotted keys inside the parent table stay dotted.
+	dotted := -1
+	for i, e := range entries {
+		if e.kind == entryKeyValue && e.table == parent && len(e.key) > 1 && len(rel) > 1 && e.key[0] == rel[0] {
+			dotted = i
+		}
+	}
+	if dotted >= 0 || (len(rel) == 1 && !isTable(value)) {
+		return d.insertKey(entries, parent, rel, value)
+	}
+	if isTable(value) {
+		return d.insertTable(entries, path, value, -1)
+	}
+	return d.insertTable(entries, path[:len(path)-1], Table{{Key: path[len(path)-1], Value: value}}, -1)
+}
+
+// insertKey adds key = value at the end of the key/values of a table.
+func (d *Document) insertKey(entries []entry, table int, key []string, value interface{}) error {
+	val, err := encodeValue(value)
+	if err != nil {
+		return err
+	}
+	pos, indent := -1, ""
+	for _, e := range entries {
+		if e.kind == entryKeyValue && e.table == table {
+			pos = e.end
+			indent = leadingSpace(d.src[e.start:e.end])
+		}
+	}
+	suffix := ""
+	if pos < 0 {
+		switch {
+		case table >= 0:
+			pos = entries[table].end
+		case firstHeader(entries) >= 0:
+			pos = d.leadingComments(entries, firstHeader(entries))
+			suffix = "\n"
+		default:
+			pos = len(d.src)
+		}
+	}
+	line := indent + encodeKey(key) + " = " + val + "\n" + suffix
+	if pos > 0 && d.src[pos-1] != '\n' {
+		line = "\n" + line
+	}
+	d.splice(pos, pos, line)
+	return nil
+}
+
+// insertTable writes value as a new [name] section. When at is negative the
+// section goes after the last table sharing the longest name prefix with
+// name, or at the end of the document.
+func (d *Document) insertTable(entries []entry, name []string, value interface{}, at int) error {
+	body, err := renderTable(name, value)
+	if err != nil {
+		return err
+	}
+	return d.placeTable(entries, name, body, at)
+}
+
+// placeTable writes body, the text of the [name] section, at offset at, or
+// where insertTable would put a new section of that name when at is negative.
+func (d *Document) placeTable(entries []entry, name []string, body string, at int) error {
+	if at >= 0 {
+		if at < len(d.src) {
+			body += "\n"
+		}
+		d.splice(at, at, body)
+		return nil
+	}
+	best, pos := 0, -1
+	for i, e := range entries {
+		if e.kind == entryKeyValue {
+			continue
+		}
+		if n := commonPrefix(e.path, name); n > 0 && n >= best {
+			best, pos = n, d.contentEnd(entries, i)
+		}
+	}
+	if pos < 0 {
+		pos = len(d.src)
+	}
+	if pos < len(d.src) && !lineBreakAt(d.src, pos) {
+		body += "\n"
+	}
+	prefix := "\n"
+	switch {
+	case pos == 0:
+		prefix = ""
+	case d.src[pos-1] != '\n':
+		prefix = "\n\n"
+	case pos == len(d.src) && endsBlank(d.src):
+		prefix = ""
+	}
+	d.splice(pos, pos, prefix+body)
+	return nil
+}
+
+// renderTable formats value as a [name] section followed by its sub-tables.
+func renderTable(name []string, value interface{}) (string, error) {
+	var sb strings.Builder
+	sb.WriteString("[" + encodeKey(name) + "]\n")
+	var subs Table
+	for _, kv := range tableEntries(value) {
+		if isTable(kv.Value) {
+			subs = append(subs, kv)
+			continue
+		}
+		val, err := encodeValue(kv.Value)
+		if err != nil {
+			return "", fmt.Errorf("%s: %w", encodeKey(append(name, kv.Key)), err)
+		}
+		sb.WriteString(encodeSimpleKey(kv.Key) + " = " + val + "\n")
+	}
+	for _, kv := range subs {
+		sub, err := renderTable(append(append([]string{}, name...), kv.Key), kv.Value)
+		if err != nil {
+			return "", err
+		}
+		sb.WriteString("\n" + sub)
+	}
+	return sb.String(), nil
+}
+
+func (d *Document) replaceValue(start, end int, value interface{}) error {
+	val, err := encodeValue(value)
+	if err != nil {
+		return err
+	}
+	d.splice(start, end, val)
+	return nil
+}
+
+// inlineEntry is a key/value inside an inline table.
+type inlineEntry struct {
+	key              []string
+	start            int
+	valStart, valEnd int
+}
+
+// inlineEntries scans the inline table starting at pos and returns its
+// key/values and the offset of its closing brace.
+func (d *Document) inlineEntries(pos int) ([]inlineEntry, int, error) {
+	s := &scanner{src: d.src, pos: pos + 1}
+	var out []inlineEntry
+	for {
+		s.skipBlank()
+		if s.eof() {
+			return nil, 0, s.errorf("unterminated inline table")
+		}
+		if s.peek() == '}' {
+			return out, s.pos, nil
+		}
+		start := s.pos
+		key, err := s.scanKey()
+		if err != nil {
+			return nil, 0, err
+		}
+		s.skipSpace()
+		if !s.consume("=") {
+			return nil, 0, s.errorf("expected '=' in inline table")
+		}
+		s.skipSpace()
+		valStart := s.pos
+		if err := s.scanValue(); err != nil {
+			return nil, 0, err
+		}
+		out = append(out, inlineEntry{key: key, start: start, valStart: valStart, valEnd: s.pos})
+		s.skipBlank()
+		if s.peek() == ',' {
+			s.pos++
+		}
+	}
+}
+
+func (d *Document) setInline(pos int, rel []string, value interface{}) error {
+	entries, closing, err := d.inlineEntries(pos)
+	if err != nil {
+		return err
+	}
+	for _, e := range entries {
+		if equalPath(e.key, rel) {
+			return d.replaceValue(e.valStart, e.valEnd, value)
+		}
+		if hasPrefix(rel, e.key) && d.src[e.valStart] == '{' {
+			return d.setInline(e.valStart, rel[len(e.key):], value)
+		}
+	}
+	val, err := encodeValue(value)
+	if err != nil {
+		return err
+	}
+	kv := encodeKey(rel) + " = " + val
+	if len(entries) == 0 {
+		d.splice(pos, closing+1, "{ "+kv+" }")
+		return nil
+	}
+	last := entries[len(entries)-1]
+	d.splice(last.valEnd, last.valEnd, ", "+kv)
+	return nil
+}
+
+func (d *Document) deleteInline(pos int, rel []string) (bool, error) {
+	entries, closing, err := d.inlineEntries(pos)
+	if err != nil {
+		return false, err
+	}
+	for i, e := range entries {
+		switch {
+		case hasPrefix(e.key, rel):
+			switch {
+			case len(entries) == 1:
+				d.splice(pos, closing+1, "{}")
+			case i == 0:
+				d.splice(e.start, entries[1].start, "")
+			default:
+				d.splice(entries[i-1].valEnd, e.valEnd, "")
+			}
+			return true, nil
+		case hasPrefix(rel, e.key) && d.src[e.valStart] == '{':
+			return d.deleteInline(e.valStart, rel[len(e.key):])
+		}
+	}
+	return false, nil
+}
+
+// leadingComments returns the offset of the comment lines directly above
+// entry i, or the entry start when there are none.
+func (d *Document) leadingComments(entries []entry, i int) int {
+	floor := 0
+	if i > 0 {
+		floor = entries[i-1].end
+	}
+	start := entries[i].start
+	for start > floor {
+		prev := bytes.LastIndexByte(d.src[:start-1], '\n') + 1
+		if prev < floor {
+			break
+		}
+		line := bytes.TrimSpace(d.src[prev:start])
+		if len(line) == 0 || line[0] != '#' {
+			break
+		}
+		start = prev
+	}
+	return start
+}
+
+// blockEnd returns where the section opened by header i ends: at the
+// comments leading the next header, or the end of the document.
+func (d *Document) blockEnd(entries []entry, i int) int {
+	for j := i + 1; j < len(entries); j++ {
+		if entries[j].kind != entryKeyValue {
+			return d.leadingComments(entries, j)
+		}
+	}
+	return len(d.src)
+}
+
+// contentEnd returns the end of the last expression in the section opened
+// by header i.
+func (d *Document) contentEnd(entries []entry, i int) int {
+	end := entries[i].end
+	for j := i + 1; j < len(entries) && entries[j].kind == entryKeyValue; j++ {
+		end = entries[j].end
+	}
+	return end
+}
+
+// splice replaces the text between start and end with text, whose lines are
+// written with the document's line ending.
+func (d *Document) splice(start, end int, text string) {
+	if d.eol == "\r\n" {
+		text = strings.ReplaceAll(strings.ReplaceAll(text, "\r\n", "\n"), "\n", d.eol)
+	}
+	out := make([]byte, 0, len(d.src)-(end-start)+len(text))
+	out = append(out, d.src[:start]...)
+	out = append(out, text...)
+	out = append(out, d.src[end:]...)
+	d.src = out
+}
+
+// endsBlank reports whether b ends with a blank line, with either line ending.
+func endsBlank(b []byte) bool {
+	return bytes.HasSuffix(b, []byte("\n\n")) || bytes.HasSuffix(b, []byte("\n\r\n"))
+}
+
+// trailingBreak returns the line break b ends with.
+func trailingBreak(b []byte) string {
+	if bytes.HasSuffix(b, []byte("\r\n")) {
+		return "\r\n"
+	}
+	return "\n"
+}
+
+// lineBreakAt reports whether a line break, with either line ending, starts
+// at offset pos of b.
+func lineBreakAt(b []byte, pos int) bool {
+	return b[pos] == '\n' || bytes.HasPrefix(b[pos:], []byte("\r\n"))
+}
+
+func firstHeader(entries []entry) int {
+	for i, e := range entries {
+		if e.kind != entryKeyValue {
+			return i
+		}
+	}
+	return -1
+}
+
+func leadingSpace(line []byte) string {
+	n := 0
+	for n < len(line) && (line[n] == ' ' || line[n] == '\t') {
+		n++
+	}
+	return string(line[:n])
+}
+
+func equalPath(a, b []string) bool {
+	return len(a) == len(b) && hasPrefix(a, b)
+}
+
+// hasPrefix reports whether prefix is a leading part of path.
+func hasPrefix(path, prefix []string) bool {
+	if len(prefix) > len(path) {
+		return false
+	}
+	for i := range prefix {
+		if path[i] != prefix[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func commonPrefix(a, b []string) int {
+	n := 0
+	for n < len(a) && n < len(b) && a[n] == b[n] {
+		n++
+	}
+	return n
+}
+
+// LineRanges returns the 1-based, inclusive line ranges covered by the
+// key/values and tables at or below path, in document order.
+func (d *Document) LineRanges(path []string) [][2]int {
+	entries, err := index(d.src)
+	if err != nil {
+		return nil
+	}
+	var ranges [][2]int
+	for i, e := range entries {
+		if !hasPrefix(e.path, path) {
+			continue
+		}
+		end := e.end
+		if e.kind != entryKeyValue {
+			end = d.contentEnd(entries, i)
+		}
+		r := [2]int{d.lineOf(e.start), d.lineOf(end - 1)}
+		if n := len(ranges); n > 0 && r[0] <= ranges[n-1][1]+1 {
+			ranges[n-1][1] = max(ranges[n-1][1], r[1])
+			continue
+		}
+		ranges = append(ranges, r)
+	}
+	return ranges
+}
+
+func (d *Document) lineOf(offset int) int {
+	return 1 + bytes.Count(d.src[:offset], []byte("\n"))
+}
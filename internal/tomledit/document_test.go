@@ -0,0 +1,598 @@
+package tomledit
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+// parse returns a document for src, failing the test if it is not valid.
+func parse(t *testing.T, src string) *Document {
+	t.Helper()
+	doc, err := Parse([]byte(src))
+	if err != nil {
+		t.Fatalf("Parse: %v", err)
+	}
+	return doc
+}
+
+func TestSet(t *testing.T) {
+	tests := []struct {
+		name  string
+		src   string
+		path  []string
+		value interface{}
+		want  string
+	}{
+		{
+			name: "comments and blank lines kept",
+			src: `# Podsync configuration
+
+[server]
+# Listen port
+port = 8080 # trailing comment
+
+hostname = "https://pod.example.com"
+`,
+			path:  []string{"server", "port"},
+			value: 9090,
+			want: `# Podsync configuration
+
+[server]
+# Listen port
+port = 9090 # trailing comment
+
+hostname = "https://pod.example.com"
+`,
+		},
+		{
+			name: "new key after the last key of its table",
+			src: `[server]
+port = 8080
+
+# Tokens
+[tokens]
+youtube = ["k1"]
+`,
+			path:  []string{"server", "hostname"},
+			value: "https://pod.example.com",
+			want: `[server]
+port = 8080
+hostname = "https://pod.example.com"
+
+# Tokens
+[tokens]
+youtube = ["k1"]
+`,
+		},
+		{
+			name: "new key keeps the table's indentation",
+			src: `[feeds]
+  [feeds.foo]
+  url = "https://youtube.com/channel/x"
+`,
+			path:  []string{"feeds", "foo", "format"},
+			value: "audio",
+			want: `[feeds]
+  [feeds.foo]
+  url = "https://youtube.com/channel/x"
+  format = "audio"
+`,
+		},
+		{
+			name:  "new root key goes above the first table",
+			src:   "# Header\n[server]\nport = 8080\n",
+			path:  []string{"log_level"},
+			value: "debug",
+			want:  "log_level = \"debug\"\n\n# Header\n[server]\nport = 8080\n",
+		},
+		{
+			name:  "inline table value replaced",
+			src:   "[feeds.foo]\nfilters = { title = \"foo\", max_age = 30 }\n",
+			path:  []string{"feeds", "foo", "filters", "max_age"},
+			value: 7,
+			want:  "[feeds.foo]\nfilters = { title = \"foo\", max_age = 7 }\n",
+		},
+		{
+			name:  "inline table key added",
+			src:   "[feeds.foo]\nclean = { keep_last = 3 }\n",
+			path:  []string{"feeds", "foo", "clean", "max_age"},
+			value: 10,
+			want:  "[feeds.foo]\nclean = { keep_last = 3, max_age = 10 }\n",
+		},
+		{
+			name:  "empty inline table filled",
+			src:   "[feeds.foo]\nfilters = {}\n",
+			path:  []string{"feeds", "foo", "filters", "title"},
+			value: "news",
+			want:  "[feeds.foo]\nfilters = { title = \"news\" }\n",
+		},
+		{
+			name:  "nested inline table",
+			src:   "a = { b = { c = 1 }, d = 2 }\n",
+			path:  []string{"a", "b", "c"},
+			value: 5,
+			want:  "a = { b = { c = 5 }, d = 2 }\n",
+		},
+		{
+			name:  "value inside an array of tables",
+			src:   "[[items]]\nname = \"a\"\n\n[[items]]\nname = \"b\"\n\n[other]\nx = 1\n",
+			path:  []string{"other", "x"},
+			value: 2,
+			want:  "[[items]]\nname = \"a\"\n\n[[items]]\nname = \"b\"\n\n[other]\nx = 2\n",
+		},
+		{
+			name:  "dotted key replaced",
+			src:   "[server]\ntls.enabled = false\ntls.port = 443\n",
+			path:  []string{"server", "tls", "port"},
+			value: 8443,
+			want:  "[server]\ntls.enabled = false\ntls.port = 8443\n",
+		},
+		{
+			name:  "dotted key added next to its siblings",
+			src:   "[server]\ntls.enabled = false\nport = 80\n",
+			path:  []string{"server", "tls", "port"},
+			value: 443,
+			want:  "[server]\ntls.enabled = false\nport = 80\ntls.port = 443\n",
+		},
+		{
+			name:  "quoted key replaced",
+			src:   "[feeds]\n  [feeds.\"my feed\"]\n  url = \"x\"\n",
+			path:  []string{"feeds", "my feed", "url"},
+			value: "y",
+			want:  "[feeds]\n  [feeds.\"my feed\"]\n  url = \"y\"\n",
+		},
+		{
+			name:  "quoted key written for a new key",
+			src:   "[feeds]\n",
+			path:  []string{"feeds", "my.feed"},
+			value: Table{{Key: "url", Value: "x"}},
+			want:  "[feeds]\n\n[feeds.\"my.feed\"]\nurl = \"x\"\n",
+		},
+		{
+			name: "table added after its siblings",
+			src: `[server]
+port = 8080
+
+[feeds]
+  [feeds.foo]
+  url = "x"
+
+[tokens]
+youtube = ["k1"]
+`,
+			path: []string{"feeds", "bar"},
+			value: Table{
+				{Key: "url", Value: "y"},
+				{Key: "format", Value: "audio"},
+				{Key: "filters", Value: Table{{Key: "title", Value: "news"}}},
+			},
+			want: `[server]
+port = 8080
+
+[feeds]
+  [feeds.foo]
+  url = "x"
+
+[feeds.bar]
+url = "y"
+format = "audio"
+
+[feeds.bar.filters]
+title = "news"
+
+[tokens]
+youtube = ["k1"]
+`,
+		},
+		{
+			name:  "table added at the end",
+			src:   "[server]\nport = 8080\n",
+			path:  []string{"storage", "s3"},
+			value: map[string]interface{}{"bucket": "pods", "region": "eu"},
+			want:  "[server]\nport = 8080\n\n[storage.s3]\nbucket = \"pods\"\nregion = \"eu\"\n",
+		},
+		{
+			name:  "table added before an unseparated header",
+			src:   "[a]\nx = 1\n[c]\nz = 3\n",
+			path:  []string{"a", "b"},
+			value: Table{{Key: "y", Value: 1}},
+			want:  "[a]\nx = 1\n\n[a.b]\ny = 1\n\n[c]\nz = 3\n",
+		},
+		{
+			name:  "key in a missing table",
+			src:   "[server]\nport = 8080\n",
+			path:  []string{"database", "dir"},
+			value: "/db",
+			want:  "[server]\nport = 8080\n\n[database]\ndir = \"/db\"\n",
+		},
+		{
+			name:  "table replaced in place, keeping comments above it",
+			src:   "[a]\nx = 1\n\n# About b\n[b]\ny = 2\nz = 3\n\n[c]\nw = 4\n",
+			path:  []string{"b"},
+			value: Table{{Key: "y", Value: 5}},
+			want:  "[a]\nx = 1\n\n# About b\n[b]\ny = 5\n\n[c]\nw = 4\n",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			doc := parse(t, tt.src)
+			if err := doc.Set(tt.path, tt.value); err != nil {
+				t.Fatalf("Set(%v): %v", tt.path, err)
+			}
+			if got := string(doc.Bytes()); got != tt.want {
+				t.Errorf("Set(%v) =\n%s\nwant\n%s", tt.path, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSetErrors(t *testing.T) {
+	tests := []struct {
+		name  string
+		src   string
+		path  []string
+		value interface{}
+	}{
+		{"empty path", "a = 1\n", nil, 1},
+		{"table replaced by a value", "[server]\nport = 8080\n", []string{"server"}, 1},
+		{"parent of a table replaced by a value", "[feeds.foo]\nurl = \"x\"\n", []string{"feeds"}, "x"},
+		{"nil value", "a = 1\n", []string{"a"}, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			doc := parse(t, tt.src)
+			if err := doc.Set(tt.path, tt.value); err == nil {
+				t.Fatalf("Set(%v) succeeded", tt.path)
+			}
+			if got := string(doc.Bytes()); got != tt.src {
+				t.Errorf("failed Set changed the document to\n%s", got)
+			}
+		})
+	}
+}
+
+func TestDelete(t *testing.T) {
+	tests := []struct {
+		name    string
+		src     string
+		path    []string
+		removed bool
+		want    string
+	}{
+		{
+			name:    "key and its comment",
+			src:     "[server]\n# Listen port\nport = 8080\nhostname = \"h\"\n",
+			path:    []string{"server", "port"},
+			removed: true,
+			want:    "[server]\nhostname = \"h\"\n",
+		},
+		{
+			name:    "blank lines around other keys kept",
+			src:     "[server]\nport = 8080\n\nbind = \"::\"\n\nhostname = \"h\"\n",
+			path:    []string{"server", "bind"},
+			removed: true,
+			want:    "[server]\nport = 8080\n\n\nhostname = \"h\"\n",
+		},
+		{
+			name:    "table with sub-tables",
+			src:     "[a]\nx = 1\n\n# Feed\n[feeds.foo]\nurl = \"x\"\n\n[feeds.foo.filters]\ntitle = \"t\"\n\n[z]\ny = 2\n",
+			path:    []string{"feeds", "foo"},
+			removed: true,
+			want:    "[a]\nx = 1\n\n[z]\ny = 2\n",
+		},
+		{
+			name:    "table between unseparated text keeps a blank line",
+			src:     "[a]\nx = 1\n[b]\ny = 2\n\n[c]\nz = 3\n",
+			path:    []string{"b"},
+			removed: true,
+			want:    "[a]\nx = 1\n\n[c]\nz = 3\n",
+		},
+		{
+			name:    "last table trims trailing blank lines",
+			src:     "[a]\nx = 1\n\n[b]\ny = 2\n",
+			path:    []string{"b"},
+			removed: true,
+			want:    "[a]\nx = 1\n",
+		},
+		{
+			name:    "inline table entry",
+			src:     "[feeds.foo]\nfilters = { title = \"t\", max_age = 30 }\n",
+			path:    []string{"feeds", "foo", "filters", "title"},
+			removed: true,
+			want:    "[feeds.foo]\nfilters = { max_age = 30 }\n",
+		},
+		{
+			name:    "last inline table entry",
+			src:     "[feeds.foo]\nfilters = { max_age = 30, title = \"t\" }\n",
+			path:    []string{"feeds", "foo", "filters", "title"},
+			removed: true,
+			want:    "[feeds.foo]\nfilters = { max_age = 30 }\n",
+		},
+		{
+			name:    "only inline table entry",
+			src:     "[feeds.foo]\nclean = { keep_last = 3 }\n",
+			path:    []string{"feeds", "foo", "clean", "keep_last"},
+			removed: true,
+			want:    "[feeds.foo]\nclean = {}\n",
+		},
+		{
+			name:    "missing inline table entry",
+			src:     "[feeds.foo]\nclean = { keep_last = 3 }\n",
+			path:    []string{"feeds", "foo", "clean", "max_age"},
+			removed: false,
+			want:    "[feeds.foo]\nclean = { keep_last = 3 }\n",
+		},
+		{
+			name:    "dotted key",
+			src:     "[server]\ntls.enabled = false\ntls.port = 443\n",
+			path:    []string{"server", "tls", "port"},
+			removed: true,
+			want:    "[server]\ntls.enabled = false\n",
+		},
+		{
+			name:    "all dotted keys below a path",
+			src:     "[server]\nport = 80\ntls.enabled = false\ntls.port = 443\n",
+			path:    []string{"server", "tls"},
+			removed: true,
+			want:    "[server]\nport = 80\n",
+		},
+		{
+			name:    "quoted key",
+			src:     "[feeds]\n\n[feeds.\"my feed\"]\nurl = \"x\"\n\n[feeds.other]\nurl = \"y\"\n",
+			path:    []string{"feeds", "my feed"},
+			removed: true,
+			want:    "[feeds]\n\n[feeds.other]\nurl = \"y\"\n",
+		},
+		{
+			name:    "array of tables",
+			src:     "[a]\nx = 1\n\n[[items]]\nname = \"a\"\n\n[[items]]\nname = \"b\"\n",
+			path:    []string{"items"},
+			removed: true,
+			want:    "[a]\nx = 1\n",
+		},
+		{
+			name:    "missing key",
+			src:     "[server]\nport = 8080\n",
+			path:    []string{"server", "hostname"},
+			removed: false,
+			want:    "[server]\nport = 8080\n",
+		},
+		{
+			name: "emptied table header removed",
+			src: `[storage]
+  type = "s3"
+
+  [storage.local]
+  data_dir = "/app/data"
+
+  [storage.s3]
+  bucket = "pods"
+`,
+			path:    []string{"storage", "local", "data_dir"},
+			removed: true,
+			want: `[storage]
+  type = "s3"
+
+  [storage.s3]
+  bucket = "pods"
+`,
+		},
+		{
+			name:    "emptied table header removed at the end",
+			src:     "[server]\nport = 8080\n\n# Local storage\n[storage.local]\ndata_dir = \"/app/data\"\n",
+			path:    []string{"storage", "local", "data_dir"},
+			removed: true,
+			want:    "[server]\nport = 8080\n",
+		},
+		{
+			name:    "header with other keys kept",
+			src:     "[server]\nport = 8080\nhostname = \"h\"\n",
+			path:    []string{"server", "port"},
+			removed: true,
+			want:    "[server]\nhostname = \"h\"\n",
+		},
+		{
+			name:    "header with sub-tables kept",
+			src:     "[storage]\ntype = \"local\"\n\n[storage.local]\ndata_dir = \"/d\"\n",
+			path:    []string{"storage", "type"},
+			removed: true,
+			want:    "[storage]\n\n[storage.local]\ndata_dir = \"/d\"\n",
+		},
+		{
+			name:    "array table header kept",
+			src:     "[[items]]\nname = \"a\"\n",
+			path:    []string{"items", "name"},
+			removed: false,
+			want:    "[[items]]\nname = \"a\"\n",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			doc := parse(t, tt.src)
+			removed, err := doc.Delete(tt.path)
+			if err != nil {
+				t.Fatalf("Delete(%v): %v", tt.path, err)
+			}
+			if removed != tt.removed {
+				t.Errorf("Delete(%v) removed = %v, want %v", tt.path, removed, tt.removed)
+			}
+			if got := string(doc.Bytes()); got != tt.want {
+				t.Errorf("Delete(%v) =\n%s\nwant\n%s", tt.path, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSectionRoundTrip(t *testing.T) {
+	src := `[server]
+port = 8080
+
+[feeds]
+  # Main channel
+  [feeds.foo]
+  url = "x" # the channel
+
+  # Only news
+  [feeds.foo.filters]
+  title = "news"
+
+  [feeds.bar]
+  url = "y"
+
+[tokens]
+youtube = ["k1"]
+`
+	doc := parse(t, src)
+	section, ok := doc.Section([]string{"feeds", "foo"})
+	if !ok {
+		t.Fatal("Section(feeds.foo) not found")
+	}
+	want := `  # Main channel
+  [feeds.foo]
+  url = "x" # the channel
+
+  # Only news
+  [feeds.foo.filters]
+  title = "news"
+`
+	if section != want {
+		t.Errorf("Section =\n%s\nwant\n%s", section, want)
+	}
+
+	if _, err := doc.Delete([]string{"feeds", "foo"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := doc.InsertSection([]string{"feeds", "foo"}, section); err != nil {
+		t.Fatalf("InsertSection: %v", err)
+	}
+	got, ok := doc.Section([]string{"feeds", "foo"})
+	if !ok || got != want {
+		t.Errorf("Section after InsertSection =\n%s\nwant\n%s", got, want)
+	}
+	if err := doc.InsertSection([]string{"feeds", "foo"}, section); err == nil {
+		t.Error("InsertSection over an existing table succeeded")
+	}
+}
+
+func TestSectionUnavailable(t *testing.T) {
+	tests := []struct {
+		name string
+		src  string
+		path []string
+	}{
+		{"missing", "[server]\nport = 8080\n", []string{"feeds", "foo"}},
+		{"empty path", "[server]\nport = 8080\n", nil},
+		{"dotted keys", "[feeds]\nfoo.url = \"x\"\n", []string{"feeds", "foo"}},
+		{"inline table", "[feeds]\nfoo = { url = \"x\" }\n", []string{"feeds", "foo"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if s, ok := parse(t, tt.src).Section(tt.path); ok {
+				t.Errorf("Section(%v) = %q, want none", tt.path, s)
+			}
+		})
+	}
+}
+
+func TestInsertSectionRejectsOtherText(t *testing.T) {
+	doc := parse(t, "[feeds]\n")
+	for _, text := range []string{
+		"[feeds.bar]\nurl = \"y\"\n",
+		"[feeds.foo]\nurl = \"x\"\n\n[server]\nport = 1\n",
+		"url = \"x\"\n",
+	} {
+		if err := doc.InsertSection([]string{"feeds", "foo"}, text); err == nil {
+			t.Errorf("InsertSection(%q) succeeded", text)
+		}
+	}
+}
+
+func TestCRLFLineEndings(t *testing.T) {
+	src := `# Podsync configuration
+[server]
+port = 8080
+
+[feeds]
+  # Main channel
+  [feeds.foo]
+  url = "https://youtube.com/channel/x"
+
+  [feeds.bar]
+  url = "https://youtube.com/channel/y"
+`
+	tests := []struct {
+		name string
+		edit func(doc *Document) error
+	}{
+		{"set existing key", func(doc *Document) error { return doc.Set([]string{"server", "port"}, 9090) }},
+		{"new key", func(doc *Document) error { return doc.Set([]string{"server", "hostname"}, "https://pod.example.com") }},
+		{"new table", func(doc *Document) error {
+			return doc.Set([]string{"feeds", "baz"}, Table{{Key: "url", Value: "https://youtube.com/channel/z"}, {Key: "page_size", Value: 10}})
+		}},
+		{"new top-level table", func(doc *Document) error {
+			return doc.Set([]string{"tokens"}, Table{{Key: "youtube", Value: []string{"k1", "k2"}}})
+		}},
+		{"delete key", func(doc *Document) error { _, err := doc.Delete([]string{"server", "port"}); return err }},
+		{"delete table", func(doc *Document) error { _, err := doc.Delete([]string{"feeds", "foo"}); return err }},
+		{"delete last table", func(doc *Document) error { _, err := doc.Delete([]string{"feeds", "bar"}); return err }},
+		{"section moved", func(doc *Document) error {
+			section, ok := doc.Section([]string{"feeds", "foo"})
+			if !ok {
+				return errors.New("no section")
+			}
+			if _, err := doc.Delete([]string{"feeds", "foo"}); err != nil {
+				return err
+			}
+			return doc.InsertSection([]string{"feeds", "foo"}, section)
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			lf := parse(t, src)
+			if err := tt.edit(lf); err != nil {
+				t.Fatalf("edit with LF: %v", err)
+			}
+			crlf := parse(t, strings.ReplaceAll(src, "\n", "\r\n"))
+			if err := tt.edit(crlf); err != nil {
+				t.Fatalf("edit with CRLF: %v", err)
+			}
+			// The same edit, with every line ending in CRLF.
+			want := strings.ReplaceAll(string(lf.Bytes()), "\n", "\r\n")
+			if got := string(crlf.Bytes()); got != want {
+				t.Errorf("edit with CRLF =\n%q\nwant\n%q", got, want)
+			}
+		})
+	}
+}
+
+func TestSectionKeepsCRLF(t *testing.T) {
+	doc := parse(t, "[feeds]\r\n  # Main\r\n  [feeds.foo]\r\n  url = \"x\"\r\n\r\n  [feeds.foo.filters]\r\n  title = \"y\"\r\n")
+	want := "  # Main\r\n  [feeds.foo]\r\n  url = \"x\"\r\n\r\n  [feeds.foo.filters]\r\n  title = \"y\"\r\n"
+	if got, ok := doc.Section([]string{"feeds", "foo"}); !ok || got != want {
+		t.Errorf("Section = %q, %v; want %q", got, ok, want)
+	}
+}
+
+func TestParseSyntaxError(t *testing.T) {
+	tests := []struct {
+		name         string
+		src          string
+		line, column int
+	}{
+		{"missing value", "[server]\nport = \n", 2, 8},
+		{"duplicate key", "[server]\nport = 1\n  port = 2\n", 3, 3},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := Parse([]byte(tt.src))
+			var serr *SyntaxError
+			if !errors.As(err, &serr) {
+				t.Fatalf("Parse error = %v, want a SyntaxError", err)
+			}
+			if serr.Line != tt.line || serr.Column != tt.column {
+				t.Errorf("position = %d:%d, want %d:%d", serr.Line, serr.Column, tt.line, tt.column)
+			}
+		})
+	}
+}
@@ -0,0 +1,184 @@
+package tomledit
+
+import (
+	"fmt"
+	"math"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// KeyValue is a single entry of a Table.
+type KeyValue struct {
+	Key   string
+	Value interface{}
+}
+
+// Table is an ordered set of key/values. Unlike a map, its keys are written
+// in the order given.
+type Table []KeyValue
+
+// isTable reports whether v is written as a table rather than a plain value.
+func isTable(v interface{}) bool {
+	if _, ok := v.(Table); ok {
+		return true
+	}
+	rv := reflect.ValueOf(v)
+	return rv.Kind() == reflect.Map && rv.Type().Key().Kind() == reflect.String
+}
+
+// tableEntries returns the key/values of a Table or string-keyed map. Map
+// keys are sorted so the output is deterministic.
+func tableEntries(v interface{}) Table {
+	if t, ok := v.(Table); ok {
+		return t
+	}
+	rv := reflect.ValueOf(v)
+	keys := make([]string, 0, rv.Len())
+	for _, k := range rv.MapKeys() {
+		keys = append(keys, k.String())
+	}
+	sort.Strings(keys)
+	t := make(Table, 0, len(keys))
+	for _, k := range keys {
+		t = append(t, KeyValue{Key: k, Value: rv.MapIndex(reflect.ValueOf(k).Convert(rv.Type().Key())).Interface()})
+	}
+	return t
+}
+
+// encodeKey formats a key path, quoting parts that are not bare keys.
+func encodeKey(path []string) string {
+	parts := make([]string, len(path))
+	for i, p := range path {
+		parts[i] = encodeSimpleKey(p)
+	}
+	return strings.Join(parts, ".")
+}
+
+func encodeSimpleKey(k string) string {
+	if k == "" {
+		return `""`
+	}
+	for i := 0; i < len(k); i++ {
+		if !isBareKeyChar(k[i]) {
+			return quote(k)
+		}
+	}
+	return k
+}
+
+// encodeValue formats v as an inline TOML value.
+func encodeValue(v interface{}) (string, error) {
+	switch t := v.(type) {
+	case nil:
+		return "", fmt.Errorf("toml: cannot encode nil value")
+	case string:
+		return quote(t), nil
+	case bool:
+		return strconv.FormatBool(t), nil
+	case time.Time:
+		return t.Format(time.RFC3339Nano), nil
+	case time.Duration:
+		return quote(t.String()), nil
+	case fmt.Stringer:
+		// Local dates and times from go-toml are written bare.
+		if strings.HasPrefix(reflect.TypeOf(v).String(), "toml.Local") {
+			return t.String(), nil
+		}
+		return quote(t.String()), nil
+	}
+	if isTable(v) {
+		entries := tableEntries(v)
+		if len(entries) == 0 {
+			return "{}", nil
+		}
+		parts := make([]string, 0, len(entries))
+		for _, kv := range entries {
+			s, err := encodeValue(kv.Value)
+			if err != nil {
+				return "", err
+			}
+			parts = append(parts, encodeSimpleKey(kv.Key)+" = "+s)
+		}
+		return "{ " + strings.Join(parts, ", ") + " }", nil
+	}
+	rv := reflect.ValueOf(v)
+	switch rv.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return strconv.FormatInt(rv.Int(), 10), nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return strconv.FormatUint(rv.Uint(), 10), nil
+	case reflect.Float32, reflect.Float64:
+		return encodeFloat(rv.Float()), nil
+	case reflect.String:
+		return quote(rv.String()), nil
+	case reflect.Bool:
+		return strconv.FormatBool(rv.Bool()), nil
+	case reflect.Slice, reflect.Array:
+		parts := make([]string, 0, rv.Len())
+		for i := 0; i < rv.Len(); i++ {
+			s, err := encodeValue(rv.Index(i).Interface())
+			if err != nil {
+				return "", err
+			}
+			parts = append(parts, s)
+		}
+		return "[" + strings.Join(parts, ", ") + "]", nil
+	case reflect.Ptr, reflect.Interface:
+		if rv.IsNil() {
+			return "", fmt.Errorf("toml: cannot encode nil value")
+		}
+		return encodeValue(rv.Elem().Interface())
+	}
+	return "", fmt.Errorf("toml: cannot encode value of type %T", v)
+}
+
+func encodeFloat(f float64) string {
+	switch {
+	case math.IsInf(f, 1):
+		return "inf"
+	case math.IsInf(f, -1):
+		return "-inf"
+	case math.IsNaN(f):
+		return "nan"
+	}
+	s := strconv.FormatFloat(f, 'g', -1, 64)
+	if !strings.ContainsAny(s, ".eEn") {
+		s += ".0"
+	}
+	return s
+}
+
+// quote formats s as a TOML basic string.
+func quote(s string) string {
+	var sb strings.Builder
+	sb.WriteByte('"')
+	for _, r := range s {
+		switch r {
+		case '"':
+			sb.WriteString(`\"`)
+		case '\\':
+			sb.WriteString(`\\`)
+		case '\b':
+			sb.WriteString(`\b`)
+		case '\t':
+			sb.WriteString(`\t`)
+		case '\n':
+			sb.WriteString(`\n`)
+		case '\f':
+			sb.WriteString(`\f`)
+		case '\r':
+			sb.WriteString(`\r`)
+		default:
+			if r < 0x20 || r == 0x7f {
+				fmt.Fprintf(&sb, `\u%04X`, r)
+			} else {
+				sb.WriteRune(r)
+			}
+		}
+	}
+	sb.WriteByte('"')
+	return sb.String()
+}
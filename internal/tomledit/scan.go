@@ -0,0 +1,454 @@
+package tomledit
+
+import (
+	"fmt"
+	"strings"
+)
+
+type entryKind int
+
+const (
+	entryTable entryKind = iota
+	entryArrayTable
+	entryKeyValue
+)
+
+// entry is a single table header or key/value expression in the source.
+type entry struct {
+	kind entryKind
+	// path is the table name for headers, or the full key path (table name
+	// followed by the dotted key) for key/values.
+	path []string
+	// key is the dotted key relative to its table (key/values only).
+	key []string
+	// table is the header entry index the key/value belongs to, or -1 for
+	// the root table.
+	table int
+	// start and end cover the whole source lines of the expression,
+	// including the trailing newline.
+	start, end int
+	// valStart and valEnd cover the value of a key/value.
+	valStart, valEnd int
+}
+
+// scanner walks TOML source and records the position of every expression.
+type scanner struct {
+	src []byte
+	pos int
+}
+
+// index scans src and returns its table headers and key/values in order.
+func index(src []byte) ([]entry, error) {
+	s := &scanner{src: src}
+	var entries []entry
+	table := -1
+	var tablePath []string
+	for s.pos < len(s.src) {
+		lineStart := s.pos
+		s.skipSpace()
+		if s.eof() {
+			break
+		}
+		switch c := s.src[s.pos]; {
+		case c == '\n' || c == '\r' || c == '#':
+			s.skipLine()
+			continue
+		case c == '[':
+			kind := entryTable
+			s.pos++
+			if s.peek() == '[' {
+				kind = entryArrayTable
+				s.pos++
+			}
+			s.skipSpace()
+			name, err := s.scanKey()
+			if err != nil {
+				return nil, err
+			}
+			s.skipSpace()
+			if !s.consume("]") || (kind == entryArrayTable && !s.consume("]")) {
+				return nil, s.errorf("unterminated table header")
+			}
+			if err := s.finishLine(); err != nil {
+				return nil, err
+			}
+			entries = append(entries, entry{kind: kind, path: name, table: -1, start: lineStart, end: s.pos})
+			table = len(entries) - 1
+			tablePath = name
+			if kind == entryArrayTable {
+				// Keys under an array of tables cannot be addressed by path.
+				tablePath = append(append([]string{}, name...), "[]")
+			}
+		default:
+			key, err := s.scanKey()
+			if err != nil {
+				return nil, err
+			}
+			s.skipSpace()
+			if !s.consume("=") {
+				return nil, s.errorf("expected '=' after key")
+			}
+			s.skipSpace()
+			valStart := s.pos
+			if err := s.scanValue(); err != nil {
+				return nil, err
+			}
+			valEnd := s.pos
+			if err := s.finishLine(); err != nil {
+				return nil, err
+			}
+			full := append(append([]string{}, tablePath...), key...)
+			entries = append(entries, entry{
+				kind: entryKeyValue, path: full, key: key, table: table,
+				start: lineStart, end: s.pos, valStart: valStart, valEnd: valEnd,
+			})
+		}
+	}
+	return entries, nil
+}
+
+func (s *scanner) eof() bool { return s.pos >= len(s.src) }
+
+func (s *scanner) peek() byte {
+	if s.eof() {
+		return 0
+	}
+	return s.src[s.pos]
+}
+
+func (s *scanner) consume(tok string) bool {
+	if strings.HasPrefix(string(s.src[s.pos:]), tok) {
+		s.pos += len(tok)
+		return true
+	}
+	return false
+}
+
+func (s *scanner) errorf(format string, args ...interface{}) error {
+	line, column := position(s.src, s.pos)
+	return &SyntaxError{Line: line, Column: column, Msg: fmt.Sprintf(format, args...)}
+}
+
+// position returns the 1-based line and column of offset in src.
+func position(src []byte, offset int) (line, column int) {
+	before := string(src[:offset])
+	return 1 + strings.Count(before, "\n"), offset - strings.LastIndexByte(before, '\n')
+}
+
+// duplicate returns the entry that redefines an earlier table or key, if
+// any. Keys under arrays of tables repeat legitimately and are not checked.
+func duplicate(entries []entry) (entry, bool) {
+	seen := map[string]bool{}
+	for _, e := range entries {
+		if e.kind == entryArrayTable {
+			continue
+		}
+		name := strings.Join(e.path, "\x00")
+		if strings.Contains(name, "[]") {
+			continue
+		}
+		if seen[name] {
+			return e, true
+		}
+		seen[name] = true
+	}
+	return entry{}, false
+}
+
+func (s *scanner) skipSpace() {
+	for !s.eof() && (s.src[s.pos] == ' ' || s.src[s.pos] == '\t') {
+		s.pos++
+	}
+}
+
+// skipLine moves past the next newline.
+func (s *scanner) skipLine() {
+	for !s.eof() {
+		c := s.src[s.pos]
+		s.pos++
+		if c == '\n' {
+			return
+		}
+	}
+}
+
+// skipBlank skips whitespace, newlines and comments inside arrays and
+// inline tables.
+func (s *scanner) skipBlank() {
+	for !s.eof() {
+		switch s.src[s.pos] {
+		case ' ', '\t', '\r', '\n':
+			s.pos++
+		case '#':
+			for !s.eof() && s.src[s.pos] != '\n' {
+				s.pos++
+			}
+		default:
+			return
+		}
+	}
+}
+
+// finishLine consumes optional whitespace and a comment up to and including
+// the end of the line.
+func (s *scanner) finishLine() error {
+	s.skipSpace()
+	if s.eof() {
+		return nil
+	}
+	switch s.src[s.pos] {
+	case '#', '\r', '\n':
+		s.skipLine()
+		return nil
+	}
+	return s.errorf("unexpected %q after expression", s.src[s.pos])
+}
+
+// scanKey reads a possibly dotted key and returns its unquoted parts.
+func (s *scanner) scanKey() ([]string, error) {
+	var parts []string
+	for {
+		part, err := s.scanSimpleKey()
+		if err != nil {
+			return nil, err
+		}
+		parts = append(parts, part)
+		s.skipSpace()
+		if s.peek() != '.' {
+			return parts, nil
+		}
+		s.pos++
+		s.skipSpace()
+	}
+}
+
+func (s *scanner) scanSimpleKey() (string, error) {
+	switch s.peek() {
+	case '"':
+		start := s.pos
+		if err := s.scanBasicString(); err != nil {
+			return "", err
+		}
+		return unquoteBasic(string(s.src[start+1 : s.pos-1])), nil
+	case '\'':
+		start := s.pos
+		if err := s.scanLiteralString(); err != nil {
+			return "", err
+		}
+		return string(s.src[start+1 : s.pos-1]), nil
+	}
+	start := s.pos
+	for !s.eof() && isBareKeyChar(s.src[s.pos]) {
+		s.pos++
+	}
+	if start == s.pos {
+		return "", s.errorf("invalid key")
+	}
+	return string(s.src[start:s.pos]), nil
+}
+
+// scanValue moves past a single value of any type.
+func (s *scanner) scanValue() error {
+	switch {
+	case s.consume(`"""`):
+		return s.scanMultiline(`"""`, true)
+	case s.consume(`'''`):
+		return s.scanMultiline(`'''`, false)
+	case s.peek() == '"':
+		return s.scanBasicString()
+	case s.peek() == '\'':
+		return s.scanLiteralString()
+	case s.peek() == '[':
+		return s.scanArray()
+	case s.peek() == '{':
+		return s.scanInlineTable()
+	}
+	return s.scanScalar()
+}
+
+func (s *scanner) scanBasicString() error {
+	s.pos++
+	for !s.eof() {
+		switch s.src[s.pos] {
+		case '\\':
+			s.pos += 2
+			continue
+		case '"':
+			s.pos++
+			return nil
+		case '\n':
+			return s.errorf("unterminated string")
+		}
+		s.pos++
+	}
+	return s.errorf("unterminated string")
+}
+
+func (s *scanner) scanLiteralString() error {
+	s.pos++
+	for !s.eof() {
+		switch s.src[s.pos] {
+		case '\'':
+			s.pos++
+			return nil
+		case '\n':
+			return s.errorf("unterminated string")
+		}
+		s.pos++
+	}
+	return s.errorf("unterminated string")
+}
+
+func (s *scanner) scanMultiline(delim string, escapes bool) error {
+	for !s.eof() {
+		if escapes && s.src[s.pos] == '\\' {
+			s.pos += 2
+			continue
+		}
+		if s.consume(delim) {
+			// Up to two quotes may directly precede the closing delimiter.
+			for i := 0; i < 2 && s.peek() == delim[0]; i++ {
+				s.pos++
+			}
+			return nil
+		}
+		s.pos++
+	}
+	return s.errorf("unterminated multi-line string")
+}
+
+func (s *scanner) scanArray() error {
+	s.pos++
+	for {
+		s.skipBlank()
+		if s.eof() {
+			return s.errorf("unterminated array")
+		}
+		if s.peek() == ']' {
+			s.pos++
+			return nil
+		}
+		if err := s.scanValue(); err != nil {
+			return err
+		}
+		s.skipBlank()
+		if s.peek() == ',' {
+			s.pos++
+		}
+	}
+}
+
+func (s *scanner) scanInlineTable() error {
+	s.pos++
+	for {
+		s.skipBlank()
+		if s.eof() {
+			return s.errorf("unterminated inline table")
+		}
+		if s.peek() == '}' {
+			s.pos++
+			return nil
+		}
+		if _, err := s.scanKey(); err != nil {
+			return err
+		}
+		s.skipSpace()
+		if !s.consume("=") {
+			return s.errorf("expected '=' in inline table")
+		}
+		s.skipSpace()
+		if err := s.scanValue(); err != nil {
+			return err
+		}
+		s.skipBlank()
+		if s.peek() == ',' {
+			s.pos++
+		}
+	}
+}
+
+// scanScalar moves past a number, boolean or date-time.
+func (s *scanner) scanScalar() error {
+	start := s.pos
+	for !s.eof() {
+		c := s.src[s.pos]
+		if c == ' ' && isDate(s.src[start:s.pos]) && s.pos+3 < len(s.src) &&
+			isDigit(s.src[s.pos+1]) && isDigit(s.src[s.pos+2]) && s.src[s.pos+3] == ':' {
+			// A space may separate the date and time of a date-time.
+			s.pos++
+			continue
+		}
+		if c == ' ' || c == '\t' || c == '\r' || c == '\n' || c == ',' || c == ']' || c == '}' || c == '#' {
+			break
+		}
+		s.pos++
+	}
+	if start == s.pos {
+		return s.errorf("missing value")
+	}
+	return nil
+}
+
+func isDate(b []byte) bool {
+	if len(b) != 10 || b[4] != '-' || b[7] != '-' {
+		return false
+	}
+	for i, c := range b {
+		if i != 4 && i != 7 && !isDigit(c) {
+			return false
+		}
+	}
+	return true
+}
+
+func isDigit(c byte) bool { return c >= '0' && c <= '9' }
+
+func isBareKeyChar(c byte) bool {
+	return (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') || isDigit(c) || c == '_' || c == '-'
+}
+
+// unquoteBasic resolves the escapes of a basic string body. The document has
+// already been validated, so malformed escapes are copied through verbatim.
+func unquoteBasic(s string) string {
+	if !strings.Contains(s, `\`) {
+		return s
+	}
+	var sb strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] != '\\' || i+1 == len(s) {
+			sb.WriteByte(s[i])
+			continue
+		}
+		i++
+		switch s[i] {
+		case 'b':
+			sb.WriteByte('\b')
+		case 't':
+			sb.WriteByte('\t')
+		case 'n':
+			sb.WriteByte('\n')
+		case 'f':
+			sb.WriteByte('\f')
+		case 'r':
+			sb.WriteByte('\r')
+		case 'u', 'U':
+			n := 4
+			if s[i] == 'U' {
+				n = 8
+			}
+			var r rune
+			if i+n < len(s) {
+				if _, err := fmt.Sscanf(s[i+1:i+1+n], "%x", &r); err == nil {
+					sb.WriteRune(r)
+					i += n
+					continue
+				}
+			}
+			sb.WriteByte('\\')
+			sb.WriteByte(s[i])
+		default:
+			sb.WriteByte(s[i])
+		}
+	}
+	return sb.String()
+}
@@ -0,0 +1,70 @@
+import { fetchRawConfig, saveRawConfig } from './feedApi.js';
+import { showMessage, showError } from './uiHelpers.js';
+
+const editor = document.getElementById("rawConfig");
+const position = document.getElementById("rawPosition");
+const saveBtn = document.getElementById("saveRawBtn");
+let loaded = { text: '', version: '' };
+
+async function load() {
+  try {
+    loaded = await fetchRawConfig();
+    editor.value = loaded.text;
+    showPosition();
+  } catch (err) {
+    console.error(err);
+    showMessage('Error loading config.');
+  }
+}
+
+// Shows the line and column of the cursor, so reported errors can be found.
+function showPosition() {
+  const before = editor.value.slice(0, editor.selectionStart).split('\n');
+  position.textContent = `Line ${before.length}, column ${before[before.length - 1].length + 1}`;
+}
+
+// Moves the cursor to a 1-based line and column.
+function goTo(line, column) {
+  const lines = editor.value.split('\n');
+  let offset = 0;
+  for (let i = 0; i < line - 1 && i < lines.length; i++) offset += lines[i].length + 1;
+  offset += Math.max(column - 1, 0);
+  editor.focus();
+  editor.setSelectionRange(offset, offset);
+  const lineHeight = editor.scrollHeight / Math.max(lines.length, 1);
+  editor.scrollTop = Math.max((line - 5) * lineHeight, 0);
+  showPosition();
+}
+
+editor.addEventListener("keyup", showPosition);
+editor.addEventListener("click", showPosition);
+
+saveBtn.addEventListener("click", async () => {
+  saveBtn.disabled = true;
+  try {
+    const data = await saveRawConfig(editor.value, loaded.version);
+    showMessage(data.message);
+    const text = editor.value;
+    await load();
+    if (editor.value !== text) showMessage('The staged text was changed elsewhere meanwhile; showing the current text.');
+  } catch (err) {
+    console.error(err);
+    let syntax = null;
+    try { syntax = JSON.parse(err.detail); } catch (e) { /* not a syntax error */ }
+    if (syntax && syntax.line) {
+      showError(`Syntax error at line ${syntax.line}, column ${syntax.column}.`, { detail: syntax.error });
+      goTo(syntax.line, syntax.column);
+    } else {
+      showError('The config was not saved.', err);
+    }
+  } finally {
+    saveBtn.disabled = false;
+  }
+});
+
+document.getElementById("revertRawBtn").addEventListener("click", async () => {
+  await load();
+  showMessage('Reverted to the current text.');
+});
+
+load();
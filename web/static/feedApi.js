@@ -4,7 +4,10 @@ async function apiRequest(path, options = {}, responseType = 'json') {
   options.headers = Object.assign(defaultHeaders, options.headers || {});
   const response = await fetch(path, options);
   if (!response.ok) {
-    throw new Error(`Request failed: ${response.status}`);
+    const err = new Error(`Request failed: ${response.status}`);
+    err.status = response.status;
+    err.detail = (await response.text()).trim();
+    throw err;
   }
   if (responseType === 'json') {
     return response.json();
@@ -21,30 +24,177 @@ export function fetchChangelog() {
   return apiRequest('/changelog', { method: 'GET' }, 'text');
 }
 
-export function addFeed(params) {
+export function addFeed(params, version) {
   return apiRequest('/add', {
     method: 'POST',
-    headers: {"Content-Type": "application/x-www-form-urlencoded"},
+    headers: {"Content-Type": "application/x-www-form-urlencoded", "If-Match": `"${version}"`},
     body: new URLSearchParams(params).toString()
   }, 'json');
 }
 
-export function removeFeedAPI(feedKey) {
+export function removeFeedAPI(feedKey, version) {
   return apiRequest('/remove', {
     method: 'POST',
-    headers: {"Content-Type": "application/x-www-form-urlencoded"},
+    headers: {"Content-Type": "application/x-www-form-urlencoded", "If-Match": `"${version}"`},
     body: new URLSearchParams({ feedKey }).toString()
   }, 'json');
 }
 
-export function modifyFeed(params) {
+export function modifyFeed(params, version) {
   return apiRequest('/modify', {
+    method: 'POST',
+    headers: {"Content-Type": "application/x-www-form-urlencoded", "If-Match": `"${version}"`},
+    body: new URLSearchParams(params).toString()
+  }, 'json');
+}
+
+export function previewFiltersAPI(params) {
+  return apiRequest('/filters/preview', {
     method: 'POST',
     headers: {"Content-Type": "application/x-www-form-urlencoded"},
     body: new URLSearchParams(params).toString()
   }, 'json');
 }
 
+export function fetchCategories() {
+  return apiRequest('/categories', { method: 'GET' }, 'json');
+}
+
+export function previewScheduleAPI(cronSchedule, tz) {
+  const params = new URLSearchParams({ cron_schedule: cronSchedule, tz });
+  return apiRequest(`/schedule/preview?${params}`, { method: 'GET' }, 'json');
+}
+
+export function applyDraftAPI(version) {
+  return apiRequest('/draft/apply', {
+    method: 'POST',
+    headers: {"If-Match": `"${version}"`}
+  }, 'json');
+}
+
+export function discardDraftAPI(version) {
+  return apiRequest('/draft/discard', {
+    method: 'POST',
+    headers: {"If-Match": `"${version}"`}
+  }, 'json');
+}
+
+export function undoAPI(id, version) {
+  return apiRequest('/undo', {
+    method: 'POST',
+    headers: {"Content-Type": "application/x-www-form-urlencoded", "If-Match": `"${version}"`},
+    body: new URLSearchParams({ id }).toString()
+  }, 'json');
+}
+
+export function redoAPI(version) {
+  return apiRequest('/redo', {
+    method: 'POST',
+    headers: {"If-Match": `"${version}"`}
+  }, 'json');
+}
+
 export function reloadContainer() {
   return apiRequest('/reload', { method: 'POST' }, 'json');
 }
+
+
+export async function fetchRawConfig() {
+  const response = await fetch('/config/raw');
+  if (!response.ok) {
+    throw new Error(`Request failed: ${response.status}`);
+  }
+  return { text: await response.text(), version: response.headers.get('ETag').replace(/"/g, '') };
+}
+
+export function saveRawConfig(text, version) {
+  return apiRequest('/config/raw', {
+    method: 'PUT',
+    headers: {"Content-Type": "text/plain; charset=utf-8", "If-Match": `"${version}"`},
+    body: text
+  }, 'json');
+}
+
+export async function fetchSettings(section) {
+  const response = await fetch(`/settings/${section}`);
+  if (!response.ok) {
+    throw new Error(`Request failed: ${response.status}`);
+  }
+  return { settings: await response.json(), version: response.headers.get('ETag').replace(/"/g, '') };
+}
+
+export function saveSettings(section, params, version) {
+  return apiRequest(`/settings/${section}`, {
+    method: 'POST',
+    headers: {"Content-Type": "application/x-www-form-urlencoded", "If-Match": `"${version}"`},
+    body: new URLSearchParams(params).toString()
+  }, 'json');
+}
+
+export function testStorage(params) {
+  return apiRequest('/settings/storage/test', {
+    method: 'POST',
+    headers: {"Content-Type": "application/x-www-form-urlencoded"},
+    body: new URLSearchParams(params).toString()
+  }, 'json');
+}
+
+export function addTokenAPI(provider, key, version) {
+  return apiRequest('/settings/tokens/add', {
+    method: 'POST',
+    headers: {"Content-Type": "application/x-www-form-urlencoded", "If-Match": `"${version}"`},
+    body: new URLSearchParams({ provider, key }).toString()
+  }, 'json');
+}
+
+export function removeTokenAPI(provider, id, version) {
+  return apiRequest('/settings/tokens/remove', {
+    method: 'POST',
+    headers: {"Content-Type": "application/x-www-form-urlencoded", "If-Match": `"${version}"`},
+    body: new URLSearchParams({ provider, id }).toString()
+  }, 'json');
+}
+
+export function fetchDrift() {
+  return apiRequest('/drift', { method: 'GET' }, 'text');
+}
+
+export function fetchBackups() {
+  return apiRequest('/backups', { method: 'GET' }, 'text');
+}
+
+export function fetchBackup(name) {
+  return apiRequest(`/backups/view?name=${encodeURIComponent(name)}`, { method: 'GET' }, 'text');
+}
+
+export function fetchBackupDiff(name) {
+  return apiRequest(`/backups/diff?name=${encodeURIComponent(name)}`, { method: 'GET' }, 'text');
+}
+
+export function restoreBackupAPI(name) {
+  return apiRequest('/backups/restore', {
+    method: 'POST',
+    headers: {"Content-Type": "application/x-www-form-urlencoded"},
+    body: new URLSearchParams({ name }).toString()
+  }, 'json');
+}
+
+export function fetchHistory() {
+  return apiRequest('/history', { method: 'GET' }, 'text');
+}
+
+export function fetchCommitDiff(commit) {
+  return apiRequest(`/history/diff?commit=${encodeURIComponent(commit)}`, { method: 'GET' }, 'text');
+}
+
+export function fetchFeedBlame(feedKey) {
+  return apiRequest(`/history/blame?feed=${encodeURIComponent(feedKey)}`, { method: 'GET' }, 'text');
+}
+
+export function revertCommitAPI(commit) {
+  return apiRequest('/history/revert', {
+    method: 'POST',
+    headers: {"Content-Type": "application/x-www-form-urlencoded"},
+    body: new URLSearchParams({ commit }).toString()
+  }, 'json');
+}
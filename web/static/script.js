@@ -1,5 +1,8 @@
-import { fetchFeeds, addFeed, modifyFeed, removeFeedAPI, reloadContainer, fetchChangelog } from './feedApi.js';
-import { showMessage, copyText, toggleElementDisplay } from './uiHelpers.js';
+import { fetchFeeds, addFeed, modifyFeed, removeFeedAPI, previewFiltersAPI, fetchCategories, previewScheduleAPI, reloadContainer, fetchChangelog,
+  applyDraftAPI, discardDraftAPI, undoAPI, redoAPI, fetchDrift,
+  fetchBackups, fetchBackup, fetchBackupDiff, restoreBackupAPI,
+  fetchHistory, fetchCommitDiff, fetchFeedBlame, revertCommitAPI } from './feedApi.js';
+import { showMessage, showError, copyText, toggleElementDisplay, renderDiff } from './uiHelpers.js';
 
 // Toggle the visibility of advanced options in the add form
 const toggleLink = document.getElementById("toggleAdvanced");
@@ -17,6 +20,7 @@ function attachFeedListEventListeners() {
       const form = document.getElementById(`edit-form-${key}`);
       btn.textContent = toggleElementDisplay(form, "Edit Feed", "Cancel Edit");
       setupEditFormChangeListeners(key);
+      setupCategorySelects(key);
     });
   });
   document.querySelectorAll('[data-role="save-edit"]').forEach(btn => {
@@ -25,15 +29,29 @@ function attachFeedListEventListeners() {
   document.querySelectorAll('[data-role="remove-feed"]').forEach(btn => {
     btn.addEventListener("click", () => removeFeed(btn));
   });
+  document.querySelectorAll('[data-role="preview-filters"]').forEach(btn => {
+    btn.addEventListener("click", () => previewFilters(btn));
+  });
+  setupScheduleFields(document.getElementById("feedListWrapper"));
   document.querySelectorAll('[data-role="xml-button"]').forEach(el => {
     el.addEventListener("click", () => copyText(el, el.dataset.xmlurl));
   });
 }
 
+// The config version the page was rendered from; writes send it as If-Match so
+// the server can refuse them if the file has changed since.
+function configVersion() {
+  return document.getElementById("configVersion").value;
+}
+
 async function refreshFeedList() {
   try {
     const html = await fetchFeeds();
     document.getElementById("feedListWrapper").innerHTML = html;
+    const container = document.getElementById("feedListContainer");
+    if (container && container.dataset.version) {
+      document.getElementById("configVersion").value = container.dataset.version;
+    }
     attachFeedListEventListeners();
   } catch (err) {
     console.error(err);
@@ -45,16 +63,120 @@ async function refreshChangelogWrapper() {
   try {
     const html = await fetchChangelog();
     document.getElementById("changelogWrapper").innerHTML = html;
+    attachDraftEventListeners();
+    attachUndoEventListeners();
   } catch (err) {
     console.error(err);
     document.getElementById("changelogWrapper").innerHTML = '';
   }
 }
 
+// Staged changes: the diff is rendered in place, with apply and discard.
+function attachDraftEventListeners() {
+  const preview = document.getElementById("draftPreview");
+  if (!preview) return;
+  renderDiff(preview, preview.textContent);
+  document.querySelector('[data-role="apply-draft"]').addEventListener("click", async e => {
+    const btn = e.currentTarget;
+    btn.disabled = true;
+    btn.textContent = "Applying…";
+    try {
+      const data = await applyDraftAPI(configVersion());
+      showMessage(data.message);
+    } catch (err) {
+      console.error(err);
+      showError('Error applying staged changes.', err);
+    }
+    await refreshFeedList();
+    await refreshChangelogWrapper();
+  });
+  document.querySelector('[data-role="discard-draft"]').addEventListener("click", e => {
+    const btn = e.currentTarget;
+    if (btn.textContent.trim() !== 'Confirm Discard') {
+      const orig = btn.textContent;
+      btn.textContent = 'Confirm Discard';
+      setTimeout(() => btn.textContent === 'Confirm Discard' && (btn.textContent = orig), 3000);
+      return;
+    }
+    (async () => {
+      try {
+        const data = await discardDraftAPI(configVersion());
+        showMessage(data.message);
+      } catch (err) {
+        console.error(err);
+        showError('Error discarding staged changes.', err);
+      }
+      await refreshFeedList();
+      await refreshChangelogWrapper();
+    })();
+  });
+}
+
+// Undo and redo of individual feed operations.
+function attachUndoEventListeners() {
+  document.querySelectorAll('#changelogWrapper [data-role="undo-change"]').forEach(btn => {
+    btn.addEventListener("click", () => undoChange(btn.dataset.id));
+  });
+  document.querySelector('#changelogWrapper [data-role="redo-change"]')?.addEventListener("click", async () => {
+    try {
+      showUndoable(await redoAPI(configVersion()));
+    } catch (err) {
+      console.error(err);
+      showError('Error redoing change.', err);
+    }
+    await refreshFeedList();
+    await refreshChangelogWrapper();
+  });
+}
+
+async function undoChange(id) {
+  try {
+    const data = await undoAPI(id, configVersion());
+    showMessage(data.message);
+  } catch (err) {
+    console.error(err);
+    showError('Error undoing change.', err);
+  }
+  await refreshFeedList();
+  await refreshChangelogWrapper();
+}
+
+// Shows the result of a feed operation with a button to undo it.
+function showUndoable(data) {
+  showMessage(data.message);
+  if (!data.undo) return;
+  const btn = document.createElement('button');
+  btn.type = 'button';
+  btn.className = 'btn-undo';
+  btn.textContent = 'Undo';
+  btn.addEventListener("click", () => undoChange(data.undo));
+  document.querySelector('#messageContainer .message').appendChild(btn);
+}
+
 // Initial load
 refreshFeedList();
 refreshChangelogWrapper();
 
+// Live updates: refresh when the config or changelog changes, whether from
+// another tab or an edit outside podconfig. An open edit form is left alone so
+// typed changes are not lost; saving it will report the conflict.
+if (window.EventSource) {
+  const events = new EventSource('/events');
+  events.addEventListener('config', async e => {
+    if (e.data === configVersion()) return;
+    const editing = [...document.querySelectorAll('.edit-form')].some(f => f.style.display !== 'none');
+    if (editing) {
+      showMessage('The config was changed elsewhere. Close the editor and reload the feed list to see it.');
+      return;
+    }
+    await refreshFeedList();
+  });
+  events.addEventListener('changelog', async () => {
+    await refreshChangelogWrapper();
+    await refreshDrift();
+  });
+}
+
 // Reload container
 const reloadBtn = document.getElementById("reloadBtn");
 reloadBtn.addEventListener("click", async () => {
@@ -68,7 +190,7 @@ reloadBtn.addEventListener("click", async () => {
     await refreshChangelogWrapper();
   } catch (err) {
     console.error(err);
-    showMessage('Error reloading container.');
+    showError('Error reloading container.', err);
   } finally {
     reloadBtn.disabled = false;
     reloadBtn.textContent = txt;
@@ -83,23 +205,20 @@ addForm.addEventListener("submit", async e => {
   btn.disabled = true;
   const orig = btn.textContent;
   btn.textContent = "Adding Feed…";
-  const params = {
-    youtubeUrl: document.getElementById("youtubeUrl").value,
-    update_period: document.getElementById("update_period").value,
-    format: document.getElementById("format").value,
-    max_age: document.getElementById("max_age").value,
-    clean_keep_last: document.getElementById("clean_keep_last").value
-  };
+  const params = { youtubeUrl: document.getElementById("youtubeUrl").value };
+  FEED_FIELDS.forEach(f => params[f] = fieldValue(feedField('', f)));
   try {
-    const data = await addFeed(params);
-    showMessage(data.message);
+    const data = await addFeed(params, configVersion());
+    showUndoable(data);
     addForm.reset();
+    addForm.querySelector('[data-role="schedule-mode"]').dispatchEvent(new Event('change'));
     toggleElementDisplay(document.getElementById("advancedOptions"), "Advanced Options", "Hide Advanced Options");
     await refreshFeedList();
     await refreshChangelogWrapper();
   } catch (err) {
     console.error(err);
-    showMessage('Error adding feed.');
+    showError('Error adding feed.', err);
+    if (err.status === 409) await refreshFeedList();
   } finally {
     btn.disabled = false;
     btn.textContent = orig;
@@ -115,46 +234,343 @@ function removeFeed(btn) {
   }
   (async () => {
     try {
-      const data = await removeFeedAPI(btn.dataset.feedkey);
-      showMessage(data.message);
+      const data = await removeFeedAPI(btn.dataset.feedkey, configVersion());
+      showUndoable(data);
       await refreshFeedList();
       await refreshChangelogWrapper();
     } catch (err) {
       console.error(err);
-      showMessage('Error removing feed.');
+      showError('Error removing feed.', err);
+      if (err.status === 409) await refreshFeedList();
     }
   })();
 }
 
+// Feed settings sent by the add and edit forms. Input ids replace the dots
+// in field names with dashes.
+const FEED_FIELDS = [
+  'schedule', 'update_period', 'cron_schedule', 'format',
+  'quality', 'max_height', 'page_size', 'playlist_sort', 'opml', 'private_feed', 'max_age', 'clean_keep_last',
+  'filters.title', 'filters.not_title', 'filters.description', 'filters.not_description',
+  'filters.min_duration', 'filters.max_duration', 'filters.min_age'
+];
+
+// Podcast metadata, only in the edit form.
+const CUSTOM_FIELDS = [
+  'custom.title', 'custom.description', 'custom.author', 'custom.cover_art', 'custom.cover_art_quality',
+  'custom.category', 'custom.subcategories', 'custom.explicit', 'custom.lang', 'custom.link',
+  'custom.ownerName', 'custom.ownerEmail'
+];
+const EDIT_FIELDS = FEED_FIELDS.concat(CUSTOM_FIELDS);
+
+function feedField(prefix, name) {
+  return document.getElementById(prefix + name.replaceAll('.', '-'));
+}
+
+function fieldValue(input) {
+  if (input.type === 'checkbox') return String(input.checked);
+  if (input.multiple) return Array.from(input.selectedOptions, o => o.value).join(', ');
+  return input.value;
+}
+
+// Apple's category taxonomy, fetched once for the category selects.
+let categories;
+
+function setOptions(select, values, selected, unknownLabel) {
+  const known = new Set(values);
+  select.replaceChildren(...values.concat(selected.filter(v => v && !known.has(v))).map(v => {
+    const label = known.has(v) || !v ? v : `${v} (${unknownLabel})`;
+    return new Option(label || 'None', v, false, selected.includes(v));
+  }));
+}
+
+// Fills the category select from the taxonomy, and the subcategory select
+// with the chosen category's subcategories. Values not in the taxonomy stay
+// listed so they are not dropped unnoticed; the server rejects saving them.
+async function setupCategorySelects(key) {
+  const cat = feedField(`${key}-`, 'custom.category');
+  const sub = feedField(`${key}-`, 'custom.subcategories');
+  if (cat.dataset.populated) return;
+  cat.dataset.populated = 'true';
+  try {
+    categories = categories || await fetchCategories();
+  } catch (err) {
+    console.error(err);
+    return;
+  }
+  const fillSubcategories = keepUnknown => {
+    const chosen = categories.find(c => c.name === cat.value);
+    const values = chosen ? chosen.subcategories : [];
+    const selected = Array.from(sub.selectedOptions, o => o.value).filter(v => keepUnknown || values.includes(v));
+    setOptions(sub, values, selected, 'not in this category');
+  };
+  setOptions(cat, [''].concat(categories.map(c => c.name)), [cat.value], 'not an Apple category');
+  fillSubcategories(true);
+  // Subcategories are listed in taxonomy order, which may differ from the config's.
+  sub.dataset.original = fieldValue(sub);
+  cat.addEventListener('change', () => {
+    fillSubcategories(false);
+    sub.dispatchEvent(new Event('change'));
+  });
+}
+
 function setupEditFormChangeListeners(key) {
   const prefix = `${key}-`;
-  const fields = ['update_period','format','max_age','clean_keep_last'];
   const btn = document.querySelector(`[data-role="save-edit"][data-feedkey="${key}"]`);
+  const changed = f => fieldValue(feedField(prefix, f)) !== feedField(prefix, f).dataset.original;
   const check = () => {
-    btn.disabled = !fields.some(f => document.getElementById(prefix+f).value !== document.getElementById(prefix+f).dataset.original);
+    btn.disabled = !EDIT_FIELDS.some(changed);
   };
-  fields.forEach(f => document.getElementById(prefix+f)?.addEventListener(f==='format'?'change':'input', check));
+  EDIT_FIELDS.forEach(f => {
+    const input = feedField(prefix, f);
+    input?.addEventListener(input.tagName === 'SELECT' || input.type === 'checkbox' ? 'change' : 'input', check);
+  });
   check();
 }
 
+// Only changed fields are sent, so clearing a filter clears it in the config.
 function confirmEdit(key) {
   const prefix = `${key}-`;
   const params = { feedKey: key };
-  ['update_period','format','max_age','clean_keep_last'].forEach(f => {
-    const v = document.getElementById(prefix+f).value;
-    if (v) params[f] = v;
+  EDIT_FIELDS.forEach(f => {
+    const input = feedField(prefix, f);
+    if (fieldValue(input) !== input.dataset.original) params[f] = fieldValue(input);
   });
   (async () => {
     try {
-      const data = await modifyFeed(params);
-      showMessage(data.message);
+      const data = await modifyFeed(params, configVersion());
+      showUndoable(data);
       document.getElementById(`edit-form-${key}`).style.display = 'none';
       document.querySelector(`[data-role="edit-button"][data-feedkey="${key}"]`).textContent = 'Edit Feed';
       await refreshFeedList();
       await refreshChangelogWrapper();
     } catch (err) {
       console.error(err);
-      showMessage('Error modifying feed.');
+      showError('Error modifying feed.', err);
+      if (err.status === 409) await refreshFeedList();
     }
   })();
-}
\ No newline at end of file
+}
+
+// The schedule mode shows either the update interval or the cron schedule,
+// which can be previewed in a chosen timezone before saving.
+function setupScheduleFields(root) {
+  const localZone = Intl.DateTimeFormat().resolvedOptions().timeZone;
+  root.querySelectorAll('.schedule-fields').forEach(box => {
+    const mode = box.querySelector('[data-role="schedule-mode"]');
+    const tz = box.querySelector('[data-role="schedule-tz"]');
+    if (!tz.value) tz.value = localZone || 'UTC';
+    mode.addEventListener('change', () => {
+      box.querySelectorAll('[data-schedule]').forEach(el => {
+        el.style.display = el.dataset.schedule === mode.value ? 'block' : 'none';
+      });
+    });
+    box.querySelector('[data-role="preview-schedule"]').addEventListener('click', async e => {
+      const btn = e.currentTarget;
+      const expr = box.querySelector('[id$="cron_schedule"]').value;
+      btn.disabled = true;
+      try {
+        const data = await previewScheduleAPI(expr, tz.value);
+        showError(`Next runs of '${data.cron_schedule}' in ${data.timezone}:`, { detail: data.runs.join('\n') });
+      } catch (err) {
+        console.error(err);
+        showError('Error previewing the schedule.', err);
+      } finally {
+        btn.disabled = false;
+      }
+    });
+  });
+}
+
+setupScheduleFields(addForm);
+
+// Tries the filters in the edit form, saved or not, on the channel's recent uploads.
+async function previewFilters(btn) {
+  const key = btn.dataset.feedkey;
+  const params = { feedKey: key };
+  FEED_FIELDS.filter(f => f === 'max_age' || f.startsWith('filters.'))
+    .forEach(f => params[f] = feedField(`${key}-`, f).value);
+  btn.disabled = true;
+  const orig = btn.textContent;
+  btn.textContent = "Checking…";
+  try {
+    const data = await previewFiltersAPI(params);
+    const lines = data.videos.map(v =>
+      `${v.result.padEnd(7)} ${v.published.slice(0, 10)} ${v.title}${v.reason ? ' (' + v.reason + ')' : ''}`);
+    if (data.note) lines.push('', data.note);
+    let summary = `${data.passed} of ${data.videos.length} recent uploads would pass the filters of '${key}'`;
+    if (data.unknown) summary += `, and ${data.unknown} depend on their duration`;
+    showError(summary + '.', { detail: lines.join('\n') });
+  } catch (err) {
+    console.error(err);
+    showError('Error previewing filters.', err);
+  } finally {
+    btn.disabled = false;
+    btn.textContent = orig;
+  }
+}
+
+// Running config: what podsync has not been reloaded with yet
+const driftLink = document.getElementById("toggleDrift");
+driftLink.addEventListener("click", async e => {
+  e.preventDefault();
+  const wrapper = document.getElementById("driftWrapper");
+  driftLink.textContent = toggleElementDisplay(wrapper, "Running Config", "Hide Running Config");
+  if (wrapper.style.display !== 'none') {
+    await refreshDrift();
+  }
+});
+
+async function refreshDrift() {
+  const wrapper = document.getElementById("driftWrapper");
+  if (wrapper.style.display === 'none') return;
+  try {
+    wrapper.innerHTML = await fetchDrift();
+  } catch (err) {
+    console.error(err);
+    wrapper.innerHTML = '<div class="message">Error loading running config.</div>';
+  }
+}
+
+// Config backups
+const backupLink = document.getElementById("toggleBackups");
+backupLink.addEventListener("click", async e => {
+  e.preventDefault();
+  const wrapper = document.getElementById("backupWrapper");
+  backupLink.textContent = toggleElementDisplay(wrapper, "Config Backups", "Hide Config Backups");
+  if (wrapper.style.display !== 'none') {
+    await refreshBackupList();
+  }
+});
+
+async function refreshBackupList() {
+  const wrapper = document.getElementById("backupWrapper");
+  try {
+    wrapper.innerHTML = await fetchBackups();
+    attachBackupEventListeners();
+  } catch (err) {
+    console.error(err);
+    wrapper.innerHTML = '<div class="message">Error loading backups.</div>';
+  }
+}
+
+function attachBackupEventListeners() {
+  const preview = document.getElementById("backupPreview");
+  document.querySelectorAll('[data-role="view-backup"]').forEach(btn => {
+    btn.addEventListener("click", async () => {
+      try {
+        preview.textContent = await fetchBackup(btn.dataset.name);
+        preview.style.display = 'block';
+      } catch (err) {
+        console.error(err);
+        showMessage('Error loading backup.');
+      }
+    });
+  });
+  document.querySelectorAll('[data-role="diff-backup"]').forEach(btn => {
+    btn.addEventListener("click", async () => {
+      try {
+        renderDiff(preview, await fetchBackupDiff(btn.dataset.name));
+        preview.style.display = 'block';
+      } catch (err) {
+        console.error(err);
+        showMessage('Error loading diff.');
+      }
+    });
+  });
+  document.querySelectorAll('[data-role="restore-backup"]').forEach(btn => {
+    btn.addEventListener("click", () => restoreBackup(btn));
+  });
+}
+
+function restoreBackup(btn) {
+  if (btn.textContent.trim() !== 'Confirm Restore') {
+    const orig = btn.textContent;
+    btn.textContent = 'Confirm Restore';
+    setTimeout(() => btn.textContent === 'Confirm Restore' && (btn.textContent = orig), 3000);
+    return;
+  }
+  (async () => {
+    try {
+      const data = await restoreBackupAPI(btn.dataset.name);
+      showMessage(data.message);
+      await refreshFeedList();
+      await refreshChangelogWrapper();
+      await refreshBackupList();
+    } catch (err) {
+      console.error(err);
+      showError('Error restoring backup.', err);
+    }
+  })();
+}
+
+// Config history (only rendered when GIT_HISTORY is enabled)
+const historyLink = document.getElementById("toggleHistory");
+historyLink?.addEventListener("click", async e => {
+  e.preventDefault();
+  const wrapper = document.getElementById("historyWrapper");
+  historyLink.textContent = toggleElementDisplay(wrapper, "Config History", "Hide Config History");
+  if (wrapper.style.display !== 'none') {
+    await refreshHistoryList();
+  }
+});
+
+async function refreshHistoryList() {
+  const wrapper = document.getElementById("historyWrapper");
+  if (!wrapper) return;
+  try {
+    wrapper.innerHTML = await fetchHistory();
+    attachHistoryEventListeners();
+  } catch (err) {
+    console.error(err);
+    wrapper.innerHTML = '<div class="message">Error loading history.</div>';
+  }
+}
+
+function attachHistoryEventListeners() {
+  const preview = document.getElementById("historyPreview");
+  document.querySelector('[data-role="blame-feed"]')?.addEventListener("click", async () => {
+    try {
+      preview.innerHTML = await fetchFeedBlame(document.getElementById("blameFeed").value);
+      preview.style.display = 'block';
+    } catch (err) {
+      console.error(err);
+      showMessage('Error loading feed history.');
+    }
+  });
+  document.querySelectorAll('[data-role="diff-commit"]').forEach(btn => {
+    btn.addEventListener("click", async () => {
+      try {
+        renderDiff(preview, await fetchCommitDiff(btn.dataset.commit));
+        preview.style.display = 'block';
+      } catch (err) {
+        console.error(err);
+        showMessage('Error loading diff.');
+      }
+    });
+  });
+  document.querySelectorAll('[data-role="revert-commit"]').forEach(btn => {
+    btn.addEventListener("click", () => revertCommit(btn));
+  });
+}
+
+function revertCommit(btn) {
+  if (btn.textContent.trim() !== 'Confirm Revert') {
+    const orig = btn.textContent;
+    btn.textContent = 'Confirm Revert';
+    setTimeout(() => btn.textContent === 'Confirm Revert' && (btn.textContent = orig), 3000);
+    return;
+  }
+  (async () => {
+    try {
+      const data = await revertCommitAPI(btn.dataset.commit);
+      showMessage(data.message);
+      await refreshFeedList();
+      await refreshChangelogWrapper();
+      await refreshHistoryList();
+    } catch (err) {
+      console.error(err);
+      showError('Error reverting config.', err);
+    }
+  })();
+}
@@ -0,0 +1,97 @@
+import { fetchSettings, saveSettings, testStorage, addTokenAPI, removeTokenAPI } from './feedApi.js';
+import { showMessage, showError } from './uiHelpers.js';
+
+const versionInput = document.getElementById("configVersion");
+
+// Every field is sent, so cleared fields remove their setting and unticked
+// boxes turn it off. Fields only used by a test are left out unless asked for.
+function formParams(form, withTestOnly = false) {
+  const params = {};
+  form.querySelectorAll('input[name], select[name]').forEach(el => {
+    if ('testOnly' in el.dataset && !withTestOnly) return;
+    params[el.name] = el.type === 'checkbox' ? String(el.checked) : el.value;
+  });
+  return params;
+}
+
+document.querySelectorAll('form.settings-form').forEach(form => {
+  form.addEventListener("submit", async e => {
+    e.preventDefault();
+    const btn = form.querySelector('button[type="submit"]');
+    btn.disabled = true;
+    try {
+      const data = await saveSettings(form.dataset.section, formParams(form), versionInput.value);
+      showMessage(data.message);
+      versionInput.value = (await fetchSettings(form.dataset.section)).version;
+    } catch (err) {
+      console.error(err);
+      showError('The settings were not saved.', err);
+    } finally {
+      btn.disabled = false;
+    }
+  });
+});
+
+// Storage: only the fields for the selected type are shown.
+const storageType = document.getElementById("storage-type");
+function showStorageFields() {
+  document.querySelectorAll('[data-storage]').forEach(el => {
+    el.style.display = el.dataset.storage === storageType.value ? 'block' : 'none';
+  });
+}
+storageType?.addEventListener("change", showStorageFields);
+if (storageType) showStorageFields();
+
+document.querySelector('[data-role="test-storage"]')?.addEventListener("click", async e => {
+  const btn = e.currentTarget;
+  btn.disabled = true;
+  const orig = btn.textContent;
+  btn.textContent = "Testing…";
+  try {
+    const data = await testStorage(formParams(btn.closest('form'), true));
+    const steps = data.checks.map(c => `${c.ok ? 'ok  ' : 'FAIL'} ${c.step}${c.error ? ': ' + c.error : ''}`).join('\n');
+    showError(data.message, { detail: steps });
+  } catch (err) {
+    console.error(err);
+    showError('Error testing storage.', err);
+  } finally {
+    btn.disabled = false;
+    btn.textContent = orig;
+  }
+});
+
+// Tokens: the list shows masked keys only, so the page is reloaded after a
+// change to show the new list.
+function reloadWith(message) {
+  window.location.href = '/settings?message=' + encodeURIComponent(message);
+}
+
+document.getElementById("addTokenForm")?.addEventListener("submit", async e => {
+  e.preventDefault();
+  const form = e.currentTarget;
+  try {
+    const data = await addTokenAPI(form.provider.value, form.key.value, versionInput.value);
+    reloadWith(data.message);
+  } catch (err) {
+    console.error(err);
+    showError('The key was not added.', err);
+  }
+});
+
+document.querySelectorAll('[data-role="remove-token"]').forEach(btn => {
+  btn.addEventListener("click", async () => {
+    if (btn.textContent.trim() !== 'Confirm Remove') {
+      const orig = btn.textContent;
+      btn.textContent = 'Confirm Remove';
+      setTimeout(() => btn.textContent === 'Confirm Remove' && (btn.textContent = orig), 3000);
+      return;
+    }
+    try {
+      const data = await removeTokenAPI(btn.dataset.provider, btn.dataset.id, versionInput.value);
+      reloadWith(data.message);
+    } catch (err) {
+      console.error(err);
+      showError('The key was not removed.', err);
+    }
+  });
+});
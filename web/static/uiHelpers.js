@@ -4,6 +4,18 @@ export function showMessage(text) {
   container.innerHTML = `<div class="message">${text}</div>`;
 }
 
+// Shows text along with the server's explanation, such as the list of
+// validation problems that blocked a write.
+export function showError(text, err) {
+  showMessage(text);
+  if (err && err.detail) {
+    const pre = document.createElement('pre');
+    pre.className = 'message-detail';
+    pre.textContent = err.detail;
+    document.querySelector('#messageContainer .message').appendChild(pre);
+  }
+}
+
 export function copyText(el, text) {
   if (navigator.clipboard && navigator.clipboard.writeText) {
     navigator.clipboard.writeText(text)
@@ -38,4 +50,21 @@ export function toggleElementDisplay(el, showText, hideText) {
     el.style.display = 'none';
     return showText;
   }
-}
\ No newline at end of file
+}
+
+// Renders unified diff text into el, colouring added and removed lines.
+export function renderDiff(el, text) {
+  el.textContent = '';
+  if (!text) {
+    el.textContent = 'No differences.';
+    return;
+  }
+  text.split('\n').forEach(line => {
+    const span = document.createElement('span');
+    if (line.startsWith('+') && !line.startsWith('+++')) span.className = 'diff-add';
+    else if (line.startsWith('-') && !line.startsWith('---')) span.className = 'diff-del';
+    else if (line.startsWith('@@')) span.className = 'diff-hunk';
+    span.textContent = line + '\n';
+    el.appendChild(span);
+  });
+}